@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/google/uuid"
+	"todo-app/internal/events"
+	"todo-app/internal/hlc"
+	"todo-app/internal/models"
+	"todo-app/internal/service"
+	"todo-app/internal/storage"
+)
+
+// journalFields are the fields a journal entry can set: those that carry
+// clocks on the server.
+var journalFields = []string{
+	service.FieldTitle, service.FieldDescription, service.FieldStatus, service.FieldDueDate,
+	service.FieldPriority, service.FieldTags, service.FieldParentID, service.FieldAutoComplete,
+	service.FieldBlockedBy, service.FieldRecurrence, service.FieldReminders, service.FieldPosition,
+}
+
+// journal keeps the changes made in local mode until the sync command pushes
+// them to a server, in the form POST /api/v1/sync takes them, along with
+// where the last pull from the server ended. It lives in a JSON file next to
+// the todos.
+type journal struct {
+	path string
+	mu   sync.Mutex
+
+	// Node names this copy of the todos in the clock times of its changes.
+	Node string `json:"node"`
+	// Remote is the server last synced with, and Token where its changes
+	// were last read up to.
+	Remote string `json:"remote,omitempty"`
+	Token  string `json:"token,omitempty"`
+	// Changes are the changes not pushed yet, oldest first.
+	Changes []journalEntry `json:"changes"`
+	// Spawned maps the next occurrences of repeating todos finished locally
+	// to the todo finished. The server creates its own occurrence when it
+	// learns the todo was finished, so these are not pushed; see settle.
+	Spawned map[string]string `json:"spawned,omitempty"`
+}
+
+// journalEntry is a change in the journal: the fields a local edit set, or a
+// deletion.
+type journalEntry struct {
+	Op       string                     `json:"op"`
+	ID       string                     `json:"id"`
+	Clock    hlc.Timestamp              `json:"clock"`
+	Fields   map[string]json.RawMessage `json:"fields,omitempty"`
+	Subtasks string                     `json:"subtasks,omitempty"`
+}
+
+// openJournal loads the journal at path, starting an empty one with a new
+// node name if there is none yet.
+func openJournal(path string) (*journal, error) {
+	j := &journal{path: path}
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		host, _ := os.Hostname()
+		if host == "" {
+			host = "cli"
+		}
+		j.Node = host + "-" + uuid.NewString()[:8]
+		return j, nil
+	case err != nil:
+		return nil, err
+	}
+	if err := json.Unmarshal(data, j); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+func (j *journal) save() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return storage.WriteFileAtomic(j.path, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(j)
+	})
+}
+
+// record subscribes the journal to the changes todos makes.
+//
+// A new todo is journaled with all its fields. An edit is journaled with the
+// fields the service stamped with this node's clock, one entry per time, so
+// the server merges them field by field just like its own edits. Deletions
+// promote subtasks on the server: those deleted here come as deletions of
+// their own.
+func (j *journal) record(todos *service.TodoService) {
+	todos.Events().Subscribe("journal", func(ctx context.Context, e events.Event) {
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		if _, ok := j.Spawned[e.TodoID()]; ok {
+			return
+		}
+		switch e := e.(type) {
+		case events.TodoCreated:
+			j.add(e.Todo, todos.Clock().Now(), journalFields)
+		case events.TodoUpdated:
+			j.addEdit(e.Before, e.After)
+		case events.TodoDeleted:
+			j.Changes = append(j.Changes, journalEntry{Op: "delete", ID: e.Todo.ID, Clock: todos.Clock().Now(), Subtasks: string(service.SubtasksPromote)})
+		}
+	})
+}
+
+func (j *journal) addEdit(before, after *models.Todo) {
+	byClock := map[hlc.Timestamp][]string{}
+	for _, field := range journalFields {
+		clock := after.Clocks[field]
+		if clock.Node == j.Node && clock != before.Clocks[field] {
+			byClock[clock] = append(byClock[clock], field)
+		}
+	}
+	clocks := make([]hlc.Timestamp, 0, len(byClock))
+	for clock := range byClock {
+		clocks = append(clocks, clock)
+	}
+	sort.Slice(clocks, func(a, b int) bool { return clocks[a].Compare(clocks[b]) < 0 })
+	for _, clock := range clocks {
+		j.add(after, clock, byClock[clock])
+	}
+
+	if before.Recurrence != nil && before.Recurrence.NextID == "" && after.Recurrence != nil && after.Recurrence.NextID != "" {
+		j.unrecord(after.Recurrence.NextID)
+		if j.Spawned == nil {
+			j.Spawned = map[string]string{}
+		}
+		j.Spawned[after.Recurrence.NextID] = after.ID
+	}
+}
+
+// add journals fields of todo as set at clock. A field missing from the
+// todo's JSON is empty, and is cleared on the server.
+func (j *journal) add(todo *models.Todo, clock hlc.Timestamp, fields []string) {
+	data, _ := json.Marshal(todo)
+	var values map[string]json.RawMessage
+	json.Unmarshal(data, &values)
+
+	entry := journalEntry{Op: "upsert", ID: todo.ID, Clock: clock, Fields: map[string]json.RawMessage{}}
+	for _, field := range fields {
+		value, ok := values[field]
+		if !ok {
+			value = json.RawMessage("null")
+		}
+		entry.Fields[field] = value
+	}
+	j.Changes = append(j.Changes, entry)
+}
+
+// unrecord drops the journaled changes of a todo.
+func (j *journal) unrecord(id string) {
+	kept := j.Changes[:0]
+	for _, c := range j.Changes {
+		if c.ID != id {
+			kept = append(kept, c)
+		}
+	}
+	j.Changes = kept
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"todo-app/internal/handlers"
+	"todo-app/internal/reminder"
+	"todo-app/internal/service"
+	"todo-app/internal/storage"
+	"todo-app/internal/workflow"
+)
+
+// localURL is the base URL of the API in local mode. Requests to it never
+// leave the process.
+const localURL = "http://local/api/v1"
+
+// localStore runs the todo API in-process over a local file, for --local. The
+// commands talk to it over HTTP as they would to a server, through a
+// transport that serves their requests itself, and every change they make is
+// recorded in a journal for the sync command.
+type localStore struct {
+	path    string
+	todos   storage.TodoStorage
+	closer  io.Closer
+	service *service.TodoService
+	journal *journal
+	handler http.Handler
+}
+
+// openLocal opens the todos at path: SQLite for a .db, .sqlite or .sqlite3
+// file, JSON otherwise. The journal is kept next to them. A leading ~/ is
+// the home directory, and missing directories are created.
+func openLocal(path string) (*localStore, error) {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(home, rest)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+
+	l := &localStore{path: path}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".db", ".sqlite", ".sqlite3":
+		store, err := storage.NewSQLiteStorage(path)
+		if err != nil {
+			return nil, err
+		}
+		l.todos, l.closer = store, store
+	default:
+		store, err := storage.NewJSONFileStorage(path, 0)
+		if err != nil {
+			return nil, err
+		}
+		l.todos, l.closer = store, store
+	}
+
+	j, err := openJournal(path + ".journal")
+	if err != nil {
+		l.closer.Close()
+		return nil, err
+	}
+	l.journal = j
+
+	flow, err := workflow.New(workflow.Default())
+	if err != nil {
+		l.closer.Close()
+		return nil, err
+	}
+	l.service = service.NewTodoService(l.todos, flow)
+	l.service.SetNode(j.Node)
+	j.record(l.service)
+
+	// Reminders are only listed: sending them is the server's job.
+	scheduler, err := reminder.New(l.service, &reminder.MemoryStore{}, time.Hour)
+	if err != nil {
+		l.closer.Close()
+		return nil, err
+	}
+
+	router := mux.NewRouter()
+	api := router.PathPrefix("/api/v1").Subrouter()
+	for _, r := range []*mux.Router{router, api} {
+		r.NotFoundHandler = http.HandlerFunc(handlers.NotFound)
+		r.MethodNotAllowedHandler = http.HandlerFunc(handlers.MethodNotAllowed)
+	}
+	handlers.Routes(api, handlers.NewTodoHandler(l.service), handlers.NewSyncHandler(l.service))
+	api.HandleFunc("/reminders", handlers.NewReminderHandler(scheduler).GetUpcoming).Methods("GET")
+	l.handler = router
+	return l, nil
+}
+
+// RoundTrip serves a request with the in-process API.
+func (l *localStore) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	if r.Body == nil {
+		r.Body = http.NoBody
+	}
+	r.RequestURI = r.URL.RequestURI()
+	r.RemoteAddr = "127.0.0.1:0"
+
+	rec := httptest.NewRecorder()
+	l.handler.ServeHTTP(rec, r)
+	resp := rec.Result()
+	resp.Request = req
+	return resp, nil
+}
+
+// Close saves the journal and closes the todos, flushing what the command
+// changed.
+func (l *localStore) Close() error {
+	err := l.journal.save()
+	if cerr := l.closer.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("saving %s: %w", l.path, err)
+	}
+	return nil
+}
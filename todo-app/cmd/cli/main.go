@@ -2,76 +2,269 @@ package main
 
 import (
     "bufio"
+    "context"
     "encoding/json"
+    "errors"
+    "flag"
     "fmt"
+    "html"
     "net/http"
     "os"
+    "os/exec"
+    "os/signal"
+    "runtime"
+    "strconv"
     "strings"
     "time"
+    // --tz names IANA time zones; embed the database for hosts without one.
+    _ "time/tzdata"
+    
+    "todo-app/pkg/client"
 )
 
-type Todo struct {
-    ID          string    `json:"id"`
-    Title       string    `json:"title"`
-    Description string    `json:"description"`
-    Status      string    `json:"status"`
-    DueDate     time.Time `json:"due_date"`
-    CreatedAt   time.Time `json:"created_at"`
+// api is the client of the server, or of the in-process API with --local.
+var api = client.New("http://localhost:8080")
+
+// tagList collects repeatable flags such as --tag. Each flag may name several
+// comma-separated values.
+type tagList []string
+
+func (t *tagList) String() string {
+    return strings.Join(*t, ",")
+}
+
+func (t *tagList) Set(value string) error {
+    for _, tag := range strings.Split(value, ",") {
+        if tag = strings.TrimSpace(tag); tag != "" {
+            *t = append(*t, tag)
+        }
+    }
+    return nil
 }
 
-const baseURL = "http://localhost:8080/api/v1"
+// todoOptions are the flags of the create, list, update and delete commands.
+type todoOptions struct {
+    priority     string
+    tags         tagList
+    parent       string
+    autoComplete bool
+    tree         bool
+    subtasks     string
+    blockedBy    tagList
+    repeat       string
+    timeZone     string
+    reminders    tagList
+    listen       string
+    remote       string
+    // set holds the names of the flags given on the command line.
+    set map[string]bool
+}
+
+// todoFlags parses the flags of a command and returns the remaining
+// arguments.
+func todoFlags(name string, args []string) (*todoOptions, []string) {
+    opts := &todoOptions{set: map[string]bool{}}
+    fs := flag.NewFlagSet(name, flag.ExitOnError)
+    fs.StringVar(&opts.priority, "priority", "", "priority: none, low, medium, high or urgent")
+    fs.Var(&opts.tags, "tag", "tag, repeatable or comma-separated")
+    fs.StringVar(&opts.parent, "parent", "", "ID of the parent todo (\"none\" for top level)")
+    fs.BoolVar(&opts.autoComplete, "auto-complete", false, "complete the todo when all its subtasks are done")
+    fs.BoolVar(&opts.tree, "tree", false, "show subtasks nested under their parents")
+    fs.StringVar(&opts.subtasks, "subtasks", "", "what to do with subtasks: cascade or promote")
+    fs.Var(&opts.blockedBy, "blocked-by", "ID of a todo that must be done first, repeatable or comma-separated")
+    fs.StringVar(&opts.repeat, "repeat", "", "RFC 5545 recurrence rule, e.g. \"FREQ=WEEKLY;BYDAY=MO\" (\"none\" to stop repeating)")
+    fs.StringVar(&opts.timeZone, "tz", "", "IANA time zone the due date and recurrence rule are in, e.g. Europe/Berlin")
+    fs.Var(&opts.reminders, "remind", "how long before the due date to remind, e.g. 1d or 2h30m, repeatable (\"none\" for no reminders)")
+    fs.StringVar(&opts.listen, "listen", "localhost:9090", "address the daemon receives reminders on")
+    fs.StringVar(&opts.remote, "remote", "", "URL of the server to sync with, e.g. http://localhost:8080 (default: the last one)")
+    fs.Parse(args)
+    fs.Visit(func(f *flag.Flag) { opts.set[f.Name] = true })
+    return opts, fs.Args()
+}
 
 func main() {
-    if len(os.Args) < 2 {
+    localPath := flag.String("local", "", "keep the todos in this file instead of on a server, e.g. ~/.todo/db.json")
+    flag.Usage = printUsage
+    flag.Parse()
+    args := flag.Args()
+    if len(args) < 1 {
         printUsage()
         return
     }
     
-    switch os.Args[1] {
+    // In local mode the commands talk to the API served in-process.
+    var local *localStore
+    if *localPath != "" {
+        var err error
+        local, err = openLocal(*localPath)
+        if err != nil {
+            fmt.Println("Error:", err)
+            os.Exit(1)
+        }
+        defer func() {
+            if err := local.Close(); err != nil {
+                fmt.Println("Error:", err)
+            }
+        }()
+        api = client.New(localURL)
+        api.HTTPClient = &http.Client{Transport: local}
+    }
+    
+    ctx := context.Background()
+    
+    switch args[0] {
     case "create":
-        createTodo()
+        opts, _ := todoFlags("create", args[1:])
+        createTodo(ctx, opts)
     case "list":
-        listTodos()
+        opts, _ := todoFlags("list", args[1:])
+        if opts.tree {
+            listTree(ctx)
+            return
+        }
+        listTodos(ctx, opts)
     case "get":
-        if len(os.Args) < 3 {
+        if len(args) < 2 {
             fmt.Println("Please provide todo ID")
             return
         }
-        getTodo(os.Args[2])
+        getTodo(ctx, args[1])
     case "update":
-        if len(os.Args) < 3 {
+        opts, args := todoFlags("update", args[1:])
+        if len(args) < 1 {
             fmt.Println("Please provide todo ID")
             return
         }
-        updateTodo(os.Args[2])
+        updateTodo(ctx, args[0], opts)
     case "delete":
-        if len(os.Args) < 3 {
+        opts, args := todoFlags("delete", args[1:])
+        if len(args) < 1 {
             fmt.Println("Please provide todo ID")
             return
         }
-        deleteTodo(os.Args[2])
+        deleteTodo(ctx, args[0], opts.subtasks)
     case "filter":
-        if len(os.Args) < 3 {
-            fmt.Println("Please provide status (pending/in_progress/completed)")
+        if len(args) < 2 {
+            fmt.Println("Please provide a status (pending/in_progress/completed) or a filter query")
+            return
+        }
+        filterTodos(ctx, strings.Join(args[1:], " "))
+    case "search":
+        if len(args) < 2 {
+            fmt.Println("Please provide search terms")
+            return
+        }
+        searchTodos(ctx, strings.Join(args[1:], " "))
+    case "start", "complete", "reopen":
+        if len(args) < 2 {
+            fmt.Println("Please provide todo ID")
+            return
+        }
+        transitionTodo(ctx, args[1], args[0], strings.Join(args[2:], " "))
+    case "do":
+        if len(args) < 3 {
+            fmt.Println("Please provide an action and a todo ID")
+            return
+        }
+        transitionTodo(ctx, args[2], args[1], strings.Join(args[3:], " "))
+    case "deps":
+        switch {
+        case len(args) == 2:
+            showDeps(ctx, args[1])
+        case len(args) == 4 && args[1] == "add":
+            changeBlocker(ctx, true, args[2], args[3])
+        case len(args) == 4 && args[1] == "rm":
+            changeBlocker(ctx, false, args[2], args[3])
+        default:
+            printUsage()
+        }
+    case "plan":
+        showPlan(ctx)
+    case "occurrences":
+        if len(args) < 2 {
+            fmt.Println("Please provide todo ID")
+            return
+        }
+        limit := 10
+        if len(args) > 2 {
+            n, err := strconv.Atoi(args[2])
+            if err != nil || n <= 0 {
+                fmt.Println("Please provide the number of occurrences as a positive number")
+                return
+            }
+            limit = n
+        }
+        showOccurrences(ctx, args[1], limit)
+    case "reminders":
+        within := "1d"
+        if len(args) > 1 {
+            within = args[1]
+        }
+        showReminders(ctx, within)
+    case "daemon":
+        opts, _ := todoFlags("daemon", args[1:])
+        runDaemon(opts.listen)
+    case "watch":
+        if local != nil {
+            fmt.Println("watch follows the changes on a server and does not work with --local")
+            return
+        }
+        watchTodos(ctx, strings.Join(args[1:], " "))
+    case "tags":
+        switch {
+        case len(args) == 1:
+            listTags(ctx)
+        case args[1] == "rename" && len(args) == 4:
+            renameTag(ctx, args[2], args[3])
+        case args[1] == "merge" && len(args) >= 4:
+            mergeTags(ctx, args[3:], args[2])
+        default:
+            printUsage()
+        }
+    case "sync":
+        opts, _ := todoFlags("sync", args[1:])
+        if local == nil {
+            fmt.Println("sync needs --local: it syncs the local todos with a server")
             return
         }
-        filterTodos(os.Args[2])
+        syncLocal(ctx, local, opts.remote)
     default:
         printUsage()
     }
 }
 
 func printUsage() {
-    fmt.Println(`Todo CLI Usage:
-  create - Create a new todo
-  list - List all todos
+    fmt.Println(`Todo CLI Usage: todo [--local file] <command>
+  --local file - Keep the todos in a JSON (or .db SQLite) file instead of on a server, e.g. ~/.todo/db.json
+  create [--priority p] [--tag t]... [--parent id] [--auto-complete] [--blocked-by id]... [--repeat rule [--tz zone]] [--remind before]... - Create a new todo
+  list [--priority p] [--tag t]... [--parent id] - List all todos, optionally by priority, tag and parent
+  list --tree - List todos with their subtasks nested under them
   get <id> - Get a specific todo
   update <id> - Update a todo
-  delete <id> - Delete a todo
-  filter <status> - Filter todos by status`)
+  update [--priority p] [--tag t]... [--parent id] [--auto-complete=b] [--blocked-by id]... [--repeat rule [--tz zone]] [--remind before]... <id> - Set a todo's priority, tags, parent, auto-completion, blockers, recurrence or reminders
+  delete [--subtasks cascade|promote] <id> - Delete a todo, and its subtasks with cascade
+  filter <status> - Filter todos by status
+  filter <query> - Filter todos, e.g. 'status:pending AND due<2026-11-01'
+  search <terms> - Search titles and descriptions
+  start <id> - Start working on a todo
+  complete <id> - Mark a todo completed
+  reopen <id> <reason> - Reopen a completed todo
+  do <action> <id> [reason] - Run any workflow action
+  deps <id> - Show what a todo is blocked by and what it blocks
+  deps add <id> <blocker-id> - Mark a todo as blocked by another
+  deps rm <id> <blocker-id> - Remove a blocker
+  plan - Show open todos in dependency order and the critical path
+  occurrences <id> [n] - Preview the next n occurrences of a repeating todo
+  reminders [within] - List the reminders due within a time such as 1d or 1w (default 1d)
+  daemon [--listen addr] - Show reminders as desktop notifications; start the server with -notify-webhook http://addr/
+  watch [query] - Print changes to todos as they happen, optionally only those matching a filter query
+  tags - List tags and how many todos use them
+  tags rename <old> <new> - Rename a tag on every todo
+  tags merge <into> <from>... - Merge tags into one
+  sync [--remote url] - Push the changes made with --local to a server and pull its changes (default: the last server)`)
 }
 
-func createTodo() {
+func createTodo(ctx context.Context, opts *todoOptions) {
     reader := bufio.NewReader(os.Stdin)
     
     fmt.Print("Title: ")
@@ -82,118 +275,594 @@ func createTodo() {
     description, _ := reader.ReadString('\n')
     description = strings.TrimSpace(description)
     
-    fmt.Print("Due Date (YYYY-MM-DD): ")
+    fmt.Print("Due Date (YYYY-MM-DD [HH:MM]): ")
     dateStr, _ := reader.ReadString('\n')
     dateStr = strings.TrimSpace(dateStr)
     
     var dueDate time.Time
     if dateStr != "" {
         var err error
-        dueDate, err = time.Parse("2006-01-02", dateStr)
+        dueDate, err = parseDueDate(dateStr, opts.timeZone)
         if err != nil {
-            fmt.Println("Invalid date format")
+            fmt.Println(err)
             return
         }
     }
     
-    data := map[string]interface{}{
-        "title":       title,
-        "description": description,
-        "due_date":    dueDate,
+    todo, err := api.CreateTodo(ctx, client.NewTodo{
+        Title:        title,
+        Description:  description,
+        DueDate:      dueDate,
+        Priority:     opts.priority,
+        Tags:         opts.tags,
+        ParentID:     opts.parent,
+        AutoComplete: opts.autoComplete,
+        BlockedBy:    opts.blockedBy,
+        Recurrence:   recurrence(opts),
+        Reminders:    reminders(opts),
+    })
+    if err != nil {
+        fmt.Println("Error:", err)
+        return
     }
-    
-    jsonData, _ := json.Marshal(data)
-    resp, err := http.Post(baseURL+"/todos", "application/json", strings.NewReader(string(jsonData)))
+    printTodo(todo)
+}
+
+// parseDueDate parses a date, optionally with a time of day, in the named
+// time zone (UTC if empty).
+func parseDueDate(s, timeZone string) (time.Time, error) {
+    loc, err := time.LoadLocation(timeZone)
+    if err != nil {
+        return time.Time{}, fmt.Errorf("Unknown time zone %q", timeZone)
+    }
+    for _, layout := range []string{"2006-01-02 15:04", "2006-01-02"} {
+        if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+            return t, nil
+        }
+    }
+    return time.Time{}, fmt.Errorf("Invalid date format")
+}
+
+func recurrence(opts *todoOptions) *client.Recurrence {
+    if opts.repeat == "" || opts.repeat == "none" {
+        return nil
+    }
+    return &client.Recurrence{Rule: opts.repeat, TimeZone: opts.timeZone}
+}
+
+// reminders are the reminders set by --remind; "none" removes them all.
+func reminders(opts *todoOptions) []string {
+    if len(opts.reminders) == 1 && opts.reminders[0] == "none" {
+        return []string{}
+    }
+    return opts.reminders
+}
+
+func listTodos(ctx context.Context, opts *todoOptions) {
+    list := client.ListOptions{Tags: opts.tags}
+    if opts.priority != "" {
+        list.Priorities = strings.Split(opts.priority, ",")
+    }
+    if opts.set["parent"] {
+        list.Query = "parent=" + strconv.Quote(opts.parent)
+    }
+    printTodos(api.Todos(ctx, list))
+}
+
+// listTree prints every todo as an outline, subtasks indented under their
+// parents.
+func listTree(ctx context.Context) {
+    roots, err := api.Forest(ctx)
     if err != nil {
         fmt.Println("Error:", err)
         return
     }
-    defer resp.Body.Close()
-    
-    var todo Todo
-    json.NewDecoder(resp.Body).Decode(&todo)
-    printTodo(&todo)
+    if len(roots) == 0 {
+        fmt.Println("No todos")
+        return
+    }
+    for i := range roots {
+        printTree(&roots[i], "", "")
+    }
+}
+
+// printTree prints todo and its subtasks. prefix starts the todo's own line
+// and indent the lines of its subtasks.
+func printTree(todo *client.Todo, prefix, indent string) {
+    line := fmt.Sprintf("%s%s [%s] %s", prefix, todo.Title, todo.Status, todo.ID)
+    if todo.Progress != nil {
+        line += fmt.Sprintf(" (%d/%d)", todo.Progress.Done, todo.Progress.Total)
+    }
+    fmt.Println(line)
+    for i := range todo.Children {
+        if i == len(todo.Children)-1 {
+            printTree(&todo.Children[i], indent+"└── ", indent+"    ")
+        } else {
+            printTree(&todo.Children[i], indent+"├── ", indent+"│   ")
+        }
+    }
 }
 
-func listTodos() {
-    resp, err := http.Get(baseURL + "/todos")
+// printTodos prints every todo of a listing, a page at a time.
+func printTodos(it *client.Iterator[client.Todo]) {
+    for it.Next() {
+        todo := it.Value()
+        printTodo(&todo)
+        fmt.Println("---")
+    }
+    if err := it.Err(); err != nil {
+        fmt.Println("Error:", err)
+    }
+}
+
+func getTodo(ctx context.Context, id string) {
+    todo, err := api.GetTodo(ctx, id)
     if err != nil {
         fmt.Println("Error:", err)
         return
     }
-    defer resp.Body.Close()
+    printTodo(todo)
+}
+
+func updateTodo(ctx context.Context, id string, opts *todoOptions) {
+    if len(opts.set) > 0 {
+        setFields(ctx, id, opts)
+        return
+    }
     
-    var todos []Todo
-    json.NewDecoder(resp.Body).Decode(&todos)
+    todo, err := api.GetTodo(ctx, id)
+    if err != nil {
+        fmt.Println("Error:", err)
+        return
+    }
+    printTodo(todo)
+    fmt.Println("Leave a field blank to keep its current value.")
     
-    for _, todo := range todos {
-        printTodo(&todo)
-        fmt.Println("---")
+    reader := bufio.NewReader(os.Stdin)
+    var update client.TodoUpdate
+    for _, field := range []struct {
+        prompt string
+        value  *string
+    }{
+        {"Title", &update.Title},
+        {"Description", &update.Description},
+        {"Status (pending/in_progress/completed)", &update.Status},
+    } {
+        fmt.Printf("%s: ", field.prompt)
+        value, _ := reader.ReadString('\n')
+        *field.value = strings.TrimSpace(value)
+    }
+    
+    fmt.Print("Due Date (YYYY-MM-DD [HH:MM]): ")
+    dateStr, _ := reader.ReadString('\n')
+    if dateStr = strings.TrimSpace(dateStr); dateStr != "" {
+        timeZone := ""
+        if todo.Recurrence != nil {
+            timeZone = todo.Recurrence.TimeZone
+        }
+        update.DueDate, err = parseDueDate(dateStr, timeZone)
+        if err != nil {
+            fmt.Println(err)
+            return
+        }
+    }
+    
+    // Only apply the edit to the version we showed the user.
+    updated, err := api.UpdateTodo(ctx, id, update, todo.Version)
+    switch {
+    case err == nil:
+        printTodo(updated)
+    case errors.Is(err, client.ErrPrecondition):
+        fmt.Printf("Conflict: todo %s was changed by someone else while you were editing it (you had version %d).\n", id, todo.Version)
+        fmt.Println("Your changes were not saved. Run update again to edit the latest version.")
+    default:
+        fmt.Println("Error updating todo:", err)
     }
 }
 
-func getTodo(id string) {
-    resp, err := http.Get(baseURL + "/todos/" + id)
+// setFields sets the todo fields given as flags without prompting.
+func setFields(ctx context.Context, id string, opts *todoOptions) {
+    patch := client.Patch{}
+    if opts.set["priority"] {
+        patch["priority"] = opts.priority
+    }
+    if opts.set["tag"] {
+        patch["tags"] = opts.tags
+    }
+    if opts.set["parent"] {
+        // A null parent moves the todo to the top level.
+        patch["parent_id"] = nil
+        if opts.parent != "none" && opts.parent != "" {
+            patch["parent_id"] = opts.parent
+        }
+    }
+    if opts.set["auto-complete"] {
+        patch["auto_complete"] = opts.autoComplete
+    }
+    if opts.set["blocked-by"] {
+        patch["blocked_by"] = opts.blockedBy
+    }
+    if opts.set["repeat"] {
+        // The series restarts from the todo's current due date.
+        patch["recurrence"] = recurrence(opts)
+    }
+    if opts.set["remind"] {
+        patch["reminders"] = reminders(opts)
+    }
+    
+    todo, err := api.PatchTodo(ctx, id, patch, 0)
+    if err != nil {
+        fmt.Println("Error updating todo:", err)
+        return
+    }
+    printTodo(todo)
+}
+
+func deleteTodo(ctx context.Context, id, subtasks string) {
+    if err := api.DeleteTodo(ctx, id, subtasks); err != nil {
+        fmt.Println("Error deleting todo:", err)
+        return
+    }
+    fmt.Println("Todo deleted successfully")
+}
+
+// transitionTodo runs a workflow action such as "start" on a todo.
+func transitionTodo(ctx context.Context, id, action, reason string) {
+    todo, err := api.Transition(ctx, id, action, reason, 0)
+    if err != nil {
+        fmt.Println("Error:", err)
+        return
+    }
+    printTodo(todo)
+}
+
+// filterTodos lists the todos matching a filter query. A bare status such as
+// "pending" is accepted as shorthand for "status:pending".
+func filterTodos(ctx context.Context, query string) {
+    switch query {
+    case "pending", "in_progress", "completed":
+        query = "status:" + query
+    }
+    printTodos(api.Todos(ctx, client.ListOptions{Query: query}))
+}
+
+func searchTodos(ctx context.Context, terms string) {
+    results, err := api.SearchTodos(ctx, terms, 0)
     if err != nil {
         fmt.Println("Error:", err)
         return
     }
-    defer resp.Body.Close()
     
-    if resp.StatusCode == 404 {
-        fmt.Println("Todo not found")
+    if len(results) == 0 {
+        fmt.Println("No matching todos")
+        return
+    }
+    for _, result := range results {
+        fmt.Printf("[%.2f] %s  %s\n", result.Score, result.Todo.ID, plainHighlight(result.Highlights["title"], result.Todo.Title))
+        if snippet := result.Highlights["description"]; snippet != "" {
+            fmt.Printf("    %s\n", plainHighlight(snippet, ""))
+        }
+    }
+}
+
+// plainHighlight renders an HTML highlight for the terminal, marking matches
+// with brackets. An empty highlight falls back to the plain text.
+func plainHighlight(highlight, fallback string) string {
+    if highlight == "" {
+        return fallback
+    }
+    highlight = strings.NewReplacer("<mark>", "[", "</mark>", "]").Replace(highlight)
+    return html.UnescapeString(highlight)
+}
+
+func showDeps(ctx context.Context, id string) {
+    todo, err := api.GetTodo(ctx, id)
+    if err != nil {
+        fmt.Println("Error:", err)
+        return
+    }
+    deps, err := api.Dependencies(ctx, id)
+    if err != nil {
+        fmt.Println("Error:", err)
         return
     }
     
-    var todo Todo
-    json.NewDecoder(resp.Body).Decode(&todo)
-    printTodo(&todo)
+    fmt.Printf("%s [%s]\n", todo.Title, todo.Status)
+    fmt.Println("  Blocked by:")
+    printDeps(deps.BlockedBy)
+    fmt.Println("  Blocks:")
+    printDeps(deps.Blocks)
 }
 
-func updateTodo(id string) {
-    // Implementation similar to create but with PUT
-    fmt.Println("Update functionality would go here")
+func printDeps(todos []client.Todo) {
+    if len(todos) == 0 {
+        fmt.Println("    (nothing)")
+    }
+    for _, t := range todos {
+        fmt.Printf("    %s [%s] %s\n", t.Title, t.Status, t.ID)
+    }
 }
 
-func deleteTodo(id string) {
-    client := &http.Client{}
-    req, _ := http.NewRequest("DELETE", baseURL+"/todos/"+id, nil)
-    resp, err := client.Do(req)
+// changeBlocker adds or removes a blocker of a todo.
+func changeBlocker(ctx context.Context, add bool, id, blocker string) {
+    change := api.RemoveBlocker
+    if add {
+        change = api.AddBlocker
+    }
+    if _, err := change(ctx, id, blocker, 0); err != nil {
+        fmt.Println("Error:", err)
+        return
+    }
+    showDeps(ctx, id)
+}
+
+func showPlan(ctx context.Context) {
+    plan, err := api.Plan(ctx)
     if err != nil {
         fmt.Println("Error:", err)
         return
     }
-    defer resp.Body.Close()
     
-    if resp.StatusCode == 204 {
-        fmt.Println("Todo deleted successfully")
-    } else {
-        fmt.Println("Error deleting todo")
+    line := func(item client.PlanItem) string {
+        s := fmt.Sprintf("%s [%s] %s", item.Title, item.Status, item.ID)
+        if item.Deadline != nil {
+            s += " (by " + item.Deadline.Format("2006-01-02") + ")"
+        }
+        return s
+    }
+    fmt.Println("Order:")
+    for i, item := range plan.Order {
+        fmt.Printf("  %d. %s\n", i+1, line(item))
+    }
+    if len(plan.CriticalPath) > 0 {
+        fmt.Println("Critical path:")
+        for i, item := range plan.CriticalPath {
+            arrow := "  "
+            if i > 0 {
+                arrow = "→ "
+            }
+            fmt.Printf("  %s%s\n", arrow, line(item))
+        }
+    }
+    if len(plan.Cyclic) > 0 {
+        fmt.Println("Waiting on each other (cannot be ordered):")
+        for _, item := range plan.Cyclic {
+            fmt.Printf("  %s\n", line(item))
+        }
+    }
+}
+
+// showOccurrences previews when a repeating todo will next be due.
+func showOccurrences(ctx context.Context, id string, limit int) {
+    todo, err := api.GetTodo(ctx, id)
+    if err != nil {
+        fmt.Println("Error:", err)
+        return
+    }
+    occurrences, err := api.Occurrences(ctx, id, limit)
+    if err != nil {
+        fmt.Println("Error:", err)
+        return
+    }
+    if len(occurrences) == 0 {
+        fmt.Println("No further occurrences")
+        return
+    }
+    for _, o := range occurrences {
+        fmt.Printf("%4d  %s\n", o.Occurrence, formatDueDate(&client.Todo{DueDate: o.DueDate, Recurrence: todo.Recurrence}))
     }
 }
 
-func filterTodos(status string) {
-    resp, err := http.Get(baseURL + "/todos/filter?status=" + status)
+// showReminders lists the reminders the server will send within the given
+// time.
+func showReminders(ctx context.Context, within string) {
+    upcoming, err := api.Reminders(ctx, within)
     if err != nil {
         fmt.Println("Error:", err)
         return
     }
-    defer resp.Body.Close()
+    if len(upcoming) == 0 {
+        fmt.Println("No reminders within", within)
+        return
+    }
+    for _, n := range upcoming {
+        when := "due"
+        if n.Before != "0" {
+            when = n.Before + " before"
+        }
+        fmt.Printf("%s  %-36s  %s (%s)\n", n.At.Local().Format("2006-01-02 15:04"), n.Todo.ID, n.Todo.Title, when)
+    }
+}
+
+// runDaemon receives the reminders the server POSTs to its -notify-webhook
+// and shows each as a desktop notification.
+func runDaemon(addr string) {
+    handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.Method != http.MethodPost {
+            w.WriteHeader(http.StatusMethodNotAllowed)
+            return
+        }
+        var n client.Notification
+        if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+            http.Error(w, "invalid notification", http.StatusBadRequest)
+            return
+        }
+        fmt.Printf("%s  %s\n", time.Now().Format("2006-01-02 15:04"), n.Message)
+        if err := desktopNotify("Todo reminder", n.Message); err != nil {
+            fmt.Println("Could not show notification:", err)
+        }
+        // The server retries until it gets a 2xx, so acknowledge even when
+        // the desktop could not show the notification.
+        w.WriteHeader(http.StatusNoContent)
+    })
+    
+    fmt.Printf("Listening for reminders on %s\n", addr)
+    if err := http.ListenAndServe(addr, handler); err != nil {
+        fmt.Println("Error:", err)
+    }
+}
+
+// desktopNotify shows a notification with notify-send on Linux and
+// osascript on macOS. Elsewhere the message printed by the daemon has to do.
+func desktopNotify(title, message string) error {
+    switch runtime.GOOS {
+    case "linux":
+        if _, err := exec.LookPath("notify-send"); err != nil {
+            return nil
+        }
+        return exec.Command("notify-send", "--app-name=todo", title, message).Run()
+    case "darwin":
+        script := fmt.Sprintf("display notification %s with title %s", strconv.Quote(message), strconv.Quote(title))
+        return exec.Command("osascript", "-e", script).Run()
+    }
+    return nil
+}
+
+// watchTodos prints the changes to todos matching a filter query (or a bare
+// status) as the server streams them, until interrupted.
+func watchTodos(ctx context.Context, query string) {
+    switch query {
+    case "pending", "in_progress", "completed":
+        query = "status:" + query
+    }
+    ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+    defer stop()
     
-    var todos []Todo
-    json.NewDecoder(resp.Body).Decode(&todos)
+    fmt.Println("Watching for changes (Ctrl-C to stop)")
+    err := api.Watch(ctx, client.WatchOptions{Query: query}, printChange)
+    if err != nil && !errors.Is(err, context.Canceled) {
+        fmt.Println("Error:", err)
+    }
+}
+
+func printChange(change client.ChangeEvent) {
+    if change.Type == client.EventReset {
+        fmt.Println("Some changes were missed while disconnected; run list to see the current todos")
+        return
+    }
     
-    for _, todo := range todos {
-        printTodo(&todo)
-        fmt.Println("---")
+    todo := change.Todo
+    line := fmt.Sprintf("%s  %-8s %-36s  %s", time.Now().Format("15:04:05"), strings.TrimPrefix(change.Type, "todo."), todo.ID, todo.Title)
+    if change.Previous != nil {
+        if changed := changedFields(change.Previous, todo); len(changed) > 0 {
+            line += " (" + strings.Join(changed, ", ") + ")"
+        }
     }
+    fmt.Println(line)
 }
 
-func printTodo(todo *Todo) {
+// changedFields describes what an update changed.
+func changedFields(before, after *client.Todo) []string {
+    var changed []string
+    if before.Title != after.Title {
+        changed = append(changed, "title")
+    }
+    if before.Description != after.Description {
+        changed = append(changed, "description")
+    }
+    if before.Status != after.Status {
+        changed = append(changed, fmt.Sprintf("status %s -> %s", before.Status, after.Status))
+    }
+    if before.Priority != after.Priority {
+        changed = append(changed, fmt.Sprintf("priority %s -> %s", before.Priority, after.Priority))
+    }
+    if strings.Join(before.Tags, ",") != strings.Join(after.Tags, ",") {
+        changed = append(changed, "tags")
+    }
+    if !before.DueDate.Equal(after.DueDate) {
+        changed = append(changed, "due date "+formatDueDate(after))
+    }
+    if before.ParentID != after.ParentID {
+        changed = append(changed, "parent")
+    }
+    if strings.Join(before.BlockedBy, ",") != strings.Join(after.BlockedBy, ",") {
+        changed = append(changed, "blockers")
+    }
+    return changed
+}
+
+func listTags(ctx context.Context) {
+    tags, err := api.Tags(ctx)
+    if err != nil {
+        fmt.Println("Error:", err)
+        return
+    }
+    if len(tags) == 0 {
+        fmt.Println("No tags")
+        return
+    }
+    for _, t := range tags {
+        fmt.Printf("%-20s %d\n", t.Tag, t.Count)
+    }
+}
+
+func renameTag(ctx context.Context, from, to string) {
+    printRetagged(api.RenameTag(ctx, from, to))
+}
+
+func mergeTags(ctx context.Context, from []string, into string) {
+    printRetagged(api.MergeTags(ctx, from, into))
+}
+
+func printRetagged(changed int, err error) {
+    if err != nil {
+        fmt.Println("Error:", err)
+        return
+    }
+    fmt.Printf("Updated %d todo(s)\n", changed)
+}
+
+func printTodo(todo *client.Todo) {
     fmt.Printf("ID: %s\n", todo.ID)
     fmt.Printf("Title: %s\n", todo.Title)
     fmt.Printf("Description: %s\n", todo.Description)
     fmt.Printf("Status: %s\n", todo.Status)
-    fmt.Printf("Due Date: %s\n", todo.DueDate.Format("2006-01-02"))
+    fmt.Printf("Priority: %s\n", todo.Priority)
+    if len(todo.Tags) > 0 {
+        fmt.Printf("Tags: %s\n", strings.Join(todo.Tags, ", "))
+    }
+    if todo.ParentID != "" {
+        fmt.Printf("Parent: %s\n", todo.ParentID)
+    }
+    if len(todo.BlockedBy) > 0 {
+        fmt.Printf("Blocked By: %s\n", strings.Join(todo.BlockedBy, ", "))
+    }
+    if todo.Progress != nil {
+        fmt.Printf("Subtasks: %d of %d done", todo.Progress.Done, todo.Progress.Total)
+        if todo.AutoComplete {
+            fmt.Print(" (completes automatically)")
+        }
+        fmt.Println()
+    }
+    if todo.Recurrence != nil {
+        fmt.Printf("Repeats: %s", todo.Recurrence.Rule)
+        if todo.Recurrence.TimeZone != "" {
+            fmt.Printf(" (%s)", todo.Recurrence.TimeZone)
+        }
+        fmt.Println()
+        if todo.Recurrence.NextID != "" {
+            fmt.Printf("Next Occurrence: %s\n", todo.Recurrence.NextID)
+        }
+    }
+    fmt.Printf("Due Date: %s\n", formatDueDate(todo))
+    if len(todo.Reminders) > 0 {
+        fmt.Printf("Reminders: %s before\n", strings.Join(todo.Reminders, ", "))
+    }
     fmt.Printf("Created At: %s\n", todo.CreatedAt.Format("2006-01-02 15:04:05"))
+    fmt.Printf("Version: %d\n", todo.Version)
+}
+
+// formatDueDate shows a due date in the time zone of the todo's recurrence,
+// with the time of day unless it is midnight.
+func formatDueDate(todo *client.Todo) string {
+    due := todo.DueDate
+    if todo.Recurrence != nil {
+        if loc, err := time.LoadLocation(todo.Recurrence.TimeZone); err == nil {
+            due = due.In(loc)
+        }
+    }
+    if due.Hour() == 0 && due.Minute() == 0 {
+        return due.Format("2006-01-02")
+    }
+    return due.Format("2006-01-02 15:04 MST")
 }
\ No newline at end of file
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"todo-app/internal/hlc"
+	"todo-app/internal/models"
+	"todo-app/internal/storage"
+	"todo-app/pkg/client"
+)
+
+// syncLocal syncs the local todos with a server: it pushes the journaled
+// changes, then pulls everything that changed on the server since the last
+// sync, which includes the pushed changes as the server merged them. remote
+// is the server's URL, or empty for the one synced with last.
+func syncLocal(ctx context.Context, local *localStore, remote string) {
+	j := local.journal
+	if remote == "" {
+		remote = j.Remote
+	}
+	remote = strings.TrimSuffix(strings.TrimSuffix(remote, "/"), "/api/v1")
+	if remote == "" {
+		fmt.Println("Please provide the server to sync with, e.g. sync --remote http://localhost:8080")
+		return
+	}
+	if remote != j.Remote {
+		// Tokens only mean something to the server that issued them.
+		j.Remote, j.Token = remote, ""
+	}
+	server := client.New(remote)
+
+	pushed, err := pushJournal(ctx, server, j)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	pulled, err := pullChanges(ctx, server, local)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	if err := settle(ctx, local); err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	fmt.Printf("Pushed %d change(s), pulled %d change(s)\n", pushed, pulled)
+}
+
+// pushJournal sends the journaled changes to the server, dropping them from
+// the journal as the server answers for them. Changes the server rejects are
+// reported and dropped too: sending them again would not change its mind.
+func pushJournal(ctx context.Context, server *client.Client, j *journal) (int, error) {
+	pushed := 0
+	for len(j.Changes) > 0 {
+		batch := j.Changes[:min(len(j.Changes), client.MaxPush)]
+		changes := make([]client.ClientChange, len(batch))
+		for i, entry := range batch {
+			changes[i] = entry.clientChange()
+		}
+		results, err := server.PushChanges(ctx, changes)
+		if err != nil {
+			return pushed, err
+		}
+
+		for _, r := range results {
+			if r.Error != nil {
+				fmt.Printf("Change to %s was rejected: %v\n", r.ID, r.Error)
+			}
+		}
+		j.mu.Lock()
+		j.Changes = j.Changes[len(batch):]
+		j.mu.Unlock()
+		pushed += len(batch)
+	}
+	return pushed, nil
+}
+
+// clientChange is the entry as POST /sync takes it.
+func (e journalEntry) clientChange() client.ClientChange {
+	change := client.ClientChange{Op: e.Op, ID: e.ID, Clock: e.Clock.String(), Subtasks: e.Subtasks}
+	if e.Fields != nil {
+		change.Fields = client.Patch{}
+		for field, value := range e.Fields {
+			change.Fields[field] = value
+		}
+	}
+	return change
+}
+
+// pullChanges stores the server's changes since the journal's token in the
+// local todos, replacing their local copies. It runs after the push, when
+// nothing local is waiting to be merged, so the server's copy is the merged
+// one. Pulled changes are not journaled, as they bypass the service.
+func pullChanges(ctx context.Context, server *client.Client, local *localStore) (int, error) {
+	j := local.journal
+	pulled := 0
+	it := server.Changes(ctx, j.Token)
+	for it.Next() {
+		c := it.Value()
+		if err := local.apply(ctx, c); err != nil {
+			return pulled, fmt.Errorf("storing %s: %w", c.ID, err)
+		}
+		pulled++
+	}
+	// The changes up to the cursor are stored even if a page failed.
+	j.mu.Lock()
+	j.Token = it.Cursor()
+	j.mu.Unlock()
+	return pulled, it.Err()
+}
+
+// apply saves a change pulled from the server.
+func (l *localStore) apply(ctx context.Context, c client.Change) error {
+	switch {
+	case c.Op == client.OpDelete:
+		err := l.todos.Delete(ctx, c.ID)
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil
+		}
+		return err
+	case c.Op == client.OpUpsert && c.Todo != nil:
+		todo, err := storedTodo(c)
+		if err != nil {
+			return err
+		}
+		current, err := l.todos.GetByID(ctx, c.ID)
+		if errors.Is(err, storage.ErrNotFound) {
+			return l.todos.Create(ctx, todo)
+		}
+		if err != nil {
+			return err
+		}
+		// The local version counts local saves.
+		todo.Version = current.Version
+		return l.todos.Update(ctx, todo)
+	}
+	return fmt.Errorf("unknown change %q", c.Op)
+}
+
+// storedTodo converts the todo of a pulled change to the form storage keeps,
+// with the clocks of its fields.
+func storedTodo(c client.Change) (*models.Todo, error) {
+	data, err := json.Marshal(c.Todo)
+	if err != nil {
+		return nil, err
+	}
+	var todo models.Todo
+	if err := json.Unmarshal(data, &todo); err != nil {
+		return nil, err
+	}
+	todo.Clocks = make(map[string]hlc.Timestamp, len(c.Clocks))
+	for field, clock := range c.Clocks {
+		ts, err := hlc.Parse(clock)
+		if err != nil {
+			return nil, fmt.Errorf("clock of %s: %w", field, err)
+		}
+		todo.Clocks[field] = ts
+	}
+	return &todo, nil
+}
+
+// settle resolves the next occurrences created locally once the server has
+// heard of the todos finished here. If the server created its own, the
+// local one is deleted; if it did not, e.g. because it rejected finishing
+// the todo, the local one is journaled like any new todo.
+func settle(ctx context.Context, local *localStore) error {
+	j := local.journal
+	for next, finished := range j.Spawned {
+		todo, err := local.todos.GetByID(ctx, finished)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+		if todo != nil && todo.Recurrence != nil && todo.Recurrence.NextID == next {
+			if occurrence, err := local.todos.GetByID(ctx, next); err == nil {
+				j.mu.Lock()
+				j.add(occurrence, local.service.Clock().Now(), journalFields)
+				j.mu.Unlock()
+			}
+		} else if err := local.todos.Delete(ctx, next); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+		delete(j.Spawned, next)
+	}
+	return nil
+}
@@ -1,63 +1,260 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"log"
 	"net/http"
-	
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+	// Recurrence rules name IANA time zones; embed the database so they
+	// resolve on hosts without one.
+	_ "time/tzdata"
+
 	"github.com/gorilla/mux"
+	"todo-app/internal/collab"
 	"todo-app/internal/handlers"
+	"todo-app/internal/reminder"
 	"todo-app/internal/service"
 	"todo-app/internal/storage"
+	"todo-app/internal/stream"
+	"todo-app/internal/webhook"
+	"todo-app/internal/workflow"
 )
 
 func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run serves until the server is told to stop. Failures are returned rather
+// than fatal so that the deferred storage Close still runs.
+func run() error {
 	// Command line flags
-	storageType := flag.String("storage", "memory", "Storage type: memory or json")
+	storageType := flag.String("storage", "memory", "Storage type: memory, json or sqlite")
 	jsonFile := flag.String("json-file", "todos.json", "JSON file path for json storage")
+	flushInterval := flag.Duration("flush-interval", 10*time.Millisecond, "How long json storage batches writes before flushing them to disk")
+	dbPath := flag.String("db-path", "todos.db", "Database file path for sqlite storage")
 	port := flag.String("port", "8080", "Server port")
+	requestTimeout := flag.Duration("request-timeout", 30*time.Second, "Per-request deadline for API calls (0 disables)")
+	workflowFile := flag.String("workflow", "", "JSON file defining statuses and status actions (default: built-in workflow)")
+	reminderInterval := flag.Duration("reminder-interval", 30*time.Second, "How often to look for todos to remind of (0 disables reminders)")
+	reminderState := flag.String("reminder-state", "", "File recording which reminders were sent (default: reminders.json next to the json or sqlite file)")
+	var reminderWebhooks []string
+	flag.Func("notify-webhook", "URL to POST reminders to, such as the CLI daemon's (repeatable)", func(url string) error {
+		reminderWebhooks = append(reminderWebhooks, url)
+		return nil
+	})
+	smtpAddr := flag.String("smtp-addr", "", "SMTP server (host:port) to mail reminders through")
+	smtpFrom := flag.String("smtp-from", "todo@localhost", "Sender address of reminder mails")
+	smtpTo := flag.String("smtp-to", "", "Comma-separated recipients of reminder mails")
+	webhookState := flag.String("webhook-state", "", "File keeping webhooks and their deliveries (default: webhooks.json next to the json or sqlite file)")
+	webhookAttempts := flag.Int("webhook-attempts", webhook.DefaultRetryPolicy.Attempts, "How often a webhook delivery is tried before it goes to the dead-letter queue")
+	eventHistory := flag.Int("event-history", 1000, "How many recent todo changes the event stream keeps for clients that reconnect")
+	webhookBackoff := flag.Duration("webhook-backoff", webhook.DefaultRetryPolicy.Backoff, "Wait before retrying a failed webhook delivery, doubled after every further failure")
 	flag.Parse()
 
+	// Initialize the status workflow
+	flow, err := workflow.New(workflow.Default())
+	if *workflowFile != "" {
+		flow, err = workflow.Load(*workflowFile)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load workflow: %w", err)
+	}
+	flow.OnAfter(func(ctx context.Context, t workflow.Transition) {
+		if t.Reason != "" {
+			log.Printf("Todo %s: %s (%s -> %s): %s", t.Todo.ID, t.Action, t.From, t.To, t.Reason)
+		} else {
+			log.Printf("Todo %s: %s (%s -> %s)", t.Todo.ID, t.Action, t.From, t.To)
+		}
+	})
+
 	// Initialize storage
 	var store storage.TodoStorage
 
 	switch *storageType {
 	case "json":
-		var err error
-		store, err = storage.NewJSONFileStorage(*jsonFile)
+		jsonStore, err := storage.NewJSONFileStorage(*jsonFile, *flushInterval)
 		if err != nil {
-			log.Fatalf("Failed to create JSON storage: %v", err)
+			return fmt.Errorf("failed to create JSON storage: %w", err)
 		}
+		defer jsonStore.Close()
+		store = jsonStore
 		log.Printf("Using JSON file storage: %s", *jsonFile)
+	case "sqlite":
+		sqliteStore, err := storage.NewSQLiteStorage(*dbPath)
+		if err != nil {
+			return fmt.Errorf("failed to create SQLite storage: %w", err)
+		}
+		defer sqliteStore.Close()
+		store = sqliteStore
+		log.Printf("Using SQLite storage: %s", *dbPath)
 	default:
 		store = storage.NewMemoryStorage()
 		log.Println("Using in-memory storage")
 	}
 
 	// Initialize service and handlers
-	service := service.NewTodoService(store)
+	service := service.NewTodoService(store, flow)
 	handler := handlers.NewTodoHandler(service)
-	
+
+	// stateFile is where a subsystem keeps its state: the path given by its
+	// flag, or name next to the todos. It is empty with memory storage, whose
+	// todos do not outlive the server either.
+	stateFile := func(path, name string) string {
+		switch {
+		case path != "":
+			return path
+		case *storageType == "json":
+			return filepath.Join(filepath.Dir(*jsonFile), name)
+		case *storageType == "sqlite":
+			return filepath.Join(filepath.Dir(*dbPath), name)
+		}
+		return ""
+	}
+
+	// Initialize the reminder scheduler
+	var scheduler *reminder.Scheduler
+	if *reminderInterval > 0 {
+		var stateStore reminder.Store = &reminder.MemoryStore{}
+		if path := stateFile(*reminderState, "reminders.json"); path != "" {
+			stateStore = reminder.FileStore{Path: path}
+		}
+
+		notifiers := []reminder.Notifier{reminder.LogNotifier{}}
+		for _, url := range reminderWebhooks {
+			notifiers = append(notifiers, reminder.WebhookNotifier{URL: url})
+		}
+		if *smtpAddr != "" {
+			if *smtpTo == "" {
+				return errors.New("-smtp-addr needs -smtp-to")
+			}
+			notifiers = append(notifiers, reminder.SMTPNotifier{Addr: *smtpAddr, From: *smtpFrom, To: strings.Split(*smtpTo, ",")})
+		}
+
+		scheduler, err = reminder.New(service, stateStore, *reminderInterval, notifiers...)
+		if err != nil {
+			return fmt.Errorf("failed to start reminders: %w", err)
+		}
+		scheduler.Subscribe(service.Events())
+	}
+
+	// Initialize webhooks
+	var webhookStore webhook.Store = &webhook.MemoryStore{}
+	if path := stateFile(*webhookState, "webhooks.json"); path != "" {
+		webhookStore = webhook.FileStore{Path: path}
+	}
+	dispatcher, err := webhook.New(webhookStore, webhook.RetryPolicy{Attempts: *webhookAttempts, Backoff: *webhookBackoff})
+	if err != nil {
+		return fmt.Errorf("failed to start webhooks: %w", err)
+	}
+	dispatcher.Subscribe(service.Events(), flow)
+	webhookHandler := handlers.NewWebhookHandler(dispatcher)
+
+	// Initialize the change stream
+	changes := stream.New(*eventHistory)
+	changes.Subscribe(service.Events())
+	streamHandler := handlers.NewStreamHandler(changes)
+
+	// Initialize the collaboration hub
+	hub := collab.NewHub()
+	collabHandler := handlers.NewCollabHandler(service, hub, changes)
+	syncHandler := handlers.NewSyncHandler(service)
+
 	// Create router
 	router := mux.NewRouter()
-	
+
+	// Event streams and sockets stay open indefinitely, so they are routed
+	// ahead of the API routes and their request timeout.
+	router.HandleFunc("/api/v1/todos/events", streamHandler.StreamEvents).Methods("GET")
+	router.HandleFunc("/api/v1/ws", collabHandler.Connect).Methods("GET")
+
 	// API routes
 	api := router.PathPrefix("/api/v1").Subrouter()
-	api.HandleFunc("/todos", handler.CreateTodo).Methods("POST")
-	api.HandleFunc("/todos", handler.GetAllTodos).Methods("GET")
-	api.HandleFunc("/todos/filter", handler.FilterTodos).Methods("GET")
-	api.HandleFunc("/todos/{id}", handler.GetTodo).Methods("GET")
-	api.HandleFunc("/todos/{id}", handler.UpdateTodo).Methods("PUT")
-	api.HandleFunc("/todos/{id}", handler.DeleteTodo).Methods("DELETE")
+	for _, r := range []*mux.Router{router, api} {
+		r.NotFoundHandler = http.HandlerFunc(handlers.NotFound)
+		r.MethodNotAllowedHandler = http.HandlerFunc(handlers.MethodNotAllowed)
+	}
+	api.Use(handlers.Timeout(*requestTimeout))
+	handlers.Routes(api, handler, syncHandler)
+	api.HandleFunc("/webhooks", webhookHandler.ListWebhooks).Methods("GET")
+	api.HandleFunc("/webhooks", webhookHandler.CreateWebhook).Methods("POST")
+	api.HandleFunc("/webhooks/dead-letters", webhookHandler.ListDeadLetters).Methods("GET")
+	api.HandleFunc("/webhooks/dead-letters/{delivery}", webhookHandler.DiscardDeadLetter).Methods("DELETE")
+	api.HandleFunc("/webhooks/dead-letters/{delivery}/retry", webhookHandler.RetryDeadLetter).Methods("POST")
+	api.HandleFunc("/webhooks/{id}", webhookHandler.GetWebhook).Methods("GET")
+	api.HandleFunc("/webhooks/{id}", webhookHandler.UpdateWebhook).Methods("PATCH")
+	api.HandleFunc("/webhooks/{id}", webhookHandler.DeleteWebhook).Methods("DELETE")
+	api.HandleFunc("/webhooks/{id}/deliveries", webhookHandler.ListDeliveries).Methods("GET")
+	if scheduler != nil {
+		api.HandleFunc("/reminders", handlers.NewReminderHandler(scheduler).GetUpcoming).Methods("GET")
+	}
 
 	// Health check
 	api.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
 	}).Methods("GET")
-	
+
 	// Start server
 	addr := ":" + *port
-	log.Printf("Server starting on %s", addr)
-	log.Fatal(http.ListenAndServe(addr, router))
-}
\ No newline at end of file
+	server := &http.Server{Addr: addr, Handler: router}
+	// Shutdown waits for open connections, so end the event streams; it
+	// does not wait for sockets, which are told the server is going away.
+	server.RegisterOnShutdown(changes.Close)
+	server.RegisterOnShutdown(hub.Close)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serving := make(chan error, 1)
+	go func() {
+		log.Printf("Server starting on %s", addr)
+		serving <- server.ListenAndServe()
+	}()
+
+	schedulerDone := make(chan struct{})
+	go func() {
+		defer close(schedulerDone)
+		if scheduler != nil {
+			scheduler.Run(ctx)
+		}
+	}()
+	dispatcherDone := make(chan struct{})
+	go func() {
+		defer close(dispatcherDone)
+		dispatcher.Run(ctx)
+	}()
+
+	// Wait for a signal, or for the server to fail, then drain in-flight
+	// requests so the deferred storage Close can flush everything they wrote.
+	var serveErr error
+	select {
+	case <-ctx.Done():
+	case serveErr = <-serving:
+		stop()
+	}
+	log.Println("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Shutdown: %v", err)
+	}
+	// Let the asynchronous subscribers finish the events of those requests.
+	service.Events().Close()
+	<-schedulerDone
+	<-dispatcherDone
+	// Save the deliveries queued after the dispatcher stopped.
+	if err := dispatcher.Flush(); err != nil {
+		log.Printf("Webhooks: %v", err)
+	}
+	return serveErr
+}
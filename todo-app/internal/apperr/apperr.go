@@ -0,0 +1,83 @@
+// Package apperr is the error model shared by the storage, service and
+// handler layers. Errors carry a Kind, which decides how a failure is
+// reported (e.g. as an HTTP status), and a stable machine-readable code
+// that clients can rely on across releases.
+package apperr
+
+import (
+	"context"
+	"errors"
+)
+
+// Kind classifies an error by what the caller can do about it.
+type Kind string
+
+const (
+	// Internal is an unexpected failure; the request may be retried.
+	Internal Kind = "internal"
+	// NotFound means the requested todo (or other resource) does not exist.
+	NotFound Kind = "not_found"
+	// Conflict means the request clashes with the current state.
+	Conflict Kind = "conflict"
+	// Invalid means the request itself is malformed.
+	Invalid Kind = "invalid"
+	// Validation means a well-formed request would break a domain rule.
+	Validation Kind = "validation"
+	// Precondition means a caller-supplied precondition does not hold.
+	Precondition Kind = "precondition"
+	// Unavailable means the backing store cannot serve requests.
+	Unavailable Kind = "unavailable"
+	// Timeout means the request ran out of time.
+	Timeout Kind = "timeout"
+	// Canceled means the caller gave up on the request.
+	Canceled Kind = "canceled"
+)
+
+// Typed is implemented by errors that know their kind and code. Packages
+// with richer error types, such as validation.Errors, implement it directly.
+type Typed interface {
+	error
+	ErrorKind() Kind
+	ErrorCode() string
+}
+
+// Error is a Typed error with a fixed message, used for sentinel errors:
+//
+//	var ErrNotFound = apperr.New(apperr.NotFound, "todo_not_found", "todo not found")
+//
+// Sentinels may be wrapped with fmt.Errorf("%w: ...") to add detail; errors.Is
+// and KindOf still see them.
+type Error struct {
+	Kind    Kind
+	Code    string
+	Message string
+}
+
+func New(kind Kind, code, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+func (e *Error) Error() string     { return e.Message }
+func (e *Error) ErrorKind() Kind   { return e.Kind }
+func (e *Error) ErrorCode() string { return e.Code }
+
+// KindOf returns the kind of the first Typed error in err's chain. Context
+// errors are Timeout or Canceled and anything else is Internal.
+func KindOf(err error) Kind {
+	kind, _ := Classify(err)
+	return kind
+}
+
+// Classify returns the kind and code of err, as for KindOf.
+func Classify(err error) (Kind, string) {
+	var typed Typed
+	switch {
+	case errors.As(err, &typed):
+		return typed.ErrorKind(), typed.ErrorCode()
+	case errors.Is(err, context.DeadlineExceeded):
+		return Timeout, "timeout"
+	case errors.Is(err, context.Canceled):
+		return Canceled, "canceled"
+	}
+	return Internal, "internal"
+}
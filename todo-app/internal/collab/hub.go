@@ -0,0 +1,254 @@
+// Package collab keeps track of the clients of the collaborative board: who
+// is connected, which todo sets each has subscribed to, and which todos each
+// is viewing or editing. The hub tells every client when others join, leave
+// or change their presence; changes to todos reach clients through the
+// change stream, filtered by their subscriptions.
+package collab
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/google/uuid"
+	"todo-app/internal/filter"
+	"todo-app/internal/stream"
+)
+
+// Presence states.
+const (
+	Viewing = "viewing"
+	Editing = "editing"
+)
+
+// ErrInvalidPresence is returned for a presence state other than Viewing,
+// Editing or "".
+var ErrInvalidPresence = errors.New(`presence state must be "viewing", "editing" or ""`)
+
+// outBuffer is how many messages a client may fall behind by before it is
+// disconnected.
+const outBuffer = 256
+
+// Hub is the set of connected clients. The zero value is not usable; create
+// one with NewHub.
+type Hub struct {
+	mu      sync.Mutex
+	clients map[*Client]bool
+	closed  bool
+}
+
+func NewHub() *Hub {
+	return &Hub{clients: map[*Client]bool{}}
+}
+
+// Client is a connected client. Messages for it are queued with Send and
+// written by its connection from Out.
+type Client struct {
+	ID   string
+	Name string
+
+	hub  *Hub
+	out  chan interface{}
+	done chan struct{}
+	once sync.Once
+
+	mu            sync.Mutex
+	subscriptions map[string]filter.Expr
+	presence      map[string]string // todo ID -> state, guarded by hub.mu
+}
+
+// Peer describes a connected client to the others.
+type Peer struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Presence maps the IDs of the todos the client is viewing or editing
+	// to the state.
+	Presence map[string]string `json:"presence,omitempty"`
+}
+
+// Messages the hub sends to clients.
+type (
+	// Joined tells the clients that another one connected.
+	Joined struct {
+		Type   string `json:"type"` // "joined"
+		Client Peer   `json:"client"`
+	}
+	// Left tells the clients that another one disconnected, ending its
+	// presence on every todo.
+	Left struct {
+		Type   string `json:"type"` // "left"
+		Client Peer   `json:"client"`
+	}
+	// PresenceChanged tells the clients that another one started or
+	// stopped (State "") viewing or editing a todo.
+	PresenceChanged struct {
+		Type   string `json:"type"` // "presence"
+		Client Peer   `json:"client"`
+		TodoID string `json:"todo_id"`
+		State  string `json:"state"`
+	}
+)
+
+// Join connects a client with the given display name, telling the others,
+// and returns it with the clients already connected. The client is
+// disconnected at once if the hub is closed.
+func (h *Hub) Join(name string) (*Client, []Peer) {
+	c := &Client{
+		ID:            uuid.New().String(),
+		Name:          name,
+		hub:           h,
+		out:           make(chan interface{}, outBuffer),
+		done:          make(chan struct{}),
+		subscriptions: map[string]filter.Expr{},
+		presence:      map[string]string{},
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		c.disconnect()
+		return c, nil
+	}
+	peers := make([]Peer, 0, len(h.clients))
+	for other := range h.clients {
+		peers = append(peers, other.peer(true))
+		other.Send(Joined{Type: "joined", Client: c.peer(false)})
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].Name+peers[i].ID < peers[j].Name+peers[j].ID })
+	h.clients[c] = true
+	return c, peers
+}
+
+// Leave disconnects a client, telling the others.
+func (h *Hub) Leave(c *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	c.disconnect()
+	if !h.clients[c] {
+		return
+	}
+	delete(h.clients, c)
+	for other := range h.clients {
+		other.Send(Left{Type: "left", Client: c.peer(false)})
+	}
+}
+
+// SetPresence records that a client is viewing or editing a todo, or with
+// state "" no longer is, and tells the other clients.
+func (h *Hub) SetPresence(c *Client, todoID, state string) error {
+	if state != Viewing && state != Editing && state != "" {
+		return ErrInvalidPresence
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if c.presence[todoID] == state {
+		return nil
+	}
+	if state == "" {
+		delete(c.presence, todoID)
+	} else {
+		c.presence[todoID] = state
+	}
+	for other := range h.clients {
+		if other != c {
+			other.Send(PresenceChanged{Type: "presence", Client: c.peer(false), TodoID: todoID, State: state})
+		}
+	}
+	return nil
+}
+
+// Close disconnects every client, e.g. when the server shuts down.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for c := range h.clients {
+		c.disconnect()
+	}
+}
+
+// peer describes c, with its presence if withPresence. The hub must be
+// locked.
+func (c *Client) peer(withPresence bool) Peer {
+	p := Peer{ID: c.ID, Name: c.Name}
+	if withPresence && len(c.presence) > 0 {
+		p.Presence = make(map[string]string, len(c.presence))
+		for id, state := range c.presence {
+			p.Presence[id] = state
+		}
+	}
+	return p
+}
+
+// Send queues a message for the client without waiting. A client too far
+// behind to take it is disconnected, as it has missed messages; it can
+// reconnect and subscribe again.
+func (c *Client) Send(msg interface{}) {
+	select {
+	case <-c.done:
+	case c.out <- msg:
+	default:
+		c.disconnect()
+	}
+}
+
+// Out delivers the messages queued for the client.
+func (c *Client) Out() <-chan interface{} {
+	return c.out
+}
+
+// Done is closed when the client is disconnected by the hub: it fell behind,
+// or the hub was closed.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *Client) disconnect() {
+	c.once.Do(func() { close(c.done) })
+}
+
+// Subscribe adds or replaces the client's subscription called name to the
+// todos matching expr.
+func (c *Client) Subscribe(name string, expr filter.Expr) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.subscriptions[name] = expr
+}
+
+// Unsubscribe removes a subscription, reporting whether it existed.
+func (c *Client) Unsubscribe(name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.subscriptions[name]
+	delete(c.subscriptions, name)
+	return ok
+}
+
+// Subscriptions returns the names of the client's subscriptions that a
+// change concerns, sorted.
+func (c *Client) Subscriptions(change *stream.Change) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var names []string
+	for name, expr := range c.subscriptions {
+		if change.Matches(expr) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Wants reports whether any of the client's subscriptions concern a change.
+// It suits stream.Watch.
+func (c *Client) Wants(change *stream.Change) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, expr := range c.subscriptions {
+		if change.Matches(expr) {
+			return true
+		}
+	}
+	return false
+}
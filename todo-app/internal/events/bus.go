@@ -0,0 +1,221 @@
+package events
+
+import (
+	"context"
+	"hash/fnv"
+	"log"
+	"sync"
+	"sync/atomic"
+)
+
+// Handler receives events.
+type Handler func(ctx context.Context, e Event)
+
+// Overflow says what Publish does when an asynchronous subscriber's queue is
+// full.
+type Overflow int
+
+const (
+	// Block makes the publisher wait for room, slowing changes down to the
+	// subscriber's pace. If the publisher's context ends first, the event is
+	// dropped after all.
+	Block Overflow = iota
+	// Drop discards the event, for subscribers that would rather miss
+	// events than slow down changes.
+	Drop
+)
+
+// AsyncOptions configure an asynchronous subscriber. Zero values get the
+// defaults.
+type AsyncOptions struct {
+	// Workers is how many goroutines handle events (default 4). Events of
+	// one todo always go to the same worker.
+	Workers int
+	// Buffer is how many events each worker's queue holds (default 256).
+	Buffer int
+	// Overflow is what happens when a queue is full (default Block).
+	Overflow Overflow
+}
+
+// Bus delivers published events to its subscribers. The zero value is not
+// usable; create one with NewBus.
+type Bus struct {
+	mu   sync.RWMutex
+	subs []*Subscription
+}
+
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscription is a registered subscriber.
+type Subscription struct {
+	bus     *Bus
+	name    string
+	handler Handler
+
+	// Asynchronous subscribers only.
+	overflow Overflow
+	queues   []chan queued
+	wg       sync.WaitGroup
+	mu       sync.RWMutex // guards closed against sends on closed queues
+	closed   bool
+	dropped  atomic.Uint64
+}
+
+type queued struct {
+	ctx context.Context
+	e   Event
+}
+
+// Subscribe registers a synchronous subscriber: Publish calls it directly,
+// in the publisher's goroutine and context, so it sees every change before
+// the change's caller does. It must be quick, and must not change todos
+// itself, as the todo it is told about stays locked until it returns. name
+// identifies the subscriber in logs.
+func (b *Bus) Subscribe(name string, handler Handler) *Subscription {
+	s := &Subscription{bus: b, name: name, handler: handler}
+	b.add(s)
+	return s
+}
+
+// SubscribeAsync registers an asynchronous subscriber, which handles events
+// on its own goroutines. Its context carries the publisher's values but not
+// its cancellation, as the event usually outlives the request that caused
+// it.
+func (b *Bus) SubscribeAsync(name string, handler Handler, opts AsyncOptions) *Subscription {
+	if opts.Workers <= 0 {
+		opts.Workers = 4
+	}
+	if opts.Buffer <= 0 {
+		opts.Buffer = 256
+	}
+	s := &Subscription{bus: b, name: name, handler: handler, overflow: opts.Overflow}
+	s.queues = make([]chan queued, opts.Workers)
+	for i := range s.queues {
+		s.queues[i] = make(chan queued, opts.Buffer)
+		s.wg.Add(1)
+		go s.work(s.queues[i])
+	}
+	b.add(s)
+	return s
+}
+
+func (b *Bus) add(s *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subs = append(b.subs, s)
+}
+
+// Publish hands an event to every subscriber, in the order they subscribed.
+// It returns once the synchronous subscribers have handled it and the
+// asynchronous ones have queued it (or dropped it).
+//
+// Subscribers see the events of a todo in the order they were published, so
+// a publisher that can change a todo from several goroutines must publish
+// each change before the next one is made.
+func (b *Bus) Publish(ctx context.Context, e Event) {
+	b.mu.RLock()
+	subs := b.subs
+	b.mu.RUnlock()
+	for _, s := range subs {
+		if s.queues == nil {
+			s.handle(ctx, e)
+		} else {
+			s.enqueue(ctx, e)
+		}
+	}
+}
+
+// Close unsubscribes every subscriber, waiting for the asynchronous ones to
+// handle the events already queued.
+func (b *Bus) Close() {
+	b.mu.RLock()
+	subs := b.subs
+	b.mu.RUnlock()
+	for _, s := range subs {
+		s.Close()
+	}
+}
+
+// handle runs the handler, containing its panics so that one faulty
+// subscriber cannot take down the publisher or the other subscribers.
+func (s *Subscription) handle(ctx context.Context, e Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Events: subscriber %s panicked on %s of todo %s: %v", s.name, e.Name(), e.TodoID(), r)
+		}
+	}()
+	s.handler(ctx, e)
+}
+
+func (s *Subscription) enqueue(ctx context.Context, e Event) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(e.TodoID()))
+	queue := s.queues[h.Sum32()%uint32(len(s.queues))]
+	item := queued{ctx: context.WithoutCancel(ctx), e: e}
+
+	select {
+	case queue <- item:
+		return
+	default:
+	}
+	if s.overflow == Block {
+		select {
+		case queue <- item:
+			return
+		case <-ctx.Done():
+		}
+	}
+	if n := s.dropped.Add(1); n == 1 || n%1000 == 0 {
+		log.Printf("Events: subscriber %s cannot keep up; dropped %d event(s) so far", s.name, n)
+	}
+}
+
+func (s *Subscription) work(queue chan queued) {
+	defer s.wg.Done()
+	for item := range queue {
+		s.handle(item.ctx, item.e)
+	}
+}
+
+// Dropped returns how many events an asynchronous subscriber has missed
+// because its queue was full.
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Close unsubscribes. An asynchronous subscriber first handles the events
+// already queued.
+func (s *Subscription) Close() {
+	b := s.bus
+	b.mu.Lock()
+	subs := make([]*Subscription, 0, len(b.subs))
+	for _, other := range b.subs {
+		if other != s {
+			subs = append(subs, other)
+		}
+	}
+	// Publish works on a snapshot, so the slice is replaced, not edited.
+	b.subs = subs
+	b.mu.Unlock()
+
+	if s.queues == nil {
+		return
+	}
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		for _, queue := range s.queues {
+			close(queue)
+		}
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
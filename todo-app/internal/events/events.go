@@ -0,0 +1,80 @@
+// Package events is an in-process publish/subscribe bus for changes to todos.
+// The service publishes an event for every change it saves; features that
+// need to know, such as webhooks and reminders, subscribe instead of being
+// called by the service.
+//
+// Synchronous subscribers run inside Publish, before the change is reported
+// to its caller. Asynchronous ones get the events through bounded queues,
+// served by workers that each own a share of the todos, so every subscriber
+// sees the events of one todo in the order they were published. What happens
+// when a queue is full is up to the subscriber: see Overflow.
+package events
+
+import (
+	"context"
+
+	"todo-app/internal/models"
+)
+
+// Event is a change to a todo. The todos in events are shared by all
+// subscribers and must not be modified.
+type Event interface {
+	// Name identifies the type of event, e.g. "todo.created".
+	Name() string
+	// TodoID is the todo the event is about.
+	TodoID() string
+}
+
+// TodoCreated is published when a todo is created, including the next
+// occurrence of a repeating todo.
+type TodoCreated struct {
+	Todo *models.Todo
+}
+
+func (e TodoCreated) Name() string   { return "todo.created" }
+func (e TodoCreated) TodoID() string { return e.Todo.ID }
+
+// TodoUpdated is published for every saved change to a todo, whatever made
+// it: an edit, a workflow action, a roll-up from its subtasks.
+type TodoUpdated struct {
+	Before *models.Todo
+	After  *models.Todo
+}
+
+func (e TodoUpdated) Name() string   { return "todo.updated" }
+func (e TodoUpdated) TodoID() string { return e.After.ID }
+
+// TodoDeleted is published when a todo is deleted, with the todo as it was.
+type TodoDeleted struct {
+	Todo *models.Todo
+}
+
+func (e TodoDeleted) Name() string   { return "todo.deleted" }
+func (e TodoDeleted) TodoID() string { return e.Todo.ID }
+
+// StatusChanged is published after the TodoUpdated of a change that moved a
+// todo to another status, naming the workflow action that did it.
+type StatusChanged struct {
+	Todo   *models.Todo
+	From   models.Status
+	To     models.Status
+	Action string
+	Reason string
+}
+
+func (e StatusChanged) Name() string   { return "todo.status_changed" }
+func (e StatusChanged) TodoID() string { return e.Todo.ID }
+
+type originKey struct{}
+
+// WithOrigin marks the changes made with ctx as caused by origin, such as a
+// connected client, so that subscribers can tell whose change an event is.
+func WithOrigin(ctx context.Context, origin string) context.Context {
+	return context.WithValue(ctx, originKey{}, origin)
+}
+
+// Origin returns the origin ctx was marked with, or "" if none.
+func Origin(ctx context.Context) string {
+	origin, _ := ctx.Value(originKey{}).(string)
+	return origin
+}
@@ -0,0 +1,197 @@
+// Package filter implements the todo filter language, e.g.
+//
+//	status:pending AND due<2026-11-01
+//	(title:report OR text:invoice) AND NOT status:completed
+//
+// A query is parsed into an expression tree that storage backends evaluate
+// in memory (Match) or translate to their own query language.
+package filter
+
+import (
+	"strings"
+	"time"
+
+	"todo-app/internal/models"
+)
+
+// Field is a filterable todo attribute.
+type Field string
+
+const (
+	FieldStatus      Field = "status"
+	FieldTitle       Field = "title"
+	FieldDescription Field = "description"
+	// FieldText matches title or description.
+	FieldText    Field = "text"
+	FieldDue     Field = "due"
+	FieldCreated Field = "created"
+	FieldUpdated Field = "updated"
+	// FieldTag matches one of the todo's tags.
+	FieldTag      Field = "tag"
+	FieldPriority Field = "priority"
+	// FieldParent matches the ID of the todo's parent; an empty Value
+	// matches top-level todos.
+	FieldParent Field = "parent"
+	// FieldBlockedBy matches todos waiting for the todo with the given ID.
+	FieldBlockedBy Field = "blocked_by"
+)
+
+// IsTime reports whether f compares instants rather than text.
+func (f Field) IsTime() bool {
+	return f == FieldDue || f == FieldCreated || f == FieldUpdated
+}
+
+// Op is a comparison operator.
+type Op string
+
+const (
+	OpContains Op = ":" // text fields only: case-insensitive substring
+	OpEq       Op = "="
+	OpNe       Op = "!="
+	OpLt       Op = "<"
+	OpLe       Op = "<="
+	OpGt       Op = ">"
+	OpGe       Op = ">="
+)
+
+// Expr is a node of a parsed filter.
+type Expr interface {
+	expr()
+}
+
+type And struct{ Left, Right Expr }
+type Or struct{ Left, Right Expr }
+type Not struct{ Expr Expr }
+
+// Compare tests one field. After parsing, time fields carry Time and use only
+// OpEq/OpNe/OpLt/OpLe/OpGt/OpGe; a zero Time with OpEq or OpNe tests for an
+// unset value, and the ordering operators never match an unset value.
+// Status, tag, parent and blocked_by use only OpEq/OpNe, where a tag or
+// blocker is equal if the todo has it; text fields use OpContains/OpEq/OpNe. Priority carries Priority and
+// uses every operator but OpContains.
+type Compare struct {
+	Field    Field
+	Op       Op
+	Value    string
+	Time     time.Time
+	Priority models.Priority
+}
+
+func (And) expr()     {}
+func (Or) expr()      {}
+func (Not) expr()     {}
+func (Compare) expr() {}
+
+// Match evaluates e against todo. A nil expression matches everything.
+func Match(e Expr, todo *models.Todo) bool {
+	switch e := e.(type) {
+	case nil:
+		return true
+	case And:
+		return Match(e.Left, todo) && Match(e.Right, todo)
+	case Or:
+		return Match(e.Left, todo) || Match(e.Right, todo)
+	case Not:
+		return !Match(e.Expr, todo)
+	case Compare:
+		return e.match(todo)
+	}
+	return false
+}
+
+func (c Compare) match(todo *models.Todo) bool {
+	switch c.Field {
+	case FieldStatus:
+		return compareText(string(todo.Status), c.Op, c.Value)
+	case FieldTitle:
+		return compareText(todo.Title, c.Op, c.Value)
+	case FieldDescription:
+		return compareText(todo.Description, c.Op, c.Value)
+	case FieldText:
+		if c.Op == OpNe {
+			return compareText(todo.Title, c.Op, c.Value) && compareText(todo.Description, c.Op, c.Value)
+		}
+		return compareText(todo.Title, c.Op, c.Value) || compareText(todo.Description, c.Op, c.Value)
+	case FieldDue:
+		return compareTime(todo.DueDate, c.Op, c.Time)
+	case FieldCreated:
+		return compareTime(todo.CreatedAt, c.Op, c.Time)
+	case FieldUpdated:
+		return compareTime(todo.UpdatedAt, c.Op, c.Time)
+	case FieldParent:
+		return compareText(todo.ParentID, c.Op, c.Value)
+	case FieldBlockedBy:
+		if c.Op == OpNe {
+			return !todo.IsBlockedBy(c.Value)
+		}
+		return todo.IsBlockedBy(c.Value)
+	case FieldTag:
+		if c.Op == OpNe {
+			return !todo.HasTag(c.Value)
+		}
+		return todo.HasTag(c.Value)
+	case FieldPriority:
+		return compareOrdered(int(todo.Priority), c.Op, int(c.Priority))
+	}
+	return false
+}
+
+func compareOrdered(have int, op Op, want int) bool {
+	switch op {
+	case OpEq:
+		return have == want
+	case OpNe:
+		return have != want
+	case OpLt:
+		return have < want
+	case OpLe:
+		return have <= want
+	case OpGt:
+		return have > want
+	case OpGe:
+		return have >= want
+	}
+	return false
+}
+
+func compareText(have string, op Op, want string) bool {
+	switch op {
+	case OpContains:
+		return ContainsFold(have, want)
+	case OpEq:
+		return have == want
+	case OpNe:
+		return have != want
+	}
+	return false
+}
+
+// ContainsFold reports whether want is in have, ignoring case. Case is
+// folded for all of Unicode, not just ASCII; the SQLite store calls this too,
+// so that every backend matches the same todos.
+func ContainsFold(have, want string) bool {
+	return strings.Contains(strings.ToLower(have), strings.ToLower(want))
+}
+
+func compareTime(have time.Time, op Op, want time.Time) bool {
+	switch op {
+	case OpEq:
+		return have.Equal(want) || (have.IsZero() && want.IsZero())
+	case OpNe:
+		return !compareTime(have, OpEq, want)
+	}
+	if have.IsZero() {
+		return false
+	}
+	switch op {
+	case OpLt:
+		return have.Before(want)
+	case OpLe:
+		return !have.After(want)
+	case OpGt:
+		return have.After(want)
+	case OpGe:
+		return !have.Before(want)
+	}
+	return false
+}
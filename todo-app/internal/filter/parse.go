@@ -0,0 +1,361 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"todo-app/internal/apperr"
+	"todo-app/internal/models"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ParseError describes a malformed query. Pos is the 1-based byte column the
+// problem was found at.
+type ParseError struct {
+	Pos int
+	Msg string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("invalid query at position %d: %s", e.Pos, e.Msg)
+}
+
+func (e *ParseError) ErrorKind() apperr.Kind { return apperr.Invalid }
+func (e *ParseError) ErrorCode() string      { return "invalid_query" }
+
+// Parse parses a filter query. The grammar is
+//
+//	query   = [or]
+//	or      = and { "OR" and }
+//	and     = not { ["AND"] not }
+//	not     = "NOT" not | primary
+//	primary = "(" or ")" | field op value | value
+//	op      = ":" | "=" | "!=" | "<" | "<=" | ">" | ">="
+//
+// where a bare value searches title and description. Fields are status,
+// title, description, text, tag, priority, parent, blocked_by, due, created
+// and updated.
+// Priorities compare by urgency, so priority>=high matches high and urgent.
+// Dates are YYYY-MM-DD (a whole UTC day) or RFC 3339 timestamps; "none"
+// matches an unset date, and parent:none matches top-level todos.
+// Values containing spaces are written in double quotes. An empty query
+// returns a nil Expr, which matches everything.
+func Parse(query string) (Expr, error) {
+	p := &parser{input: query}
+	if err := p.lex(); err != nil {
+		return nil, err
+	}
+	if p.peek().kind == tokEOF {
+		return nil, nil
+	}
+
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.errorf(t, "unexpected %q", t.text)
+	}
+	return e, nil
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokString
+	tokOp
+	tokLParen
+	tokRParen
+	tokAnd
+	tokOr
+	tokNot
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+type parser struct {
+	input  string
+	tokens []token
+	next   int
+}
+
+func (p *parser) errorf(t token, format string, args ...interface{}) error {
+	return &ParseError{Pos: t.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func isWordRune(r rune) bool {
+	return !unicode.IsSpace(r) && !strings.ContainsRune(`()<>=!:"`, r)
+}
+
+// lex splits the input into tokens. Everything after an operator up to the
+// next space or ')' is one value, so timestamps need no quoting.
+func (p *parser) lex() error {
+	in := p.input
+	i := 0
+	afterOp := false
+	for i < len(in) {
+		c := in[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+			continue
+		case c == '(':
+			p.tokens = append(p.tokens, token{tokLParen, "(", i + 1})
+			i++
+		case c == ')':
+			p.tokens = append(p.tokens, token{tokRParen, ")", i + 1})
+			i++
+		case c == '"':
+			end := strings.IndexByte(in[i+1:], '"')
+			if end < 0 {
+				return &ParseError{Pos: i + 1, Msg: "unterminated string"}
+			}
+			p.tokens = append(p.tokens, token{tokString, in[i+1 : i+1+end], i + 1})
+			i += end + 2
+		case strings.HasPrefix(in[i:], "<=") || strings.HasPrefix(in[i:], ">=") || strings.HasPrefix(in[i:], "!="):
+			p.tokens = append(p.tokens, token{tokOp, in[i : i+2], i + 1})
+			i += 2
+			afterOp = true
+			continue
+		case c == ':' || c == '=' || c == '<' || c == '>':
+			p.tokens = append(p.tokens, token{tokOp, in[i : i+1], i + 1})
+			i++
+			afterOp = true
+			continue
+		case c == '!':
+			return &ParseError{Pos: i + 1, Msg: `unexpected "!"`}
+		default:
+			start := i
+			for i < len(in) {
+				r, size := utf8.DecodeRuneInString(in[i:])
+				if afterOp {
+					if unicode.IsSpace(r) || r == ')' {
+						break
+					}
+				} else if !isWordRune(r) {
+					break
+				}
+				i += size
+			}
+			word := in[start:i]
+			kind := tokWord
+			if !afterOp {
+				switch word {
+				case "AND":
+					kind = tokAnd
+				case "OR":
+					kind = tokOr
+				case "NOT":
+					kind = tokNot
+				}
+			}
+			p.tokens = append(p.tokens, token{kind, word, start + 1})
+		}
+		afterOp = false
+	}
+	p.tokens = append(p.tokens, token{tokEOF, "end of query", len(in) + 1})
+	return nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *parser) take() token {
+	t := p.tokens[p.next]
+	if t.kind != tokEOF {
+		p.next++
+	}
+	return t
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokOr {
+		p.take()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = Or{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch p.peek().kind {
+		case tokAnd:
+			p.take()
+		case tokWord, tokString, tokNot, tokLParen:
+			// Juxtaposition means AND.
+		default:
+			return left, nil
+		}
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = And{Left: left, Right: right}
+	}
+}
+
+func (p *parser) parseNot() (Expr, error) {
+	if p.peek().kind == tokNot {
+		p.take()
+		e, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return Not{Expr: e}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Expr, error) {
+	t := p.take()
+	switch t.kind {
+	case tokLParen:
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.take(); closing.kind != tokRParen {
+			return nil, p.errorf(closing, "expected \")\", found %q", closing.text)
+		}
+		return e, nil
+	case tokString:
+		return Compare{Field: FieldText, Op: OpContains, Value: t.text}, nil
+	case tokWord:
+		if p.peek().kind != tokOp {
+			return Compare{Field: FieldText, Op: OpContains, Value: t.text}, nil
+		}
+		op := p.take()
+		value := p.take()
+		if value.kind != tokWord && value.kind != tokString {
+			return nil, p.errorf(value, "expected a value after %q", t.text+op.text)
+		}
+		return p.compare(t, op, value)
+	}
+	return nil, p.errorf(t, "expected a condition, found %q", t.text)
+}
+
+func (p *parser) compare(fieldTok, opTok, valueTok token) (Expr, error) {
+	field := Field(strings.ToLower(fieldTok.text))
+	op := Op(opTok.text)
+
+	switch field {
+	case FieldStatus:
+		switch op {
+		case OpContains, OpEq:
+			return Compare{Field: field, Op: OpEq, Value: valueTok.text}, nil
+		case OpNe:
+			return Compare{Field: field, Op: OpNe, Value: valueTok.text}, nil
+		}
+	case FieldTitle, FieldDescription, FieldText:
+		switch op {
+		case OpContains, OpEq, OpNe:
+			return Compare{Field: field, Op: op, Value: valueTok.text}, nil
+		}
+	case FieldTag:
+		switch op {
+		case OpContains, OpEq:
+			return Compare{Field: field, Op: OpEq, Value: strings.ToLower(valueTok.text)}, nil
+		case OpNe:
+			return Compare{Field: field, Op: OpNe, Value: strings.ToLower(valueTok.text)}, nil
+		}
+	case FieldParent:
+		parent := valueTok.text
+		if strings.EqualFold(parent, "none") {
+			parent = ""
+		}
+		switch op {
+		case OpContains, OpEq:
+			return Compare{Field: field, Op: OpEq, Value: parent}, nil
+		case OpNe:
+			return Compare{Field: field, Op: OpNe, Value: parent}, nil
+		}
+	case FieldBlockedBy:
+		switch op {
+		case OpContains, OpEq:
+			return Compare{Field: field, Op: OpEq, Value: valueTok.text}, nil
+		case OpNe:
+			return Compare{Field: field, Op: OpNe, Value: valueTok.text}, nil
+		}
+	case FieldPriority:
+		priority, err := models.ParsePriority(strings.ToLower(valueTok.text))
+		if err != nil {
+			return nil, p.errorf(valueTok, "%v", err)
+		}
+		if op == OpContains {
+			op = OpEq
+		}
+		return Compare{Field: field, Op: op, Value: valueTok.text, Priority: priority}, nil
+	case FieldDue, FieldCreated, FieldUpdated:
+		return p.compareTime(field, op, opTok, valueTok)
+	default:
+		return nil, p.errorf(fieldTok, "unknown field %q", fieldTok.text)
+	}
+	return nil, p.errorf(opTok, "operator %q cannot be used with %s", opTok.text, field)
+}
+
+// compareTime normalizes a date comparison to comparisons on instants. A
+// day-only value stands for the whole UTC day, so due:2026-11-01 becomes
+// due>=2026-11-01T00:00Z AND due<2026-11-02T00:00Z.
+func (p *parser) compareTime(field Field, op Op, opTok, valueTok token) (Expr, error) {
+	if strings.EqualFold(valueTok.text, "none") {
+		switch op {
+		case OpContains, OpEq:
+			return Compare{Field: field, Op: OpEq}, nil
+		case OpNe:
+			return Compare{Field: field, Op: OpNe}, nil
+		}
+		return nil, p.errorf(opTok, "operator %q cannot be used with none", opTok.text)
+	}
+
+	if t, err := time.Parse(time.RFC3339, valueTok.text); err == nil {
+		if op == OpContains {
+			op = OpEq
+		}
+		return Compare{Field: field, Op: op, Value: valueTok.text, Time: t}, nil
+	}
+
+	day, err := time.Parse("2006-01-02", valueTok.text)
+	if err != nil {
+		return nil, p.errorf(valueTok, "invalid date %q, want YYYY-MM-DD or RFC 3339", valueTok.text)
+	}
+	next := day.AddDate(0, 0, 1)
+	sameDay := And{
+		Left:  Compare{Field: field, Op: OpGe, Value: valueTok.text, Time: day},
+		Right: Compare{Field: field, Op: OpLt, Value: valueTok.text, Time: next},
+	}
+	switch op {
+	case OpContains, OpEq:
+		return sameDay, nil
+	case OpNe:
+		return Not{Expr: sameDay}, nil
+	case OpLt:
+		return Compare{Field: field, Op: OpLt, Value: valueTok.text, Time: day}, nil
+	case OpLe:
+		return Compare{Field: field, Op: OpLt, Value: valueTok.text, Time: next}, nil
+	case OpGt:
+		return Compare{Field: field, Op: OpGe, Value: valueTok.text, Time: next}, nil
+	case OpGe:
+		return Compare{Field: field, Op: OpGe, Value: valueTok.text, Time: day}, nil
+	}
+	return nil, p.errorf(opTok, "operator %q cannot be used with %s", opTok.text, field)
+}
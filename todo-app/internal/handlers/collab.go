@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+	"todo-app/internal/apperr"
+	"todo-app/internal/collab"
+	"todo-app/internal/events"
+	"todo-app/internal/filter"
+	"todo-app/internal/models"
+	"todo-app/internal/service"
+	"todo-app/internal/storage"
+	"todo-app/internal/stream"
+	"todo-app/pkg/utils"
+)
+
+// errSubscriptionNotFound is returned for an unsubscribe naming no
+// subscription.
+var errSubscriptionNotFound = apperr.New(apperr.NotFound, "subscription_not_found", "subscription not found")
+
+// Timing and limits of collaboration sockets.
+const (
+	writeWait      = 10 * time.Second
+	pongWait       = 60 * time.Second
+	pingPeriod     = pongWait * 9 / 10
+	maxMessageSize = 1 << 20
+	// messageTimeout bounds the work for one message, like the request
+	// timeout of the REST API.
+	messageTimeout = 30 * time.Second
+	maxNameLength  = 100
+)
+
+type CollabHandler struct {
+	service  *service.TodoService
+	hub      *collab.Hub
+	stream   *stream.Stream
+	upgrader websocket.Upgrader
+}
+
+// NewCollabHandler serves the collaboration socket. Browsers may only
+// connect from pages served by the same host.
+func NewCollabHandler(service *service.TodoService, hub *collab.Hub, stream *stream.Stream) *CollabHandler {
+	return &CollabHandler{service: service, hub: hub, stream: stream}
+}
+
+// collabRequest is a message from a client. Which fields are used depends on
+// Type; ID is echoed in the reply so the client can match the two.
+type collabRequest struct {
+	ID           string          `json:"id"`
+	Type         string          `json:"type"`
+	Subscription string          `json:"subscription"`
+	Query        string          `json:"q"`
+	Todo         *createRequest  `json:"todo"`
+	TodoID       string          `json:"todo_id"`
+	Version      int64           `json:"version"`
+	Patch        json.RawMessage `json:"patch"`
+	Subtasks     string          `json:"subtasks"`
+	After        string          `json:"after"`
+	Before       string          `json:"before"`
+	State        string          `json:"state"`
+}
+
+// Messages sent to clients, besides the hub's.
+type (
+	welcome struct {
+		Type    string        `json:"type"` // "welcome"
+		Client  collab.Peer   `json:"client"`
+		Clients []collab.Peer `json:"clients"`
+	}
+	ack struct {
+		Type string       `json:"type"` // "ack"
+		ID   string       `json:"id,omitempty"`
+		Todo *models.Todo `json:"todo,omitempty"`
+	}
+	subscribed struct {
+		Type         string         `json:"type"` // "ack"
+		ID           string         `json:"id,omitempty"`
+		Subscription string         `json:"subscription"`
+		Todos        []*models.Todo `json:"todos"`
+		// More is set if there were more matching todos than fit.
+		More bool `json:"more"`
+	}
+	failure struct {
+		Type  string         `json:"type"` // "error"
+		ID    string         `json:"id,omitempty"`
+		Error *utils.Problem `json:"error"`
+	}
+	changed struct {
+		Type          string         `json:"type"` // "change"
+		Subscriptions []string       `json:"subscriptions"`
+		Change        *stream.Change `json:"change"`
+	}
+)
+
+// Connect handles GET /ws, the collaboration socket. ?name= is the name the
+// client is shown to others by. See the README for the messages.
+func (h *CollabHandler) Connect(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		name = "guest"
+	}
+	if utf8.RuneCountInString(name) > maxNameLength {
+		badRequest(w, r, "name is too long")
+		return
+	}
+
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has answered the request.
+		return
+	}
+	defer conn.Close()
+
+	client, peers := h.hub.Join(name)
+	watcher, _, _ := h.stream.Watch("", client.Wants)
+	defer h.stream.Stop(watcher)
+	defer h.hub.Leave(client)
+	client.Send(welcome{Type: "welcome", Client: collab.Peer{ID: client.ID, Name: client.Name}, Clients: peers})
+
+	go h.write(conn, client, watcher)
+	// The request's context ends with the handler, so messages get their own,
+	// marked with the client as the origin of their changes.
+	ctx := events.WithOrigin(context.Background(), client.ID)
+	h.read(ctx, conn, client, r.URL.Path)
+}
+
+// read handles the client's messages one at a time until the connection
+// fails or is closed.
+func (h *CollabHandler) read(ctx context.Context, conn *websocket.Conn, client *collab.Client, path string) {
+	conn.SetReadLimit(maxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var request collabRequest
+		var reply interface{}
+		if err := json.Unmarshal(data, &request); err != nil {
+			err = errInvalidMessage("Invalid JSON: " + err.Error())
+			reply = failure{Type: "error", Error: problemFor(err, "message", path)}
+		} else {
+			msgCtx, cancel := context.WithTimeout(ctx, messageTimeout)
+			reply, err = h.handle(msgCtx, client, &request)
+			cancel()
+			if err != nil {
+				reply = failure{Type: "error", ID: request.ID, Error: problemFor(err, request.Type, path)}
+			}
+		}
+		client.Send(reply)
+	}
+}
+
+// errInvalidMessage reports a message that is malformed in itself, like
+// badRequest does for requests.
+func errInvalidMessage(detail string) error {
+	return apperr.New(apperr.Invalid, codeInvalidRequest, detail)
+}
+
+// handle carries out one message and returns the reply.
+func (h *CollabHandler) handle(ctx context.Context, client *collab.Client, request *collabRequest) (interface{}, error) {
+	var (
+		todo *models.Todo
+		err  error
+	)
+	switch request.Type {
+	case "subscribe":
+		return h.subscribe(ctx, client, request)
+	case "unsubscribe":
+		if !client.Unsubscribe(request.Subscription) {
+			return nil, errSubscriptionNotFound
+		}
+	case "create":
+		if request.Todo == nil {
+			return nil, errInvalidMessage("todo is required")
+		}
+		todo, err = request.Todo.create(ctx, h.service)
+	case "update":
+		if len(request.Patch) == 0 {
+			return nil, errInvalidMessage("patch is required")
+		}
+		var patch service.TodoPatch
+		if patch, err = decodeMergePatch(bytes.NewReader(request.Patch)); err != nil {
+			if errors.Is(err, service.ErrInvalidPatch) {
+				return nil, err
+			}
+			return nil, errInvalidMessage("Invalid patch document: " + err.Error())
+		}
+		todo, err = h.service.PatchTodo(ctx, request.TodoID, request.Version, patch)
+	case "delete":
+		policy := service.SubtaskPolicy(request.Subtasks)
+		switch policy {
+		case service.SubtasksReject, service.SubtasksCascade, service.SubtasksPromote:
+		default:
+			return nil, errInvalidMessage("subtasks must be cascade or promote")
+		}
+		err = h.service.DeleteTodo(ctx, request.TodoID, policy)
+	case "reorder":
+		todo, err = h.service.MoveTodo(ctx, request.TodoID, request.Version, request.After, request.Before)
+	case "presence":
+		if request.TodoID == "" {
+			return nil, errInvalidMessage("todo_id is required")
+		}
+		err = h.hub.SetPresence(client, request.TodoID, request.State)
+		if errors.Is(err, collab.ErrInvalidPresence) {
+			err = errInvalidMessage(err.Error())
+		}
+	case "ping":
+	default:
+		return nil, errInvalidMessage("unknown message type " + request.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ack{Type: "ack", ID: request.ID, Todo: todo}, nil
+}
+
+// subscribe subscribes the client to the todos matching request.Query and
+// replies with those todos in board order. The subscription starts before
+// they are read, so no change is missed, though one may arrive for a todo
+// already listed in its new state; the version tells which is newer.
+func (h *CollabHandler) subscribe(ctx context.Context, client *collab.Client, request *collabRequest) (interface{}, error) {
+	if request.Subscription == "" {
+		return nil, errInvalidMessage("subscription is required")
+	}
+	expr, err := filter.Parse(request.Query)
+	if err != nil {
+		return nil, err
+	}
+	client.Subscribe(request.Subscription, expr)
+
+	page, err := h.service.ListTodos(ctx, expr, storage.Query{
+		Sort:  []storage.SortField{{Field: storage.SortPosition}},
+		Limit: service.MaxPageSize,
+	})
+	if err != nil {
+		client.Unsubscribe(request.Subscription)
+		return nil, err
+	}
+	return subscribed{
+		Type:         "ack",
+		ID:           request.ID,
+		Subscription: request.Subscription,
+		Todos:        nonNil(page.Todos),
+		More:         page.NextCursor != "",
+	}, nil
+}
+
+// write sends the client's messages and the changes it subscribed to, and
+// keeps the connection alive, until the client is disconnected.
+func (h *CollabHandler) write(conn *websocket.Conn, client *collab.Client, watcher *stream.Watcher) {
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+	// Closing the connection ends read, and so the handler.
+	defer conn.Close()
+
+	send := func(msg interface{}) bool {
+		conn.SetWriteDeadline(time.Now().Add(writeWait))
+		return conn.WriteJSON(msg) == nil
+	}
+	closeWith := func(code int, text string) {
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(writeWait))
+	}
+	for {
+		select {
+		case msg := <-client.Out():
+			if !send(msg) {
+				return
+			}
+		case change, ok := <-watcher.C():
+			if !ok {
+				closeWith(websocket.CloseTryAgainLater, "too far behind")
+				return
+			}
+			if names := client.Subscriptions(change); len(names) > 0 {
+				if !send(changed{Type: "change", Subscriptions: names, Change: change}) {
+					return
+				}
+			}
+		case <-client.Done():
+			closeWith(websocket.CloseGoingAway, "")
+			return
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
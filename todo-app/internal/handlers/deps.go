@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"todo-app/internal/models"
+	"todo-app/internal/schedule"
+)
+
+// GetDependencies handles GET /todos/{id}/dependencies, listing the todos a
+// todo is blocked by and the todos it blocks.
+func (h *TodoHandler) GetDependencies(w http.ResponseWriter, r *http.Request) {
+	deps, err := h.service.Dependencies(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		BlockedBy []*models.Todo `json:"blocked_by"`
+		Blocks    []*models.Todo `json:"blocks"`
+	}{nonNil(deps.BlockedBy), nonNil(deps.Blocks)})
+}
+
+func nonNil(todos []*models.Todo) []*models.Todo {
+	if todos == nil {
+		return []*models.Todo{}
+	}
+	return todos
+}
+
+// AddBlocker handles PUT /todos/{id}/blockers/{blocker}, recording that the
+// todo is blocked by another one. If-Match works as for PUT /todos/{id}.
+func (h *TodoHandler) AddBlocker(w http.ResponseWriter, r *http.Request) {
+	h.changeBlockers(w, r, true)
+}
+
+// RemoveBlocker handles DELETE /todos/{id}/blockers/{blocker}.
+func (h *TodoHandler) RemoveBlocker(w http.ResponseWriter, r *http.Request) {
+	h.changeBlockers(w, r, false)
+}
+
+func (h *TodoHandler) changeBlockers(w http.ResponseWriter, r *http.Request, add bool) {
+	vars := mux.Vars(r)
+	expectedVersion, err := parseIfMatch(r.Header.Get("If-Match"))
+	if err != nil {
+		badRequest(w, r, err.Error())
+		return
+	}
+
+	var todo *models.Todo
+	if add {
+		todo, err = h.service.AddBlocker(r.Context(), vars["id"], expectedVersion, vars["blocker"])
+	} else {
+		todo, err = h.service.RemoveBlocker(r.Context(), vars["id"], expectedVersion, vars["blocker"])
+	}
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(todo))
+	json.NewEncoder(w).Encode(todo)
+}
+
+type planItem struct {
+	*models.Todo
+	// Deadline is when the todo must be done for everything waiting on it
+	// to meet its due date.
+	Deadline *time.Time `json:"deadline,omitempty"`
+}
+
+func planItems(items []schedule.Item) []planItem {
+	out := make([]planItem, len(items))
+	for i, item := range items {
+		out[i] = planItem{Todo: item.Todo}
+		if !item.Deadline.IsZero() {
+			deadline := item.Deadline
+			out[i].Deadline = &deadline
+		}
+	}
+	return out
+}
+
+// GetPlan handles GET /todos/plan: the open todos in an order that respects
+// their dependencies, and the critical path through them.
+func (h *TodoHandler) GetPlan(w http.ResponseWriter, r *http.Request) {
+	plan, err := h.service.Plan(r.Context())
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Order        []planItem `json:"order"`
+		CriticalPath []planItem `json:"critical_path"`
+		Cyclic       []planItem `json:"cyclic,omitempty"`
+	}{planItems(plan.Order), planItems(plan.CriticalPath), planItems(plan.Cyclic)})
+}
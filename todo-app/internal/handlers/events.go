@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"todo-app/internal/filter"
+	"todo-app/internal/stream"
+)
+
+type StreamHandler struct {
+	stream *stream.Stream
+}
+
+func NewStreamHandler(stream *stream.Stream) *StreamHandler {
+	return &StreamHandler{stream: stream}
+}
+
+// heartbeat is how often an idle event stream sends a comment, so that
+// proxies do not time it out and dead clients are noticed.
+const heartbeat = 15 * time.Second
+
+// StreamEvents handles GET /todos/events, streaming todo changes as
+// Server-Sent Events. Each event is named after the change type
+// (todo.created, todo.updated or todo.deleted) and carries the change as
+// JSON. Parameters:
+//
+//   - q: only changes to todos matching this filter (see GetAllTodos); an
+//     update matches if the todo matched before or after it, so a watcher
+//     also sees todos leave its filter. status=<status> is shorthand for
+//     q=status:<status>.
+//   - type: only these change types, e.g. created,deleted.
+//   - Last-Event-ID header (or last_event_id parameter, for clients that
+//     cannot set headers): resume after this change, first sending the
+//     matching changes missed since. If the history no longer reaches back
+//     that far, a "reset" event comes first, telling the client to reload.
+func (h *StreamHandler) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		httpError(w, r, errors.New("streaming unsupported by the response writer"))
+		return
+	}
+
+	params := r.URL.Query()
+	filterQuery := params.Get("q")
+	if filterQuery == "" && params.Get("status") != "" {
+		filterQuery = "status=" + strconv.Quote(params.Get("status"))
+	}
+	expr, err := filter.Parse(filterQuery)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	types, err := parseChangeTypes(params.Get("type"))
+	if err != nil {
+		badRequest(w, r, err.Error())
+		return
+	}
+	match := func(c *stream.Change) bool {
+		if len(types) > 0 && !types[c.Type] {
+			return false
+		}
+		return c.Matches(expr)
+	}
+
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = params.Get("last_event_id")
+	}
+	watcher, missed, complete := h.stream.Watch(lastID, match)
+	defer h.stream.Stop(watcher)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Keep reverse proxies such as nginx from buffering the stream.
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 2000\n\n")
+	if !complete {
+		fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+	}
+	for _, c := range missed {
+		writeChange(w, c)
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case c, ok := <-watcher.C():
+			if !ok {
+				// Fallen behind or shutting down; the client reconnects
+				// and resumes from the last change it got.
+				return
+			}
+			writeChange(w, c)
+			flusher.Flush()
+		case <-ticker.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+func writeChange(w http.ResponseWriter, c *stream.Change) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", c.ID, c.Type, data)
+}
+
+// parseChangeTypes parses a comma-separated list of change types, with or
+// without their "todo." prefix.
+func parseChangeTypes(list string) (map[string]bool, error) {
+	types := map[string]bool{}
+	for _, t := range strings.Split(list, ",") {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		if !strings.HasPrefix(t, "todo.") {
+			t = "todo." + t
+		}
+		switch t {
+		case stream.Created, stream.Updated, stream.Deleted:
+			types[t] = true
+		default:
+			return nil, fmt.Errorf("type must list created, updated or deleted")
+		}
+	}
+	return types, nil
+}
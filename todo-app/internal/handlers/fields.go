@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"todo-app/internal/models"
+)
+
+// todoFields is the set of JSON field names a todo can be projected onto.
+var todoFields = func() map[string]bool {
+	fields := make(map[string]bool)
+	t := reflect.TypeOf(models.Todo{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields[name] = true
+		}
+	}
+	return fields
+}()
+
+// parseFields parses a sparse fieldset such as "id,title,status". An empty
+// spec selects every field and returns nil.
+func parseFields(spec string) ([]string, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	var fields []string
+	for _, f := range strings.Split(spec, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		if !todoFields[f] {
+			return nil, fmt.Errorf("unknown field %q", f)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// project returns todos reduced to fields, or todos unchanged if fields is
+// nil.
+func project(todos []*models.Todo, fields []string) (interface{}, error) {
+	if fields == nil {
+		return todos, nil
+	}
+	out := make([]map[string]json.RawMessage, len(todos))
+	for i, todo := range todos {
+		data, err := json.Marshal(todo)
+		if err != nil {
+			return nil, err
+		}
+		var all map[string]json.RawMessage
+		if err := json.Unmarshal(data, &all); err != nil {
+			return nil, err
+		}
+		out[i] = make(map[string]json.RawMessage, len(fields))
+		for _, f := range fields {
+			if v, ok := all[f]; ok {
+				out[i][f] = v
+			}
+		}
+	}
+	return out, nil
+}
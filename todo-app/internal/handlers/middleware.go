@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Timeout bounds every request's context by d, so storage work for a slow
+// request is cancelled instead of running on after the deadline. A zero d
+// leaves requests unbounded; they are still cancelled if the client
+// disconnects.
+func Timeout(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if d <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
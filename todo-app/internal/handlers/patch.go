@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"todo-app/internal/apperr"
+	"todo-app/internal/models"
+	"todo-app/internal/service"
+)
+
+const (
+	mergePatchType = "application/merge-patch+json" // RFC 7396
+	jsonPatchType  = "application/json-patch+json"  // RFC 6902
+)
+
+// errPatchTestFailed is returned when a JSON Patch "test" operation does not
+// match the current todo.
+var errPatchTestFailed = apperr.New(apperr.Conflict, "patch_test_failed", "patch test failed")
+
+// PatchTodo handles PATCH /todos/{id} with either a JSON Merge Patch or a JSON
+// Patch document. Unlike PUT, an explicit null (or a JSON Patch "remove")
+// clears a field.
+func (h *TodoHandler) PatchTodo(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	expectedVersion, err := parseIfMatch(r.Header.Get("If-Match"))
+	if err != nil {
+		badRequest(w, r, err.Error())
+		return
+	}
+	ifMatch := expectedVersion != 0
+
+	mediaType := ""
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		if mediaType, _, err = mime.ParseMediaType(ct); err != nil {
+			badRequest(w, r, "Invalid Content-Type")
+			return
+		}
+	}
+
+	var patch service.TodoPatch
+	switch mediaType {
+	case mergePatchType, "application/json", "":
+		patch, err = decodeMergePatch(r.Body)
+	case jsonPatchType:
+		patch, expectedVersion, err = h.decodeJSONPatch(r, id, expectedVersion)
+	default:
+		w.Header().Set("Accept-Patch", mergePatchType+", "+jsonPatchType)
+		writeProblem(w, r, http.StatusUnsupportedMediaType, codeUnsupportedMedia, "Unsupported patch format")
+		return
+	}
+	if err != nil {
+		patchError(w, r, err)
+		return
+	}
+
+	todo, err := h.service.PatchTodo(r.Context(), id, expectedVersion, patch)
+	if err != nil {
+		if !ifMatch && errors.Is(err, service.ErrVersionMismatch) {
+			// The version was pinned by a "test" operation, not If-Match.
+			err = fmt.Errorf("%w: todo changed while the patch was applied", errPatchTestFailed)
+		}
+		patchError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(todo))
+	json.NewEncoder(w).Encode(todo)
+}
+
+func patchError(w http.ResponseWriter, r *http.Request, err error) {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		badRequest(w, r, "Invalid patch document: "+err.Error())
+	default:
+		httpError(w, r, err)
+	}
+}
+
+// decodeMergePatch turns an RFC 7396 merge patch into a field mask: every
+// member present is set, null clears it, absent members stay untouched. An
+// object for recurrence is merged into the todo's recurrence the same way,
+// member by member.
+func decodeMergePatch(body io.Reader) (service.TodoPatch, error) {
+	var patch service.TodoPatch
+	var doc map[string]json.RawMessage
+	if err := json.NewDecoder(body).Decode(&doc); err != nil {
+		return patch, err
+	}
+	if doc == nil {
+		return patch, fmt.Errorf("%w: merge patch must be a JSON object", service.ErrInvalidPatch)
+	}
+
+	for field, raw := range doc {
+		if err := setPatchField(&patch, field, raw); err != nil {
+			return patch, err
+		}
+		if field == service.FieldRecurrence && patch.Values.Recurrence != nil {
+			if err := setRecurrenceMask(&patch, raw); err != nil {
+				return patch, err
+			}
+		}
+	}
+	return patch, nil
+}
+
+// setRecurrenceMask masks the members of a recurrence object, so that the
+// patch merges them into the todo's recurrence rather than replacing it.
+// next_id is set by the service and ignored, as it is when the whole
+// recurrence is replaced.
+func setRecurrenceMask(patch *service.TodoPatch, raw json.RawMessage) error {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &members); err != nil {
+		return fmt.Errorf("%w: %s: %v", service.ErrInvalidPatch, service.FieldRecurrence, err)
+	}
+	patch.RecurrenceMask = []string{}
+	for field := range members {
+		if field != "next_id" {
+			patch.RecurrenceMask = append(patch.RecurrenceMask, field)
+		}
+	}
+	return nil
+}
+
+type jsonPatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// decodeJSONPatch turns an RFC 6902 JSON Patch into a field mask. Only
+// top-level todo fields can be addressed. Operations apply in order, so a
+// "test" checks the value an earlier operation set, or else the current todo;
+// in that case the patch is pinned to the version that was tested so nothing
+// can change in between.
+func (h *TodoHandler) decodeJSONPatch(r *http.Request, id string, expectedVersion int64) (service.TodoPatch, int64, error) {
+	var patch service.TodoPatch
+	var ops []jsonPatchOp
+	if err := json.NewDecoder(r.Body).Decode(&ops); err != nil {
+		return patch, expectedVersion, err
+	}
+
+	// set holds the values the operations so far gave fields, current the
+	// stored todo, read for the first test of a field they did not set.
+	set := make(map[string]json.RawMessage)
+	var current map[string]json.RawMessage
+	for i, op := range ops {
+		field := strings.TrimPrefix(op.Path, "/")
+		if !strings.HasPrefix(op.Path, "/") || strings.Contains(field, "/") {
+			return patch, expectedVersion, fmt.Errorf("%w: operation %d: unsupported path %q", service.ErrInvalidPatch, i, op.Path)
+		}
+
+		switch op.Op {
+		case "add", "replace":
+			if op.Value == nil {
+				return patch, expectedVersion, fmt.Errorf("%w: operation %d: %s needs a value", service.ErrInvalidPatch, i, op.Op)
+			}
+			if err := setPatchField(&patch, field, op.Value); err != nil {
+				return patch, expectedVersion, err
+			}
+			set[field] = op.Value
+		case "remove":
+			if err := setPatchField(&patch, field, json.RawMessage("null")); err != nil {
+				return patch, expectedVersion, err
+			}
+			set[field] = json.RawMessage("null")
+		case "test":
+			value, ok := set[field]
+			if !ok {
+				if current == nil {
+					todo, err := h.service.GetTodo(r.Context(), id)
+					if err != nil {
+						return patch, expectedVersion, err
+					}
+					if expectedVersion != 0 && todo.Version != expectedVersion {
+						return patch, expectedVersion, service.ErrVersionMismatch
+					}
+					expectedVersion = todo.Version
+					data, _ := json.Marshal(todo)
+					json.Unmarshal(data, &current)
+				}
+				value = current[field]
+			}
+			if !jsonEqual(value, op.Value) {
+				return patch, expectedVersion, fmt.Errorf("%w: %s is not %s", errPatchTestFailed, op.Path, op.Value)
+			}
+		default:
+			return patch, expectedVersion, fmt.Errorf("%w: operation %d: unsupported op %q", service.ErrInvalidPatch, i, op.Op)
+		}
+	}
+	return patch, expectedVersion, nil
+}
+
+// setPatchField decodes raw into the patch value for field and adds field to
+// the mask. A JSON null sets the zero value, clearing the field.
+func setPatchField(patch *service.TodoPatch, field string, raw json.RawMessage) error {
+	null := bytes.Equal(bytes.TrimSpace(raw), []byte("null"))
+
+	var dst interface{}
+	switch field {
+	case service.FieldTitle:
+		patch.Values.Title = ""
+		dst = &patch.Values.Title
+	case service.FieldDescription:
+		patch.Values.Description = ""
+		dst = &patch.Values.Description
+	case service.FieldStatus:
+		patch.Values.Status = ""
+		dst = &patch.Values.Status
+	case service.FieldDueDate:
+		patch.Values.DueDate = time.Time{}
+		dst = &patch.Values.DueDate
+	case service.FieldPriority:
+		patch.Values.Priority = models.PriorityNone
+		dst = &patch.Values.Priority
+	case service.FieldTags:
+		patch.Values.Tags = nil
+		dst = &patch.Values.Tags
+	case service.FieldParentID:
+		patch.Values.ParentID = ""
+		dst = &patch.Values.ParentID
+	case service.FieldAutoComplete:
+		patch.Values.AutoComplete = false
+		dst = &patch.Values.AutoComplete
+	case service.FieldBlockedBy:
+		patch.Values.BlockedBy = nil
+		dst = &patch.Values.BlockedBy
+	case service.FieldRecurrence:
+		patch.Values.Recurrence = nil
+		dst = &patch.Values.Recurrence
+	case service.FieldReminders:
+		patch.Values.Reminders = nil
+		dst = &patch.Values.Reminders
+	case service.FieldPosition:
+		patch.Values.Position = 0
+		dst = &patch.Values.Position
+	default:
+		return fmt.Errorf("%w: field %q cannot be changed", service.ErrInvalidPatch, field)
+	}
+
+	if !null {
+		if err := json.Unmarshal(raw, dst); err != nil {
+			return fmt.Errorf("%w: %s: %v", service.ErrInvalidPatch, field, err)
+		}
+	}
+	patch.Set(field)
+	return nil
+}
+
+// jsonEqual compares two JSON values semantically.
+func jsonEqual(a, b json.RawMessage) bool {
+	var va, vb interface{}
+	if a == nil {
+		a = json.RawMessage("null")
+	}
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return false
+	}
+	ja, _ := json.Marshal(va)
+	jb, _ := json.Marshal(vb)
+	return bytes.Equal(ja, jb)
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"todo-app/internal/apperr"
+	"todo-app/internal/validation"
+	"todo-app/pkg/utils"
+)
+
+// Problem codes for failures detected by the handlers themselves. Errors from
+// the service and storage layers carry their own codes.
+const (
+	codeInvalidRequest   = "invalid_request"
+	codeUnsupportedMedia = "unsupported_media_type"
+	codeRouteNotFound    = "route_not_found"
+	codeMethodNotAllowed = "method_not_allowed"
+)
+
+// kindStatus is the HTTP status for each error kind.
+var kindStatus = map[apperr.Kind]int{
+	apperr.Internal:     http.StatusInternalServerError,
+	apperr.NotFound:     http.StatusNotFound,
+	apperr.Conflict:     http.StatusConflict,
+	apperr.Invalid:      http.StatusBadRequest,
+	apperr.Validation:   http.StatusUnprocessableEntity,
+	apperr.Precondition: http.StatusPreconditionFailed,
+	apperr.Unavailable:  http.StatusServiceUnavailable,
+	apperr.Timeout:      http.StatusGatewayTimeout,
+}
+
+// httpError writes the problem response for an error returned by the
+// service. It is the only place errors are turned into HTTP statuses.
+func httpError(w http.ResponseWriter, r *http.Request, err error) {
+	if problem := problemFor(err, r.Method, r.URL.Path); problem != nil {
+		utils.WriteProblem(w, problem)
+	}
+}
+
+// problemFor describes an error returned by the service as a problem, or
+// returns nil if the client went away and there is nobody to answer. method
+// and instance say what failed, for the log and the problem.
+func problemFor(err error, method, instance string) *utils.Problem {
+	kind, code := apperr.Classify(err)
+	if kind == apperr.Canceled {
+		return nil
+	}
+
+	problem := &utils.Problem{
+		Type:     utils.ProblemType(code),
+		Title:    http.StatusText(kindStatus[kind]),
+		Status:   kindStatus[kind],
+		Code:     code,
+		Detail:   err.Error(),
+		Instance: instance,
+	}
+	switch kind {
+	case apperr.Internal:
+		// Don't leak internals to clients.
+		log.Printf("%s %s: %v", method, instance, err)
+		problem.Detail = "An unexpected error occurred"
+	case apperr.Unavailable:
+		log.Printf("%s %s: %v", method, instance, err)
+	}
+
+	var invalid validation.Errors
+	if errors.As(err, &invalid) {
+		// Report every field error at once so clients can fix them together.
+		problem.Detail = "The request is invalid"
+		for _, fe := range invalid {
+			problem.Errors = append(problem.Errors, utils.FieldProblem{Field: fe.Field, Rule: fe.Rule, Message: fe.Message})
+		}
+	}
+	return problem
+}
+
+// badRequest reports a malformed request, such as unparsable JSON or a bad
+// query parameter.
+func badRequest(w http.ResponseWriter, r *http.Request, detail string) {
+	writeProblem(w, r, http.StatusBadRequest, codeInvalidRequest, detail)
+}
+
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	utils.WriteProblem(w, &utils.Problem{Status: status, Code: code, Detail: detail, Instance: r.URL.Path})
+}
+
+// NotFound answers requests that match no route.
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	writeProblem(w, r, http.StatusNotFound, codeRouteNotFound, "No such endpoint")
+}
+
+// MethodNotAllowed answers requests for a route with the wrong method.
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeProblem(w, r, http.StatusMethodNotAllowed, codeMethodNotAllowed, r.Method+" is not supported here")
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"todo-app/internal/models"
+	"todo-app/internal/recurrence"
+)
+
+// occurrence is one previewed occurrence of a repeating todo. DueDate carries
+// the offset of the rule's time zone on that day.
+type occurrence struct {
+	Occurrence int       `json:"occurrence"`
+	DueDate    time.Time `json:"due_date"`
+}
+
+func occurrences(in []recurrence.Occurrence) []occurrence {
+	out := make([]occurrence, len(in))
+	for i, o := range in {
+		out[i] = occurrence{Occurrence: o.Number, DueDate: o.Time}
+	}
+	return out
+}
+
+// GetOccurrences handles GET /todos/{id}/occurrences, previewing the
+// occurrences of a repeating todo that follow it. limit sets how many.
+func (h *TodoHandler) GetOccurrences(w http.ResponseWriter, r *http.Request) {
+	limit, ok := parseLimit(w, r)
+	if !ok {
+		return
+	}
+	next, err := h.service.Occurrences(r.Context(), mux.Vars(r)["id"], limit)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(occurrences(next))
+}
+
+// ExpandRecurrence handles GET /recurrence/occurrences, previewing a rule
+// before any todo uses it. Query parameters: rule (an RRULE), start (the first
+// due date, RFC 3339), time_zone (IANA, default UTC) and limit.
+func (h *TodoHandler) ExpandRecurrence(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	limit, ok := parseLimit(w, r)
+	if !ok {
+		return
+	}
+	rec := models.Recurrence{Rule: params.Get("rule"), TimeZone: params.Get("time_zone")}
+	if start := params.Get("start"); start != "" {
+		var err error
+		if rec.Start, err = time.Parse(time.RFC3339, start); err != nil {
+			badRequest(w, r, "start must be an RFC 3339 date-time such as 2026-01-05T09:00:00+01:00")
+			return
+		}
+	}
+
+	all, err := h.service.ExpandRecurrence(rec, limit)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(occurrences(all))
+}
+
+// parseLimit reads the optional limit parameter, reporting a bad one.
+func parseLimit(w http.ResponseWriter, r *http.Request) (int, bool) {
+	limit := r.URL.Query().Get("limit")
+	if limit == "" {
+		return 0, true
+	}
+	n, err := strconv.Atoi(limit)
+	if err != nil || n <= 0 {
+		badRequest(w, r, "limit must be a positive integer")
+		return 0, false
+	}
+	return n, true
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"todo-app/internal/models"
+	"todo-app/internal/reminder"
+)
+
+type ReminderHandler struct {
+	scheduler *reminder.Scheduler
+}
+
+func NewReminderHandler(scheduler *reminder.Scheduler) *ReminderHandler {
+	return &ReminderHandler{scheduler: scheduler}
+}
+
+// GetUpcoming handles GET /reminders?within=, listing the notifications that
+// will be sent within the given time (default 1d), soonest first.
+func (h *ReminderHandler) GetUpcoming(w http.ResponseWriter, r *http.Request) {
+	within := models.Reminder(24 * time.Hour)
+	if s := r.URL.Query().Get("within"); s != "" {
+		var err error
+		if within, err = models.ParseReminder(s); err != nil {
+			badRequest(w, r, "within must be a duration such as 1d or 2h30m")
+			return
+		}
+	}
+
+	upcoming, err := h.scheduler.Upcoming(r.Context(), time.Duration(within))
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	if upcoming == nil {
+		upcoming = []reminder.Notification{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(upcoming)
+}
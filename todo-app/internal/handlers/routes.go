@@ -0,0 +1,34 @@
+package handlers
+
+import "github.com/gorilla/mux"
+
+// Routes registers the todo API on api, the router serving /api/v1: todos,
+// their workflow and recurrence, tags and sync. The server adds webhooks,
+// reminders and its health check; the CLI serves just these in-process when
+// it runs without a server.
+func Routes(api *mux.Router, todos *TodoHandler, sync *SyncHandler) {
+	api.HandleFunc("/todos", todos.CreateTodo).Methods("POST")
+	api.HandleFunc("/todos", todos.GetAllTodos).Methods("GET")
+	api.HandleFunc("/todos/filter", todos.FilterTodos).Methods("GET")
+	api.HandleFunc("/todos/search", todos.SearchTodos).Methods("GET")
+	api.HandleFunc("/todos/tree", todos.GetForest).Methods("GET")
+	api.HandleFunc("/todos/plan", todos.GetPlan).Methods("GET")
+	api.HandleFunc("/todos/{id}", todos.GetTodo).Methods("GET")
+	api.HandleFunc("/todos/{id}", todos.UpdateTodo).Methods("PUT")
+	api.HandleFunc("/todos/{id}", todos.PatchTodo).Methods("PATCH")
+	api.HandleFunc("/todos/{id}", todos.DeleteTodo).Methods("DELETE")
+	api.HandleFunc("/todos/{id}/children", todos.GetSubtasks).Methods("GET")
+	api.HandleFunc("/todos/{id}/tree", todos.GetTree).Methods("GET")
+	api.HandleFunc("/todos/{id}/dependencies", todos.GetDependencies).Methods("GET")
+	api.HandleFunc("/todos/{id}/blockers/{blocker}", todos.AddBlocker).Methods("PUT")
+	api.HandleFunc("/todos/{id}/blockers/{blocker}", todos.RemoveBlocker).Methods("DELETE")
+	api.HandleFunc("/todos/{id}/occurrences", todos.GetOccurrences).Methods("GET")
+	api.HandleFunc("/todos/{id}/{action}", todos.TransitionTodo).Methods("POST")
+	api.HandleFunc("/workflow", todos.GetWorkflow).Methods("GET")
+	api.HandleFunc("/recurrence/occurrences", todos.ExpandRecurrence).Methods("GET")
+	api.HandleFunc("/tags", todos.ListTags).Methods("GET")
+	api.HandleFunc("/tags/merge", todos.MergeTags).Methods("POST")
+	api.HandleFunc("/tags/{tag}/rename", todos.RenameTag).Methods("POST")
+	api.HandleFunc("/sync", sync.Sync).Methods("GET")
+	api.HandleFunc("/sync", sync.Push).Methods("POST")
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"todo-app/internal/models"
+)
+
+// searchResult is one element of the GET /todos/search response.
+type searchResult struct {
+	Todo  *models.Todo `json:"todo"`
+	Score float64      `json:"score"`
+	// Highlights holds HTML excerpts of the matching fields with the matched
+	// terms wrapped in <mark>.
+	Highlights map[string]string `json:"highlights"`
+}
+
+// SearchTodos handles GET /todos/search?q=<terms>[&limit=n], returning the
+// todos containing all terms, best match first.
+func (h *TodoHandler) SearchTodos(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	query := params.Get("q")
+	if strings.TrimSpace(query) == "" {
+		badRequest(w, r, "q parameter is required")
+		return
+	}
+
+	var limit int
+	if s := params.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			badRequest(w, r, "limit must be a positive integer")
+			return
+		}
+		limit = n
+	}
+
+	hits, err := h.service.SearchTodos(r.Context(), query, limit)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+
+	results := make([]searchResult, len(hits))
+	for i, hit := range hits {
+		results[i] = searchResult{Todo: hit.Todo, Score: hit.Score, Highlights: hit.Highlights}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"todo-app/internal/hlc"
+	"todo-app/internal/models"
+	"todo-app/internal/service"
+	"todo-app/pkg/utils"
+)
+
+// maxSyncChanges bounds the number of changes in one POST /sync.
+const maxSyncChanges = 1000
+
+type SyncHandler struct {
+	service *service.TodoService
+}
+
+func NewSyncHandler(service *service.TodoService) *SyncHandler {
+	return &SyncHandler{service: service}
+}
+
+// syncChange is a change in a GET /sync response: a todo as last saved
+// ("upsert") or the deletion of one ("delete").
+type syncChange struct {
+	Op   string       `json:"op"`
+	ID   string       `json:"id"`
+	Todo *models.Todo `json:"todo,omitempty"`
+	// Clocks are the times the todo's fields last changed, for clients that
+	// merge changes themselves.
+	Clocks    map[string]hlc.Timestamp `json:"clocks,omitempty"`
+	DeletedAt *time.Time               `json:"deleted_at,omitempty"`
+}
+
+// Sync handles GET /sync?since=<token>[&limit=n], returning the changes since
+// the token a previous response gave, or every todo without one:
+//
+//	{"changes": [...], "token": "...", "more": false, "clock": "..."}
+//
+// A client saves the token once it has stored the changes, and asks again
+// right away while more is set. clock is the server's current time, which
+// the client should move its own clock past.
+func (h *SyncHandler) Sync(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	var limit int
+	if s := params.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			badRequest(w, r, "limit must be a positive integer")
+			return
+		}
+		limit = n
+	}
+
+	set, err := h.service.Changes(r.Context(), params.Get("since"), limit)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+
+	changes := make([]syncChange, len(set.Changes))
+	for i, c := range set.Changes {
+		if t := c.Tombstone; t != nil {
+			deletedAt := t.DeletedAt
+			changes[i] = syncChange{Op: "delete", ID: t.ID, DeletedAt: &deletedAt}
+			continue
+		}
+		changes[i] = syncChange{Op: "upsert", ID: c.Todo.ID, Todo: c.Todo, Clocks: c.Todo.Clocks}
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Changes []syncChange  `json:"changes"`
+		Token   string        `json:"token"`
+		More    bool          `json:"more"`
+		Clock   hlc.Timestamp `json:"clock"`
+	}{changes, set.Token, set.More, h.service.Clock().Now()})
+}
+
+// clientChange is a change in a POST /sync request.
+type clientChange struct {
+	Op    string `json:"op"`
+	ID    string `json:"id"`
+	Clock string `json:"clock"`
+	// Fields is a merge patch of the fields the change sets, for "upsert".
+	Fields   json.RawMessage `json:"fields"`
+	Subtasks string          `json:"subtasks"`
+}
+
+// syncResult is the outcome of one change in a POST /sync response.
+type syncResult struct {
+	ID      string         `json:"id"`
+	Status  string         `json:"status"`
+	Todo    *models.Todo   `json:"todo,omitempty"`
+	Ignored []string       `json:"ignored,omitempty"`
+	Error   *utils.Problem `json:"error,omitempty"`
+}
+
+// Push handles POST /sync with body {"changes": [...]}, applying changes a
+// client made, in order. Each change is
+//
+//	{"op": "upsert", "id": "...", "clock": "...", "fields": {merge patch}}
+//	{"op": "delete", "id": "...", "clock": "...", "subtasks": "cascade"}
+//
+// where clock is the client's hybrid logical clock time of the change and an
+// upsert of an unknown ID creates the todo. The response holds a result per
+// change, in the same order, and the server's clock:
+//
+//	{"results": [{"id", "status", "todo", "ignored", "error"}], "clock": "..."}
+//
+// status is applied, merged (the fields in ignored changed later and were
+// kept), deleted (the todo was deleted, which wins over edits) or rejected
+// (error is the problem). One change failing does not fail the request.
+func (h *SyncHandler) Push(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Changes []clientChange `json:"changes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		badRequest(w, r, "Invalid JSON: "+err.Error())
+		return
+	}
+	if len(request.Changes) > maxSyncChanges {
+		badRequest(w, r, "at most "+strconv.Itoa(maxSyncChanges)+" changes can be sent at once")
+		return
+	}
+
+	// Changes that cannot even be decoded are rejected in place, keeping the
+	// results in the order of the request.
+	changes := make([]service.ClientChange, 0, len(request.Changes))
+	failed := make(map[int]error)
+	for i, c := range request.Changes {
+		change, err := decodeClientChange(c)
+		if err != nil {
+			failed[i] = err
+			continue
+		}
+		changes = append(changes, change)
+	}
+	applied := h.service.ApplyChanges(r.Context(), changes)
+	if err := r.Context().Err(); err != nil {
+		httpError(w, r, err)
+		return
+	}
+
+	results := make([]syncResult, len(request.Changes))
+	for i, c := range request.Changes {
+		var result service.SyncResult
+		if err, ok := failed[i]; ok {
+			result = service.SyncResult{ID: c.ID, Status: service.SyncRejected, Err: err}
+		} else {
+			result, applied = applied[0], applied[1:]
+		}
+		results[i] = syncResult{ID: result.ID, Status: result.Status, Todo: result.Todo, Ignored: result.Ignored}
+		if result.Err != nil {
+			results[i].Error = problemFor(result.Err, r.Method, r.URL.Path)
+		}
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Results []syncResult  `json:"results"`
+		Clock   hlc.Timestamp `json:"clock"`
+	}{results, h.service.Clock().Now()})
+}
+
+func decodeClientChange(c clientChange) (service.ClientChange, error) {
+	change := service.ClientChange{ID: c.ID}
+	if c.Clock != "" {
+		clock, err := hlc.Parse(c.Clock)
+		if err != nil {
+			return change, errInvalidMessage(err.Error())
+		}
+		change.Clock = clock
+	}
+	switch c.Op {
+	case "upsert":
+		if len(c.Fields) == 0 {
+			return change, errInvalidMessage("fields is required")
+		}
+		patch, err := decodeMergePatch(bytes.NewReader(c.Fields))
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidPatch) {
+				return change, err
+			}
+			return change, errInvalidMessage("Invalid fields: " + err.Error())
+		}
+		change.Patch = patch
+	case "delete":
+		change.Delete = true
+		change.Subtasks = service.SubtaskPolicy(c.Subtasks)
+		switch change.Subtasks {
+		case service.SubtasksReject, service.SubtasksCascade, service.SubtasksPromote:
+		default:
+			return change, errInvalidMessage("subtasks must be cascade or promote")
+		}
+	default:
+		return change, errInvalidMessage(`op must be "upsert" or "delete"`)
+	}
+	return change, nil
+}
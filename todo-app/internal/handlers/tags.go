@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+type tagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+type retagResult struct {
+	// Changed is the number of todos whose tags changed.
+	Changed int `json:"changed"`
+}
+
+// ListTags handles GET /tags, listing every tag in use with its todo count.
+func (h *TodoHandler) ListTags(w http.ResponseWriter, r *http.Request) {
+	counts, err := h.service.ListTags(r.Context())
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+
+	tags := make([]tagCount, len(counts))
+	for i, c := range counts {
+		tags[i] = tagCount{Tag: c.Tag, Count: c.Count}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tags)
+}
+
+// RenameTag handles POST /tags/{tag}/rename with body {"to": "new-name"}.
+func (h *TodoHandler) RenameTag(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		To string `json:"to"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		badRequest(w, r, "Invalid JSON: "+err.Error())
+		return
+	}
+
+	changed, err := h.service.RenameTag(r.Context(), mux.Vars(r)["tag"], request.To)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(retagResult{Changed: changed})
+}
+
+// MergeTags handles POST /tags/merge with body {"from": ["a", "b"], "to": "c"}.
+func (h *TodoHandler) MergeTags(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		From []string `json:"from"`
+		To   string   `json:"to"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		badRequest(w, r, "Invalid JSON: "+err.Error())
+		return
+	}
+
+	changed, err := h.service.MergeTags(r.Context(), request.From, request.To)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(retagResult{Changed: changed})
+}
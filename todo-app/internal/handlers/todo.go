@@ -1,16 +1,45 @@
 package handlers
 
 import (
+    "context"
     "encoding/json"
+    "fmt"
     "net/http"
+    "strconv"
+    "strings"
     "time"
     
     "github.com/gorilla/mux"
+    "todo-app/internal/filter"
     "todo-app/internal/models"
     "todo-app/internal/service"
-	"todo-app/internal/storage"
+    "todo-app/internal/storage"
 )
 
+// etag is the entity tag for a todo: its version as a strong validator.
+func etag(todo *models.Todo) string {
+    return strconv.Quote(strconv.FormatInt(todo.Version, 10))
+}
+
+// parseIfMatch returns the version required by an If-Match header, or 0 if
+// the header is absent or "*" (any current version).
+func parseIfMatch(header string) (int64, error) {
+    header = strings.TrimSpace(header)
+    if header == "" || header == "*" {
+        return 0, nil
+    }
+    tag := strings.TrimPrefix(header, "W/")
+    unquoted, err := strconv.Unquote(tag)
+    if err != nil {
+        return 0, fmt.Errorf("malformed If-Match header %q", header)
+    }
+    version, err := strconv.ParseInt(unquoted, 10, 64)
+    if err != nil || version <= 0 {
+        return 0, fmt.Errorf("If-Match %q does not name a todo version", header)
+    }
+    return version, nil
+}
+
 type TodoHandler struct {
     service *service.TodoService
 }
@@ -19,25 +48,40 @@ func NewTodoHandler(service *service.TodoService) *TodoHandler {
     return &TodoHandler{service: service}
 }
 
+// createRequest is the body of POST /todos, and of the collaboration
+// socket's create messages.
+type createRequest struct {
+    Title        string             `json:"title"`
+    Description  string             `json:"description"`
+    DueDate      time.Time          `json:"due_date"`
+    Priority     models.Priority    `json:"priority"`
+    Tags         []string           `json:"tags"`
+    ParentID     string             `json:"parent_id"`
+    AutoComplete bool               `json:"auto_complete"`
+    BlockedBy    []string           `json:"blocked_by"`
+    Recurrence   *models.Recurrence `json:"recurrence"`
+    Reminders    []models.Reminder  `json:"reminders"`
+}
+
+func (request *createRequest) create(ctx context.Context, s *service.TodoService) (*models.Todo, error) {
+    return s.CreateTodo(ctx, request.Title, request.Description, request.DueDate, request.Priority, request.Tags, request.ParentID, request.AutoComplete, request.BlockedBy, request.Recurrence, request.Reminders)
+}
+
 func (h *TodoHandler) CreateTodo(w http.ResponseWriter, r *http.Request) {
-    var request struct {
-        Title       string    `json:"title"`
-        Description string    `json:"description"`
-        DueDate     time.Time `json:"due_date"`
-    }
-    
+    var request createRequest
     if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-        http.Error(w, "Invalid JSON", http.StatusBadRequest)
+        badRequest(w, r, "Invalid JSON: "+err.Error())
         return
     }
     
-    todo, err := h.service.CreateTodo(request.Title, request.Description, request.DueDate)
+    todo, err := request.create(r.Context(), h.service)
     if err != nil {
-        http.Error(w, err.Error(), http.StatusInternalServerError)
+        httpError(w, r, err)
         return
     }
     
     w.Header().Set("Content-Type", "application/json")
+    w.Header().Set("ETag", etag(todo))
     w.WriteHeader(http.StatusCreated)
     json.NewEncoder(w).Encode(todo)
 }
@@ -46,90 +90,196 @@ func (h *TodoHandler) GetTodo(w http.ResponseWriter, r *http.Request) {
     vars := mux.Vars(r)
     id := vars["id"]
     
-    todo, err := h.service.GetTodo(id)
+    todo, err := h.service.GetTodo(r.Context(), id)
     if err != nil {
-        if err == storage.ErrNotFound {
-            http.Error(w, "Todo not found", http.StatusNotFound)
-        } else {
-            http.Error(w, err.Error(), http.StatusInternalServerError)
-        }
+        httpError(w, r, err)
+        return
+    }
+    progress, err := h.service.Progress(r.Context(), id)
+    if err != nil {
+        httpError(w, r, err)
         return
     }
     
     w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(todo)
+    w.Header().Set("ETag", etag(todo))
+    json.NewEncoder(w).Encode(newTodoNode(todo, progress))
 }
 
+// GetAllTodos lists todos a page at a time. Query parameters: q (a filter such
+// as "status:pending AND due<2026-11-01"), tag and priority (shorthands for
+// tag= and priority= in q; tag may repeat and priority may list several
+// priorities separated by commas), limit, cursor (from the previous page's
+// Link header), sort (e.g. "-priority,due_date") and fields (e.g.
+// "id,title,status").
 func (h *TodoHandler) GetAllTodos(w http.ResponseWriter, r *http.Request) {
-    todos, err := h.service.GetAllTodos()
+    expr, err := filter.Parse(r.URL.Query().Get("q"))
+    if err != nil {
+        httpError(w, r, err)
+        return
+    }
+    h.listTodos(w, r, expr)
+}
+
+// listTodos lists the todos matching expr and the tag and priority
+// parameters. Those are added to the parsed query as nodes rather than
+// spliced into its text, so they cannot change what q means.
+func (h *TodoHandler) listTodos(w http.ResponseWriter, r *http.Request, expr filter.Expr) {
+    params := r.URL.Query()
+    
+    for _, tag := range params["tag"] {
+        expr = and(expr, filter.Compare{Field: filter.FieldTag, Op: filter.OpEq, Value: strings.ToLower(tag)})
+    }
+    if priorities := params.Get("priority"); priorities != "" {
+        var alternatives filter.Expr
+        for _, name := range strings.Split(priorities, ",") {
+            name = strings.TrimSpace(name)
+            priority, err := models.ParsePriority(strings.ToLower(name))
+            if err != nil {
+                badRequest(w, r, "priority: "+err.Error())
+                return
+            }
+            var c filter.Expr = filter.Compare{Field: filter.FieldPriority, Op: filter.OpEq, Value: name, Priority: priority}
+            if alternatives != nil {
+                c = filter.Or{Left: alternatives, Right: c}
+            }
+            alternatives = c
+        }
+        expr = and(expr, alternatives)
+    }
+    
+    var query storage.Query
+    if limit := params.Get("limit"); limit != "" {
+        n, err := strconv.Atoi(limit)
+        if err != nil || n <= 0 {
+            badRequest(w, r, "limit must be a positive integer")
+            return
+        }
+        query.Limit = n
+    }
+    query.Cursor = params.Get("cursor")
+    
+    var err error
+    if query.Sort, err = storage.ParseSort(params.Get("sort")); err != nil {
+        httpError(w, r, err)
+        return
+    }
+    fields, err := parseFields(params.Get("fields"))
+    if err != nil {
+        badRequest(w, r, err.Error())
+        return
+    }
+    
+    page, err := h.service.ListTodos(r.Context(), expr, query)
     if err != nil {
-        http.Error(w, err.Error(), http.StatusInternalServerError)
+        httpError(w, r, err)
         return
     }
     
+    body, err := project(page.Todos, fields)
+    if err != nil {
+        httpError(w, r, err)
+        return
+    }
+    
+    if page.NextCursor != "" {
+        next := *r.URL
+        nextParams := next.Query()
+        nextParams.Set("cursor", page.NextCursor)
+        next.RawQuery = nextParams.Encode()
+        w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", next.RequestURI()))
+    }
     w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(todos)
+    json.NewEncoder(w).Encode(body)
 }
 
 func (h *TodoHandler) UpdateTodo(w http.ResponseWriter, r *http.Request) {
     vars := mux.Vars(r)
     id := vars["id"]
     
+    expectedVersion, err := parseIfMatch(r.Header.Get("If-Match"))
+    if err != nil {
+        badRequest(w, r, err.Error())
+        return
+    }
+    
     var request struct {
-        Title       string        `json:"title"`
-        Description string        `json:"description"`
-        Status      models.Status `json:"status"`
-        DueDate     time.Time     `json:"due_date"`
+        Title       string          `json:"title"`
+        Description string          `json:"description"`
+        Status      models.Status   `json:"status"`
+        DueDate     time.Time       `json:"due_date"`
+        Priority    models.Priority `json:"priority"`
+        Tags        []string        `json:"tags"`
     }
     
     if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-        http.Error(w, "Invalid JSON", http.StatusBadRequest)
+        badRequest(w, r, "Invalid JSON: "+err.Error())
         return
     }
     
-    todo, err := h.service.UpdateTodo(id, request.Title, request.Description, request.Status, request.DueDate)
+    todo, err := h.service.UpdateTodo(r.Context(), id, expectedVersion, request.Title, request.Description, request.Status, request.DueDate, request.Priority, request.Tags)
     if err != nil {
-        if err == storage.ErrNotFound {
-            http.Error(w, "Todo not found", http.StatusNotFound)
-        } else {
-            http.Error(w, err.Error(), http.StatusInternalServerError)
-        }
+        httpError(w, r, err)
         return
     }
     
     w.Header().Set("Content-Type", "application/json")
+    w.Header().Set("ETag", etag(todo))
     json.NewEncoder(w).Encode(todo)
 }
 
+// DeleteTodo deletes a todo. A todo with subtasks is only deleted with
+// subtasks=cascade, which deletes them too, or subtasks=promote, which moves
+// them up to the todo's parent.
 func (h *TodoHandler) DeleteTodo(w http.ResponseWriter, r *http.Request) {
     vars := mux.Vars(r)
     id := vars["id"]
     
-    if err := h.service.DeleteTodo(id); err != nil {
-        if err == storage.ErrNotFound {
-            http.Error(w, "Todo not found", http.StatusNotFound)
-        } else {
-            http.Error(w, err.Error(), http.StatusInternalServerError)
-        }
+    policy := service.SubtaskPolicy(r.URL.Query().Get("subtasks"))
+    switch policy {
+    case service.SubtasksReject, service.SubtasksCascade, service.SubtasksPromote:
+    default:
+        badRequest(w, r, "subtasks must be cascade or promote")
+        return
+    }
+    
+    if err := h.service.DeleteTodo(r.Context(), id, policy); err != nil {
+        httpError(w, r, err)
         return
     }
     
     w.WriteHeader(http.StatusNoContent)
 }
 
+// FilterTodos is the older form of GetAllTodos?q=. It also still accepts
+// status=<status>, which is shorthand for q=status:<status>.
 func (h *TodoHandler) FilterTodos(w http.ResponseWriter, r *http.Request) {
-    status := r.URL.Query().Get("status")
-    if status == "" {
-        http.Error(w, "Status parameter is required", http.StatusBadRequest)
+    params := r.URL.Query()
+    if params.Get("q") == "" && params.Get("status") == "" && params.Get("tag") == "" && params.Get("priority") == "" {
+        badRequest(w, r, "q, status, tag or priority parameter is required")
         return
     }
     
-    todos, err := h.service.FilterByStatus(models.Status(status))
-    if err != nil {
-        http.Error(w, err.Error(), http.StatusInternalServerError)
-        return
+    var expr filter.Expr
+    if q := params.Get("q"); q != "" {
+        var err error
+        if expr, err = filter.Parse(q); err != nil {
+            httpError(w, r, err)
+            return
+        }
+    } else if status := params.Get("status"); status != "" {
+        expr = filter.Compare{Field: filter.FieldStatus, Op: filter.OpEq, Value: status}
     }
-    
-    w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(todos)
-}
\ No newline at end of file
+    h.listTodos(w, r, expr)
+}
+
+// and combines two filters, either of which may be nil to match everything.
+func and(left, right filter.Expr) filter.Expr {
+    switch {
+    case left == nil:
+        return right
+    case right == nil:
+        return left
+    }
+    return filter.And{Left: left, Right: right}
+}
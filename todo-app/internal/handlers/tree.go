@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"todo-app/internal/models"
+	"todo-app/internal/service"
+)
+
+type progress struct {
+	Done  int `json:"done"`
+	Total int `json:"total"`
+}
+
+// todoNode is a todo as returned with its subtask progress and, in trees,
+// its subtasks.
+type todoNode struct {
+	*models.Todo
+	// Progress is omitted for todos without subtasks.
+	Progress *progress   `json:"progress,omitempty"`
+	Children []*todoNode `json:"children,omitempty"`
+}
+
+func newTodoNode(todo *models.Todo, p service.Progress) *todoNode {
+	node := &todoNode{Todo: todo}
+	if p.Total > 0 {
+		node.Progress = &progress{Done: p.Done, Total: p.Total}
+	}
+	return node
+}
+
+func treeNode(n *service.TreeNode) *todoNode {
+	node := newTodoNode(n.Todo, n.Progress)
+	for _, child := range n.Children {
+		node.Children = append(node.Children, treeNode(child))
+	}
+	return node
+}
+
+// GetSubtasks handles GET /todos/{id}/children, listing a todo's direct
+// subtasks with their own progress.
+func (h *TodoHandler) GetSubtasks(w http.ResponseWriter, r *http.Request) {
+	subtasks, err := h.service.Subtasks(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+
+	nodes := make([]*todoNode, len(subtasks))
+	for i, sub := range subtasks {
+		p, err := h.service.Progress(r.Context(), sub.ID)
+		if err != nil {
+			httpError(w, r, err)
+			return
+		}
+		nodes[i] = newTodoNode(sub, p)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(nodes)
+}
+
+// GetTree handles GET /todos/{id}/tree, returning a todo with all of its
+// subtasks nested under "children".
+func (h *TodoHandler) GetTree(w http.ResponseWriter, r *http.Request) {
+	tree, err := h.service.Tree(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(tree.Todo))
+	json.NewEncoder(w).Encode(treeNode(tree))
+}
+
+// GetForest handles GET /todos/tree, returning every todo as a tree of
+// subtasks under its top-level todo.
+func (h *TodoHandler) GetForest(w http.ResponseWriter, r *http.Request) {
+	forest, err := h.service.Forest(r.Context())
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+
+	nodes := make([]*todoNode, len(forest))
+	for i, tree := range forest {
+		nodes[i] = treeNode(tree)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(nodes)
+}
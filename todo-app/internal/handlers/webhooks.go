@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"todo-app/internal/webhook"
+)
+
+type WebhookHandler struct {
+	webhooks *webhook.Dispatcher
+}
+
+func NewWebhookHandler(webhooks *webhook.Dispatcher) *WebhookHandler {
+	return &WebhookHandler{webhooks: webhooks}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// ListWebhooks handles GET /webhooks. Secrets are left out.
+func (h *WebhookHandler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.webhooks.Webhooks())
+}
+
+// CreateWebhook handles POST /webhooks with body {"url", "events", "secret",
+// "active"}. Only url is required: events defaults to all of them, secret to
+// a random one and active to true. The response is the only one showing the
+// secret.
+func (h *WebhookHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		URL    string              `json:"url"`
+		Events []webhook.EventType `json:"events"`
+		Secret string              `json:"secret"`
+		Active *bool               `json:"active"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		badRequest(w, r, "Invalid JSON: "+err.Error())
+		return
+	}
+
+	hook := webhook.Webhook{URL: request.URL, Events: request.Events, Secret: request.Secret, Active: true}
+	if request.Active != nil {
+		hook.Active = *request.Active
+	}
+	created, err := h.webhooks.Create(hook)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, created)
+}
+
+// GetWebhook handles GET /webhooks/{id}.
+func (h *WebhookHandler) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	hook, err := h.webhooks.Webhook(mux.Vars(r)["id"])
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, hook)
+}
+
+// UpdateWebhook handles PATCH /webhooks/{id}, changing the fields given:
+// url, events, secret or active (false pauses deliveries until it is set
+// back to true).
+func (h *WebhookHandler) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		URL    *string              `json:"url"`
+		Events *[]webhook.EventType `json:"events"`
+		Secret *string              `json:"secret"`
+		Active *bool                `json:"active"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		badRequest(w, r, "Invalid JSON: "+err.Error())
+		return
+	}
+
+	updated, err := h.webhooks.Update(mux.Vars(r)["id"], webhook.Update{
+		URL:    request.URL,
+		Events: request.Events,
+		Secret: request.Secret,
+		Active: request.Active,
+	})
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// DeleteWebhook handles DELETE /webhooks/{id}, dropping its pending
+// deliveries.
+func (h *WebhookHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	if err := h.webhooks.Delete(mux.Vars(r)["id"]); err != nil {
+		httpError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListDeliveries handles GET /webhooks/{id}/deliveries, the webhook's
+// delivery log, newest first.
+func (h *WebhookHandler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	deliveries, err := h.webhooks.Deliveries(mux.Vars(r)["id"])
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, deliveries)
+}
+
+// ListDeadLetters handles GET /webhooks/dead-letters, the deliveries that
+// failed every attempt, oldest first.
+func (h *WebhookHandler) ListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.webhooks.DeadLetters())
+}
+
+// RetryDeadLetter handles POST /webhooks/dead-letters/{delivery}/retry,
+// queueing a dead delivery again.
+func (h *WebhookHandler) RetryDeadLetter(w http.ResponseWriter, r *http.Request) {
+	delivery, err := h.webhooks.Redeliver(mux.Vars(r)["delivery"])
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, delivery)
+}
+
+// DiscardDeadLetter handles DELETE /webhooks/dead-letters/{delivery}.
+func (h *WebhookHandler) DiscardDeadLetter(w http.ResponseWriter, r *http.Request) {
+	if err := h.webhooks.Discard(mux.Vars(r)["delivery"]); err != nil {
+		httpError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
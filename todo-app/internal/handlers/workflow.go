@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// TransitionTodo handles POST /todos/{id}/{action}, e.g. /todos/{id}/start.
+// The optional body {"reason": "..."} explains the change. If-Match works as
+// for PUT.
+func (h *TodoHandler) TransitionTodo(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	expectedVersion, err := parseIfMatch(r.Header.Get("If-Match"))
+	if err != nil {
+		badRequest(w, r, err.Error())
+		return
+	}
+
+	var request struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		badRequest(w, r, "Invalid JSON")
+		return
+	}
+
+	todo, err := h.service.Transition(r.Context(), vars["id"], expectedVersion, vars["action"], request.Reason)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(todo))
+	json.NewEncoder(w).Encode(todo)
+}
+
+// GetWorkflow handles GET /workflow, describing the statuses and actions
+// todos follow.
+func (h *TodoHandler) GetWorkflow(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.service.Workflow().Config())
+}
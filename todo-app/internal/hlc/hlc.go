@@ -0,0 +1,130 @@
+// Package hlc implements hybrid logical clocks. A timestamp pairs a wall
+// clock reading with a logical counter that orders events within the same
+// millisecond, and with the node that made it, so timestamps from different
+// machines can be compared even when their clocks disagree a little: a node
+// that sees a timestamp from the future moves its own clock past it.
+package hlc
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxDrift is how far ahead of the local clock a remote timestamp may be.
+// Accepting timestamps from further in the future would let a node with a
+// wrong clock win every conflict until the real time caught up.
+const MaxDrift = 5 * time.Minute
+
+// ErrDrift is returned for a remote timestamp more than MaxDrift ahead.
+var ErrDrift = errors.New("timestamp is too far in the future")
+
+// Timestamp is a point in hybrid logical time. The zero value is earlier than
+// every other timestamp.
+type Timestamp struct {
+	// Wall is the wall clock time in Unix milliseconds.
+	Wall int64
+	// Logical orders timestamps with the same Wall.
+	Logical uint32
+	// Node breaks ties between nodes.
+	Node string
+}
+
+// Compare returns -1, 0 or +1 as t is before, equal to or after u.
+func (t Timestamp) Compare(u Timestamp) int {
+	switch {
+	case t.Wall != u.Wall:
+		return cmp.Compare(t.Wall, u.Wall)
+	case t.Logical != u.Logical:
+		return cmp.Compare(t.Logical, u.Logical)
+	}
+	return strings.Compare(t.Node, u.Node)
+}
+
+func (t Timestamp) IsZero() bool {
+	return t == Timestamp{}
+}
+
+// String formats t as "<wall>.<logical>@<node>", e.g.
+// "1760788127038.2@laptop".
+func (t Timestamp) String() string {
+	return strconv.FormatInt(t.Wall, 10) + "." + strconv.FormatUint(uint64(t.Logical), 10) + "@" + t.Node
+}
+
+// Parse parses a timestamp formatted by String.
+func Parse(s string) (Timestamp, error) {
+	clock, node, ok := strings.Cut(s, "@")
+	wall, logical, ok2 := strings.Cut(clock, ".")
+	if !ok || !ok2 || node == "" {
+		return Timestamp{}, fmt.Errorf("invalid timestamp %q (want <unix ms>.<counter>@<node>)", s)
+	}
+	w, err := strconv.ParseInt(wall, 10, 64)
+	if err != nil || w < 0 {
+		return Timestamp{}, fmt.Errorf("invalid timestamp %q: bad wall time", s)
+	}
+	l, err := strconv.ParseUint(logical, 10, 32)
+	if err != nil {
+		return Timestamp{}, fmt.Errorf("invalid timestamp %q: bad counter", s)
+	}
+	return Timestamp{Wall: w, Logical: uint32(l), Node: node}, nil
+}
+
+func (t Timestamp) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+func (t *Timestamp) UnmarshalText(text []byte) error {
+	parsed, err := Parse(string(text))
+	if err != nil {
+		return err
+	}
+	*t = parsed
+	return nil
+}
+
+// Clock issues timestamps for one node.
+type Clock struct {
+	node string
+	now  func() time.Time
+
+	mu   sync.Mutex
+	last Timestamp
+}
+
+// NewClock creates the clock of the named node.
+func NewClock(node string) *Clock {
+	return &Clock{node: node, now: time.Now, last: Timestamp{Node: node}}
+}
+
+// Now returns a timestamp after every one the clock issued or observed.
+func (c *Clock) Now() Timestamp {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	wall := c.now().UnixMilli()
+	if wall > c.last.Wall {
+		c.last = Timestamp{Wall: wall, Node: c.node}
+	} else {
+		c.last.Logical++
+	}
+	return c.last
+}
+
+// Observe moves the clock past a timestamp received from another node, so
+// that timestamps issued afterwards are later than it. Timestamps more than
+// MaxDrift ahead of the local wall clock are refused with ErrDrift.
+func (c *Clock) Observe(remote Timestamp) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	wall := c.now().UnixMilli()
+	if remote.Wall > wall+MaxDrift.Milliseconds() {
+		return ErrDrift
+	}
+	if remote.Wall > c.last.Wall || (remote.Wall == c.last.Wall && remote.Logical > c.last.Logical) {
+		c.last = Timestamp{Wall: remote.Wall, Logical: remote.Logical, Node: c.node}
+	}
+	return nil
+}
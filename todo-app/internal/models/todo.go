@@ -1,8 +1,14 @@
 package models
 
 import (
+    "fmt"
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
     "time"
     "github.com/google/uuid"
+    "todo-app/internal/hlc"
 )
 
 type Status string
@@ -13,14 +19,219 @@ const (
     StatusCompleted Status = "completed"
 )
 
+// Priority orders todos by urgency. The zero value is PriorityNone, and
+// priorities are written as their names in JSON.
+type Priority int
+
+const (
+    PriorityNone Priority = iota
+    PriorityLow
+    PriorityMedium
+    PriorityHigh
+    PriorityUrgent
+)
+
+var priorityNames = []string{"none", "low", "medium", "high", "urgent"}
+
+// Priorities lists every priority, lowest first.
+func Priorities() []Priority {
+    return []Priority{PriorityNone, PriorityLow, PriorityMedium, PriorityHigh, PriorityUrgent}
+}
+
+func (p Priority) String() string {
+    if p < 0 || int(p) >= len(priorityNames) {
+        return fmt.Sprintf("Priority(%d)", int(p))
+    }
+    return priorityNames[p]
+}
+
+// ParsePriority parses a priority name such as "high".
+func ParsePriority(name string) (Priority, error) {
+    for i, n := range priorityNames {
+        if n == name {
+            return Priority(i), nil
+        }
+    }
+    return PriorityNone, fmt.Errorf("unknown priority %q (want none, low, medium, high or urgent)", name)
+}
+
+func (p Priority) MarshalText() ([]byte, error) {
+    if p < 0 || int(p) >= len(priorityNames) {
+        return nil, fmt.Errorf("invalid priority %d", int(p))
+    }
+    return []byte(priorityNames[p]), nil
+}
+
+func (p *Priority) UnmarshalText(text []byte) error {
+    parsed, err := ParsePriority(string(text))
+    if err != nil {
+        return err
+    }
+    *p = parsed
+    return nil
+}
+
 type Todo struct {
-    ID          string    `json:"id"`
-    Title       string    `json:"title" validate:"required,min=1,max=255"`
-    Description string    `json:"description,omitempty"`
-    Status      Status    `json:"status"`
-    DueDate     time.Time `json:"due_date,omitempty"`
-    CreatedAt   time.Time `json:"created_at"`
-    UpdatedAt   time.Time `json:"updated_at"`
+    ID           string      `json:"id"`
+    Title        string      `json:"title" validate:"required,min=1,max=255"`
+    Description  string      `json:"description,omitempty"`
+    Status       Status      `json:"status" validate:"required"`
+    DueDate      time.Time   `json:"due_date,omitempty"`
+    Priority     Priority    `json:"priority"`
+    // Tags are lowercase labels such as "backend", kept sorted and unique.
+    Tags         []string    `json:"tags,omitempty" validate:"max=20"`
+    // ParentID is the todo this one is a subtask of, or empty for a
+    // top-level todo.
+    ParentID     string      `json:"parent_id,omitempty"`
+    // AutoComplete completes the todo once all of its subtasks are done.
+    AutoComplete bool        `json:"auto_complete,omitempty"`
+    // BlockedBy holds the IDs of the todos that must be done before this one
+    // can be worked on, kept sorted and unique.
+    BlockedBy    []string    `json:"blocked_by,omitempty" validate:"max=100"`
+    // Recurrence makes the todo repeat: completing it creates the next
+    // occurrence.
+    Recurrence   *Recurrence `json:"recurrence,omitempty"`
+    // Reminders say how long before the due date to send reminders, kept
+    // sorted and unique.
+    Reminders    []Reminder  `json:"reminders,omitempty" validate:"max=10"`
+    // Position orders todos on a board: lower comes first. New todos are
+    // placed after all others, and moving a todo only changes its own
+    // position.
+    Position     int64       `json:"position"`
+    CreatedAt    time.Time   `json:"created_at"`
+    UpdatedAt    time.Time   `json:"updated_at"`
+    // Version increases by one on every update. Storage rejects an update
+    // whose Version no longer matches the stored one.
+    Version      int64       `json:"version"`
+    // Clocks record when each field was last changed, by field name, so that
+    // edits made offline can be merged field by field. A field not listed
+    // has not changed since the todo was created. Like Seq, they are kept
+    // by storage but left out of the todo's JSON.
+    Clocks       map[string]hlc.Timestamp `json:"-"`
+    // Seq is the storage's change sequence number as of the todo's last
+    // save.
+    Seq          int64       `json:"-"`
+}
+
+// Recurrence describes how a todo repeats.
+type Recurrence struct {
+    // Rule is an RFC 5545 RRULE such as "FREQ=WEEKLY;BYDAY=MO".
+    Rule     string    `json:"rule"`
+    // TimeZone is the IANA time zone the rule is evaluated in, so that a
+    // todo due at 09:00 stays due at 09:00 local time across daylight saving
+    // time changes. Empty means UTC.
+    TimeZone string    `json:"time_zone,omitempty"`
+    // Start is the due date of the first occurrence, which the rule counts
+    // and steps from (DTSTART in RFC 5545).
+    Start    time.Time `json:"start"`
+    // NextID is the todo created for the next occurrence once this one was
+    // done. It is set by the service.
+    NextID   string    `json:"next_id,omitempty"`
+}
+
+// Reminder is how long before its due date a todo should be reminded of. It
+// is written like "1d", "2h30m" or "1w" in JSON; "0" reminds when the todo
+// falls due.
+type Reminder time.Duration
+
+var reminderUnits = []struct {
+    name  string
+    words []string
+    size  time.Duration
+}{
+    {"w", []string{"w", "week", "weeks"}, 7 * 24 * time.Hour},
+    {"d", []string{"d", "day", "days"}, 24 * time.Hour},
+    {"h", []string{"h", "hr", "hrs", "hour", "hours"}, time.Hour},
+    {"m", []string{"m", "min", "mins", "minute", "minutes"}, time.Minute},
+}
+
+var reminderPart = regexp.MustCompile(`^(\d+)\s*([a-z]+)\s*(?:,\s*|and\s+)?`)
+
+// ParseReminder parses a reminder such as "1d", "2h30m", "1 day" or
+// "1 week and 2 days before".
+func ParseReminder(s string) (Reminder, error) {
+    text := strings.TrimSpace(strings.TrimSuffix(strings.ToLower(strings.TrimSpace(s)), "before"))
+    switch text {
+    case "0":
+        return 0, nil
+    case "":
+        return 0, fmt.Errorf("invalid reminder %q", s)
+    }
+    var total time.Duration
+    rest := text
+    for rest != "" {
+        m := reminderPart.FindStringSubmatch(rest)
+        if m == nil {
+            return 0, fmt.Errorf("invalid reminder %q (want e.g. \"1d\", \"2h30m\" or \"1 day before\")", s)
+        }
+        n, err := strconv.Atoi(m[1])
+        size := reminderUnit(m[2])
+        if err != nil || size == 0 {
+            return 0, fmt.Errorf("invalid reminder %q (units are w, d, h and m)", s)
+        }
+        total += time.Duration(n) * size
+        rest = rest[len(m[0]):]
+    }
+    return Reminder(total), nil
+}
+
+func reminderUnit(word string) time.Duration {
+    for _, u := range reminderUnits {
+        for _, w := range u.words {
+            if w == word {
+                return u.size
+            }
+        }
+    }
+    return 0
+}
+
+// String formats r in weeks, days, hours and minutes, e.g. "1d12h".
+func (r Reminder) String() string {
+    d := time.Duration(r)
+    if d <= 0 {
+        return "0"
+    }
+    var b strings.Builder
+    for _, u := range reminderUnits {
+        if n := d / u.size; n > 0 {
+            fmt.Fprintf(&b, "%d%s", n, u.name)
+            d -= n * u.size
+        }
+    }
+    if b.Len() == 0 {
+        // Less than a minute.
+        return d.String()
+    }
+    return b.String()
+}
+
+func (r Reminder) MarshalText() ([]byte, error) {
+    return []byte(r.String()), nil
+}
+
+func (r *Reminder) UnmarshalText(text []byte) error {
+    parsed, err := ParseReminder(string(text))
+    if err != nil {
+        return err
+    }
+    *r = parsed
+    return nil
+}
+
+// NormalizeReminders returns reminders sorted from the one sent closest to
+// the due date to the earliest, without duplicates.
+func NormalizeReminders(reminders []Reminder) []Reminder {
+    seen := make(map[Reminder]bool, len(reminders))
+    var out []Reminder
+    for _, r := range reminders {
+        if !seen[r] {
+            seen[r] = true
+            out = append(out, r)
+        }
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+    return out
 }
 
 func NewTodo(title, description string, dueDate time.Time) *Todo {
@@ -33,5 +244,84 @@ func NewTodo(title, description string, dueDate time.Time) *Todo {
         DueDate:     dueDate,
         CreatedAt:   now,
         UpdatedAt:   now,
+        Version:     1,
+    }
+}
+
+// Clone returns a copy of t that shares no mutable state with it.
+func (t *Todo) Clone() *Todo {
+    c := *t
+    if t.Tags != nil {
+        c.Tags = append([]string(nil), t.Tags...)
+    }
+    if t.BlockedBy != nil {
+        c.BlockedBy = append([]string(nil), t.BlockedBy...)
+    }
+    if t.Recurrence != nil {
+        r := *t.Recurrence
+        c.Recurrence = &r
+    }
+    if t.Reminders != nil {
+        c.Reminders = append([]Reminder(nil), t.Reminders...)
+    }
+    if t.Clocks != nil {
+        c.Clocks = make(map[string]hlc.Timestamp, len(t.Clocks))
+        for field, ts := range t.Clocks {
+            c.Clocks[field] = ts
+        }
+    }
+    return &c
+}
+
+// NormalizeTags lowercases and trims tags and returns them sorted without
+// duplicates or empty entries.
+func NormalizeTags(tags []string) []string {
+    seen := make(map[string]bool, len(tags))
+    var out []string
+    for _, tag := range tags {
+        tag = strings.ToLower(strings.TrimSpace(tag))
+        if tag == "" || seen[tag] {
+            continue
+        }
+        seen[tag] = true
+        out = append(out, tag)
+    }
+    sort.Strings(out)
+    return out
+}
+
+// NormalizeIDs returns ids sorted without duplicates or empty entries.
+func NormalizeIDs(ids []string) []string {
+    seen := make(map[string]bool, len(ids))
+    var out []string
+    for _, id := range ids {
+        id = strings.TrimSpace(id)
+        if id == "" || seen[id] {
+            continue
+        }
+        seen[id] = true
+        out = append(out, id)
+    }
+    sort.Strings(out)
+    return out
+}
+
+// IsBlockedBy reports whether t waits for the todo with the given ID.
+func (t *Todo) IsBlockedBy(id string) bool {
+    for _, have := range t.BlockedBy {
+        if have == id {
+            return true
+        }
+    }
+    return false
+}
+
+// HasTag reports whether t is labelled with tag.
+func (t *Todo) HasTag(tag string) bool {
+    for _, have := range t.Tags {
+        if have == tag {
+            return true
+        }
     }
+    return false
 }
\ No newline at end of file
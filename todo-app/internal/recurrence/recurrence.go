@@ -0,0 +1,439 @@
+// Package recurrence implements the subset of RFC 5545 recurrence rules
+// (RRULE) that todos repeat by: FREQ, INTERVAL, BYDAY, COUNT, UNTIL and WKST.
+//
+// Occurrences are computed on the wall clock of the start time's location,
+// so a rule starting Monday 09:00 in Europe/Berlin stays at 09:00 local time
+// when daylight saving time begins or ends. A wall-clock time that does not
+// exist on a given day, such as 02:30 when clocks spring forward, is moved
+// forward by the length of the gap, as RFC 5545 prescribes.
+package recurrence
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Frequency is the unit a rule repeats in.
+type Frequency string
+
+const (
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+	Yearly  Frequency = "YEARLY"
+)
+
+// Weekday is a BYDAY entry such as "MO", "1MO" or "-1FR". N selects the Nth
+// such weekday of the month (or year) with MONTHLY (or YEARLY) rules, counted
+// from the end if negative; 0 means every one.
+type Weekday struct {
+	N   int
+	Day time.Weekday
+}
+
+var dayNames = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+func (d Weekday) String() string {
+	if d.N == 0 {
+		return dayNames[d.Day]
+	}
+	return strconv.Itoa(d.N) + dayNames[d.Day]
+}
+
+// until forms of UNTIL: a UTC date-time ("20261231T170000Z"), a floating
+// date-time in the rule's location ("20261231T170000") or a date that
+// includes the whole day ("20261231").
+type untilForm int
+
+const (
+	untilUTC untilForm = iota
+	untilLocal
+	untilDate
+)
+
+// Rule is a parsed recurrence rule.
+type Rule struct {
+	Freq     Frequency
+	Interval int
+	ByDay    []Weekday
+	// Count limits the number of occurrences, the start included; 0 means
+	// no limit.
+	Count int
+	// Until is the latest time an occurrence may have, or zero for no limit.
+	// Unless the rule gave it in UTC, only its wall-clock fields are used and
+	// they are read in the location the rule is evaluated in.
+	Until     time.Time
+	untilForm untilForm
+	WeekStart time.Weekday
+}
+
+// Parse parses a rule such as "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH". A leading
+// "RRULE:" is allowed. Names are case-insensitive.
+func Parse(s string) (*Rule, error) {
+	s = strings.TrimSpace(s)
+	if len(s) >= 6 && strings.EqualFold(s[:6], "RRULE:") {
+		s = s[6:]
+	}
+	if s == "" {
+		return nil, errors.New("rule is empty")
+	}
+
+	r := &Rule{Interval: 1, WeekStart: time.Monday}
+	seen := map[string]bool{}
+	for _, part := range strings.Split(s, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		name = strings.ToUpper(strings.TrimSpace(name))
+		value = strings.ToUpper(strings.TrimSpace(value))
+		if !ok || name == "" || value == "" {
+			return nil, fmt.Errorf("%q is not of the form NAME=VALUE", part)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("%s is given more than once", name)
+		}
+		seen[name] = true
+
+		var err error
+		switch name {
+		case "FREQ":
+			r.Freq, err = parseFreq(value)
+		case "INTERVAL":
+			r.Interval, err = parsePositive(name, value)
+		case "COUNT":
+			r.Count, err = parsePositive(name, value)
+		case "UNTIL":
+			r.Until, r.untilForm, err = parseUntil(value)
+		case "BYDAY":
+			r.ByDay, err = parseByDay(value)
+		case "WKST":
+			r.WeekStart, err = parseDay(value)
+		default:
+			err = fmt.Errorf("%s is not supported (use FREQ, INTERVAL, BYDAY, COUNT, UNTIL or WKST)", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if r.Freq == "" {
+		return nil, errors.New("FREQ is required")
+	}
+	if r.Count > 0 && !r.Until.IsZero() {
+		return nil, errors.New("COUNT and UNTIL cannot both be given")
+	}
+	for _, d := range r.ByDay {
+		switch {
+		case d.N == 0:
+		case r.Freq == Monthly && d.N >= -5 && d.N <= 5:
+		case r.Freq == Yearly && d.N >= -53 && d.N <= 53:
+		case r.Freq == Monthly || r.Freq == Yearly:
+			return nil, fmt.Errorf("BYDAY %s is out of range", d)
+		default:
+			return nil, fmt.Errorf("BYDAY %s: numbered weekdays need FREQ=MONTHLY or FREQ=YEARLY", d)
+		}
+	}
+	return r, nil
+}
+
+func parseFreq(value string) (Frequency, error) {
+	switch f := Frequency(value); f {
+	case Daily, Weekly, Monthly, Yearly:
+		return f, nil
+	case "SECONDLY", "MINUTELY", "HOURLY":
+		return "", fmt.Errorf("FREQ=%s is not supported; todos repeat at most daily", value)
+	}
+	return "", fmt.Errorf("FREQ %q is not one of DAILY, WEEKLY, MONTHLY or YEARLY", value)
+}
+
+func parsePositive(name, value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("%s must be a positive number", name)
+	}
+	return n, nil
+}
+
+func parseUntil(value string) (time.Time, untilForm, error) {
+	for _, f := range []struct {
+		layout string
+		form   untilForm
+	}{
+		{"20060102T150405Z", untilUTC},
+		{"20060102T150405", untilLocal},
+		{"20060102", untilDate},
+	} {
+		if t, err := time.Parse(f.layout, value); err == nil {
+			return t, f.form, nil
+		}
+	}
+	return time.Time{}, 0, fmt.Errorf("UNTIL %q is not a date (20261231) or date-time (20261231T170000Z)", value)
+}
+
+func parseByDay(value string) ([]Weekday, error) {
+	var days []Weekday
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) < 2 {
+			return nil, fmt.Errorf("BYDAY %q is not a weekday", item)
+		}
+		day, err := parseDay(item[len(item)-2:])
+		if err != nil {
+			return nil, err
+		}
+		d := Weekday{Day: day}
+		if prefix := item[:len(item)-2]; prefix != "" {
+			if d.N, err = strconv.Atoi(prefix); err != nil || d.N == 0 {
+				return nil, fmt.Errorf("BYDAY %q is not a weekday", item)
+			}
+		}
+		days = append(days, d)
+	}
+	return days, nil
+}
+
+func parseDay(value string) (time.Weekday, error) {
+	for i, name := range dayNames {
+		if value == name {
+			return time.Weekday(i), nil
+		}
+	}
+	return 0, fmt.Errorf("%q is not a weekday (use SU, MO, TU, WE, TH, FR or SA)", value)
+}
+
+// String formats r in the canonical form Parse accepts, leaving out defaults.
+func (r *Rule) String() string {
+	parts := []string{"FREQ=" + string(r.Freq)}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, d := range r.ByDay {
+			days[i] = d.String()
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		layout := map[untilForm]string{untilUTC: "20060102T150405Z", untilLocal: "20060102T150405", untilDate: "20060102"}[r.untilForm]
+		parts = append(parts, "UNTIL="+r.Until.Format(layout))
+	}
+	if r.WeekStart != time.Monday {
+		parts = append(parts, "WKST="+dayNames[r.WeekStart])
+	}
+	return strings.Join(parts, ";")
+}
+
+// Occurrence is one time a rule produces, numbered from 1 for the start.
+type Occurrence struct {
+	Number int
+	Time   time.Time
+}
+
+// Expand returns up to n occurrences of r for a series beginning at start
+// that come strictly after after; a zero after starts with start itself.
+// Occurrences are in start's location, and start always counts as the first
+// one, as RFC 5545 requires of DTSTART.
+func (r *Rule) Expand(start, after time.Time, n int) []Occurrence {
+	var out []Occurrence
+	it := r.iterate(start)
+	for len(out) < n {
+		o, ok := it.next()
+		if !ok {
+			break
+		}
+		if after.IsZero() || o.Time.After(after) {
+			out = append(out, o)
+		}
+	}
+	return out
+}
+
+// Next returns the first occurrence after after, if there is one.
+func (r *Rule) Next(start, after time.Time) (Occurrence, bool) {
+	next := r.Expand(start, after, 1)
+	if len(next) == 0 {
+		return Occurrence{}, false
+	}
+	return next[0], true
+}
+
+// maxEmptyPeriods is how many periods in a row may produce no occurrence
+// before a rule is taken to have none left, e.g. FREQ=DAILY;INTERVAL=7 with a
+// BYDAY its steps never land on.
+const maxEmptyPeriods = 1000
+
+type iterator struct {
+	rule    *Rule
+	start   time.Time
+	until   time.Time
+	count   int
+	period  int
+	empty   int
+	pending []time.Time
+	done    bool
+}
+
+func (r *Rule) iterate(start time.Time) *iterator {
+	it := &iterator{rule: r, start: start}
+	switch loc := start.Location(); {
+	case r.Until.IsZero():
+	case r.untilForm == untilUTC:
+		it.until = r.Until
+	case r.untilForm == untilLocal:
+		it.until = wallClock(r.Until, r.Until, loc)
+	default:
+		// The whole day is included: stop before the next one starts.
+		it.until = time.Date(r.Until.Year(), r.Until.Month(), r.Until.Day()+1, 0, 0, 0, 0, loc).Add(-time.Nanosecond)
+	}
+	return it
+}
+
+func (it *iterator) next() (Occurrence, bool) {
+	if it.done || (it.rule.Count > 0 && it.count >= it.rule.Count) {
+		return Occurrence{}, false
+	}
+	var t time.Time
+	if it.count == 0 {
+		t = it.start
+	} else {
+		for len(it.pending) == 0 {
+			if it.empty >= maxEmptyPeriods {
+				it.done = true
+				return Occurrence{}, false
+			}
+			for _, c := range it.candidates(it.period) {
+				if c.After(it.start) {
+					it.pending = append(it.pending, c)
+				}
+			}
+			if len(it.pending) == 0 {
+				it.empty++
+			} else {
+				it.empty = 0
+			}
+			it.period++
+		}
+		t, it.pending = it.pending[0], it.pending[1:]
+	}
+	if (!it.until.IsZero() && t.After(it.until)) || t.Year() > 9999 {
+		it.done = true
+		return Occurrence{}, false
+	}
+	it.count++
+	return Occurrence{Number: it.count, Time: t}, true
+}
+
+// candidates returns the occurrences in the kth period (day, week, month or
+// year, stepped by the interval) after the one start falls in, in order.
+func (it *iterator) candidates(k int) []time.Time {
+	r, s := it.rule, it.start
+	step := k * r.Interval
+	var days []time.Time // dates at midnight UTC
+	switch r.Freq {
+	case Daily:
+		day := date(s.Year(), s.Month(), s.Day()+step)
+		if len(r.ByDay) == 0 || r.onDay(day.Weekday()) {
+			days = append(days, day)
+		}
+	case Weekly:
+		offset := (int(s.Weekday()) - int(r.WeekStart) + 7) % 7
+		weekStart := date(s.Year(), s.Month(), s.Day()-offset+7*step)
+		for i := 0; i < 7; i++ {
+			day := weekStart.AddDate(0, 0, i)
+			if (len(r.ByDay) == 0 && day.Weekday() == s.Weekday()) || r.onDay(day.Weekday()) {
+				days = append(days, day)
+			}
+		}
+	case Monthly:
+		first := date(s.Year(), s.Month()+time.Month(step), 1)
+		last := first.AddDate(0, 1, -1)
+		if len(r.ByDay) == 0 {
+			if s.Day() <= last.Day() {
+				days = append(days, date(first.Year(), first.Month(), s.Day()))
+			}
+		} else {
+			days = r.byDayBetween(first, last)
+		}
+	case Yearly:
+		year := s.Year() + step
+		if len(r.ByDay) == 0 {
+			// February 29 only exists in leap years; other years are skipped.
+			if day := date(year, s.Month(), s.Day()); day.Day() == s.Day() {
+				days = append(days, day)
+			}
+		} else {
+			days = r.byDayBetween(date(year, time.January, 1), date(year, time.December, 31))
+		}
+	}
+
+	out := make([]time.Time, len(days))
+	for i, day := range days {
+		out[i] = wallClock(day, s, s.Location())
+	}
+	return out
+}
+
+func (r *Rule) onDay(day time.Weekday) bool {
+	for _, d := range r.ByDay {
+		if d.Day == day {
+			return true
+		}
+	}
+	return false
+}
+
+// byDayBetween returns the days from first to last, inclusive, that match
+// the rule's BYDAY entries, in order and without duplicates.
+func (r *Rule) byDayBetween(first, last time.Time) []time.Time {
+	seen := map[time.Time]bool{}
+	var days []time.Time
+	add := func(day time.Time) {
+		if !day.Before(first) && !day.After(last) && !seen[day] {
+			seen[day] = true
+			days = append(days, day)
+		}
+	}
+	for _, d := range r.ByDay {
+		switch {
+		case d.N > 0:
+			offset := (int(d.Day) - int(first.Weekday()) + 7) % 7
+			add(first.AddDate(0, 0, offset+7*(d.N-1)))
+		case d.N < 0:
+			offset := (int(last.Weekday()) - int(d.Day) + 7) % 7
+			add(last.AddDate(0, 0, -offset-7*(-d.N-1)))
+		default:
+			offset := (int(d.Day) - int(first.Weekday()) + 7) % 7
+			for day := first.AddDate(0, 0, offset); !day.After(last); day = day.AddDate(0, 0, 7) {
+				add(day)
+			}
+		}
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+	return days
+}
+
+// date returns a normalized calendar date at midnight UTC, where day
+// arithmetic is free of daylight saving time.
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// wallClock returns the date of day at the time of day of clock, in loc.
+func wallClock(day, clock time.Time, loc *time.Location) time.Time {
+	t := time.Date(day.Year(), day.Month(), day.Day(), clock.Hour(), clock.Minute(), clock.Second(), clock.Nanosecond(), loc)
+	if t.Hour() != clock.Hour() || t.Minute() != clock.Minute() {
+		// The wall-clock time fell into a gap when clocks moved forward.
+		// Go resolves it either side of the gap; RFC 5545 wants the time
+		// after it, the requested time plus the gap's length.
+		before := time.Date(day.Year(), day.Month(), day.Day(), clock.Hour(), clock.Minute(), clock.Second(), clock.Nanosecond(), time.UTC)
+		_, offset := t.Add(-24 * time.Hour).Zone()
+		t = before.Add(-time.Duration(offset) * time.Second).In(loc)
+	}
+	return t
+}
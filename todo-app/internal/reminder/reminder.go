@@ -0,0 +1,265 @@
+// Package reminder sends notifications when todos fall due, and ahead of
+// that at the offsets listed in their reminders (e.g. "1d" before). A
+// Scheduler inside the server watches the open todos and hands each
+// notification to every Notifier, recording what was sent in a Store so that
+// a restart neither repeats a notification nor skips one that fell due while
+// the server was down.
+package reminder
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"todo-app/internal/events"
+	"todo-app/internal/models"
+	"todo-app/internal/service"
+)
+
+// Notification is a reminder about one todo.
+type Notification struct {
+	// ID identifies the notification across restarts. It changes when the
+	// todo's due date does, so a moved todo is reminded of again.
+	ID   string       `json:"id"`
+	Todo *models.Todo `json:"todo"`
+	// Before is how long before the due date the notification is sent; 0
+	// for the one sent when the todo falls due.
+	Before models.Reminder `json:"before"`
+	// At is when the notification is due to be sent.
+	At time.Time `json:"at"`
+	// Message says how long until the todo is due, as of when the
+	// notification is sent.
+	Message string `json:"message"`
+}
+
+// notifications returns the notifications for a todo: one when it falls due
+// and one per reminder, earliest first.
+func notifications(todo *models.Todo) []Notification {
+	if todo.DueDate.IsZero() {
+		return nil
+	}
+	offsets := models.NormalizeReminders(append([]models.Reminder{0}, todo.Reminders...))
+	out := make([]Notification, 0, len(offsets))
+	for i := len(offsets) - 1; i >= 0; i-- {
+		before := offsets[i]
+		n := Notification{
+			ID:     todo.ID + "/" + strconv.FormatInt(todo.DueDate.UnixNano(), 10) + "/" + before.String(),
+			Todo:   todo,
+			Before: before,
+			At:     todo.DueDate.Add(-time.Duration(before)),
+		}
+		n.Message = message(todo, n.At)
+		out = append(out, n)
+	}
+	return out
+}
+
+// message describes how long until todo is due as of now. Notifications
+// sent late, e.g. after the server was down, say how late they are.
+func message(todo *models.Todo, now time.Time) string {
+	due := dueIn(todo).Format("Mon 2006-01-02 15:04 MST")
+	left := todo.DueDate.Sub(now).Round(time.Minute)
+	switch {
+	case left > 0:
+		return fmt.Sprintf("%q is due in %s (%s)", todo.Title, models.Reminder(left), due)
+	case left == 0:
+		return fmt.Sprintf("%q is due now (%s)", todo.Title, due)
+	}
+	return fmt.Sprintf("%q was due %s ago (%s)", todo.Title, models.Reminder(-left), due)
+}
+
+// dueIn returns a todo's due date in the time zone of its recurrence, if it
+// has one.
+func dueIn(todo *models.Todo) time.Time {
+	if todo.Recurrence != nil {
+		if loc, err := time.LoadLocation(todo.Recurrence.TimeZone); err == nil {
+			return todo.DueDate.In(loc)
+		}
+	}
+	return todo.DueDate
+}
+
+// Scheduler sends the notifications of open todos as they fall due.
+type Scheduler struct {
+	todos     *service.TodoService
+	store     Store
+	notifiers []Notifier
+	interval  time.Duration
+
+	mu    sync.Mutex // serializes checks
+	state *State
+	// wake tells Run to check before its next scheduled check.
+	wake chan struct{}
+}
+
+// New creates a scheduler that looks at the todos at least every interval,
+// and more often when a notification is due sooner.
+func New(todos *service.TodoService, store Store, interval time.Duration, notifiers ...Notifier) (*Scheduler, error) {
+	state, err := store.Load()
+	if err != nil {
+		return nil, fmt.Errorf("loading reminder state: %w", err)
+	}
+	if state == nil {
+		state = &State{Since: time.Now()}
+		if err := store.Save(state); err != nil {
+			return nil, fmt.Errorf("saving reminder state: %w", err)
+		}
+	}
+	if state.Sent == nil {
+		state.Sent = map[string]map[string]time.Time{}
+	}
+	return &Scheduler{todos: todos, store: store, notifiers: notifiers, interval: interval, state: state, wake: make(chan struct{}, 1)}, nil
+}
+
+// Subscribe makes the scheduler check as soon as a todo is created or changed
+// to have a notification due before the next check, so that it is not sent
+// up to an interval late.
+func (s *Scheduler) Subscribe(bus *events.Bus) *events.Subscription {
+	return bus.Subscribe("reminders", func(ctx context.Context, e events.Event) {
+		var todo *models.Todo
+		switch e := e.(type) {
+		case events.TodoCreated:
+			todo = e.Todo
+		case events.TodoUpdated:
+			todo = e.After
+		default:
+			return
+		}
+		soon := time.Now().Add(s.interval)
+		for _, n := range notifications(todo) {
+			if n.At.Before(soon) {
+				select {
+				case s.wake <- struct{}{}:
+				default:
+				}
+				return
+			}
+		}
+	})
+}
+
+// Run checks for due notifications until ctx is cancelled.
+func (s *Scheduler) Run(ctx context.Context) {
+	for {
+		next, err := s.check(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Reminders: %v", err)
+		}
+
+		wait := s.interval
+		if !next.IsZero() {
+			if d := time.Until(next); d < wait {
+				wait = d
+			}
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-s.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// check sends every notification that is due and not yet sent, and returns
+// when the next one is due (zero if none is). A notifier that fails is tried
+// again on the next check, at most an interval later.
+func (s *Scheduler) check(ctx context.Context) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	todos, err := s.todos.GetAllTodos(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	now := time.Now()
+	flow := s.todos.Workflow()
+
+	var next time.Time
+	current := map[string]bool{}
+	for _, todo := range todos {
+		done := flow.IsDone(todo.Status)
+		for _, n := range notifications(todo) {
+			// Done todos keep their records, so reopening one does not
+			// repeat what was already sent.
+			current[n.ID] = true
+			if done || n.At.Before(s.state.Since) {
+				continue
+			}
+			if n.At.After(now) {
+				if next.IsZero() || n.At.Before(next) {
+					next = n.At
+				}
+				continue
+			}
+			n.Message = message(todo, now)
+			for _, notifier := range s.notifiers {
+				if s.state.sent(notifier.Name(), n.ID) {
+					continue
+				}
+				if err := notify(ctx, notifier, n); err != nil {
+					log.Printf("Reminders: %s: %v", notifier.Name(), err)
+					continue
+				}
+				// Saved right away: a crash now repeats at most the
+				// notification in flight.
+				s.state.markSent(notifier.Name(), n.ID, time.Now())
+				if err := s.store.Save(s.state); err != nil {
+					return next, fmt.Errorf("saving reminder state: %w", err)
+				}
+			}
+		}
+	}
+
+	if s.state.prune(current) {
+		if err := s.store.Save(s.state); err != nil {
+			return next, fmt.Errorf("saving reminder state: %w", err)
+		}
+	}
+	return next, nil
+}
+
+// notifyTimeout bounds a single delivery, so that one hanging notifier does
+// not hold up the others.
+const notifyTimeout = 30 * time.Second
+
+func notify(ctx context.Context, notifier Notifier, n Notification) error {
+	ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+	return notifier.Notify(ctx, n)
+}
+
+// Upcoming lists the notifications of open todos due within the given time
+// from now, soonest first.
+func (s *Scheduler) Upcoming(ctx context.Context, within time.Duration) ([]Notification, error) {
+	todos, err := s.todos.GetAllTodos(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	var upcoming []Notification
+	for _, todo := range todos {
+		if s.todos.Workflow().IsDone(todo.Status) {
+			continue
+		}
+		for _, n := range notifications(todo) {
+			if n.At.After(now) && !n.At.After(now.Add(within)) {
+				upcoming = append(upcoming, n)
+			}
+		}
+	}
+	sort.Slice(upcoming, func(i, j int) bool {
+		if !upcoming[i].At.Equal(upcoming[j].At) {
+			return upcoming[i].At.Before(upcoming[j].At)
+		}
+		return upcoming[i].ID < upcoming[j].ID
+	})
+	return upcoming, nil
+}
@@ -0,0 +1,59 @@
+package reminder
+
+import (
+	"time"
+
+	"todo-app/internal/statestore"
+)
+
+// State records which notifications each notifier has been sent, so that a
+// restarted scheduler neither repeats nor skips any.
+type State struct {
+	// Since is when the scheduler first ran. Notifications that were due
+	// before it are never sent, so turning reminders on does not announce
+	// every todo that was ever overdue.
+	Since time.Time `json:"since"`
+	// Sent maps a notifier name to the IDs of the notifications it was sent
+	// and when.
+	Sent map[string]map[string]time.Time `json:"sent"`
+}
+
+func (st *State) sent(notifier, id string) bool {
+	_, ok := st.Sent[notifier][id]
+	return ok
+}
+
+func (st *State) markSent(notifier, id string, at time.Time) {
+	if st.Sent[notifier] == nil {
+		st.Sent[notifier] = map[string]time.Time{}
+	}
+	st.Sent[notifier][id] = at
+}
+
+// prune forgets the notifications that are not in current, i.e. those of
+// deleted todos and of due dates that have since moved. It reports whether
+// anything was forgotten.
+func (st *State) prune(current map[string]bool) bool {
+	pruned := false
+	for name, ids := range st.Sent {
+		for id := range ids {
+			if !current[id] {
+				delete(ids, id)
+				pruned = true
+			}
+		}
+		if len(ids) == 0 {
+			delete(st.Sent, name)
+		}
+	}
+	return pruned
+}
+
+// Store loads and saves the scheduler's State.
+type Store = statestore.Store[State]
+
+// FileStore records the sent notifications in a JSON file.
+type FileStore = statestore.File[State]
+
+// MemoryStore records the sent notifications for as long as the server runs.
+type MemoryStore = statestore.Memory[State]
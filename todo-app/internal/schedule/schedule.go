@@ -0,0 +1,203 @@
+// Package schedule plans work on todos that depend on each other: it orders
+// them so every todo comes after the todos it is blocked by, and finds the
+// critical path, the longest chain of todos each waiting for the one before.
+package schedule
+
+import (
+	"container/heap"
+	"sort"
+	"time"
+
+	"todo-app/internal/models"
+)
+
+// Item is a planned todo. Deadline is the earliest due date of the todo and
+// of every todo that waits for it, directly or not, since none of those can
+// be finished before this one is; it is zero if none of them is due.
+type Item struct {
+	Todo     *models.Todo
+	Deadline time.Time
+}
+
+// Plan is the result of Build.
+type Plan struct {
+	// Order lists the todos so that each comes after its blockers. Of the
+	// todos that could go next, the one with the earliest deadline goes
+	// first, then the most urgent, then the oldest.
+	Order []Item
+	// CriticalPath is the longest chain of todos in which each is blocked
+	// by the one before it, or nil if no todo is blocked. Of equally long
+	// chains, the one ending with the earliest deadline is chosen.
+	CriticalPath []Item
+	// Cyclic lists the todos that cannot be ordered because their
+	// dependencies form a cycle. They are left out of Order.
+	Cyclic []Item
+}
+
+type node struct {
+	item       Item
+	blockers   []*node
+	dependents []*node
+	waiting    int // blockers not yet ordered
+	length     int // todos in the longest chain ending here
+	prev       *node
+}
+
+// Build plans todos. Blockers that are not among todos, such as finished or
+// deleted ones, are ignored.
+func Build(todos []*models.Todo) *Plan {
+	nodes := make(map[string]*node, len(todos))
+	all := make([]*node, 0, len(todos))
+	for _, todo := range todos {
+		n := &node{item: Item{Todo: todo, Deadline: todo.DueDate}}
+		nodes[todo.ID] = n
+		all = append(all, n)
+	}
+	edges := 0
+	for _, n := range all {
+		for _, id := range n.item.Todo.BlockedBy {
+			if b, ok := nodes[id]; ok && b != n {
+				n.blockers = append(n.blockers, b)
+				b.dependents = append(b.dependents, n)
+				edges++
+			}
+		}
+	}
+
+	// A first pass in any topological order finds the deadlines, which
+	// flow backwards from dependents to their blockers.
+	topo := topological(all, func(a, b *node) bool { return a.item.Todo.ID < b.item.Todo.ID })
+	for i := len(topo) - 1; i >= 0; i-- {
+		n := topo[i]
+		for _, d := range n.dependents {
+			n.item.Deadline = earliest(n.item.Deadline, d.item.Deadline)
+		}
+	}
+
+	plan := &Plan{}
+	for _, n := range topological(all, before) {
+		plan.Order = append(plan.Order, n.item)
+	}
+
+	ordered := make(map[*node]bool, len(topo))
+	for _, n := range topo {
+		ordered[n] = true
+	}
+	var cyclic []*node
+	for _, n := range all {
+		if !ordered[n] {
+			cyclic = append(cyclic, n)
+		}
+	}
+	sort.Slice(cyclic, func(i, j int) bool { return before(cyclic[i], cyclic[j]) })
+	for _, n := range cyclic {
+		plan.Cyclic = append(plan.Cyclic, n.item)
+	}
+
+	if edges > 0 {
+		plan.CriticalPath = criticalPath(topo)
+	}
+	return plan
+}
+
+// criticalPath finds the longest chain through nodes, which must be in
+// topological order.
+func criticalPath(topo []*node) []Item {
+	var end *node
+	for _, n := range topo {
+		n.length = 1
+		for _, b := range n.blockers {
+			if b.length+1 > n.length || (b.length+1 == n.length && before(b, n.prev)) {
+				n.length = b.length + 1
+				n.prev = b
+			}
+		}
+		if end == nil || n.length > end.length || (n.length == end.length && before(n, end)) {
+			end = n
+		}
+	}
+	if end == nil || end.length < 2 {
+		return nil
+	}
+
+	path := make([]Item, end.length)
+	for i, n := end.length-1, end; n != nil; i, n = i-1, n.prev {
+		path[i] = n.item
+	}
+	return path
+}
+
+// topological orders nodes with Kahn's algorithm, choosing the least ready
+// node under less at every step. Nodes on a cycle are left out.
+func topological(nodes []*node, less func(a, b *node) bool) []*node {
+	ready := &queue{less: less}
+	for _, n := range nodes {
+		n.waiting = len(n.blockers)
+		if n.waiting == 0 {
+			ready.nodes = append(ready.nodes, n)
+		}
+	}
+	heap.Init(ready)
+
+	var order []*node
+	for ready.Len() > 0 {
+		n := heap.Pop(ready).(*node)
+		order = append(order, n)
+		for _, d := range n.dependents {
+			if d.waiting--; d.waiting == 0 {
+				heap.Push(ready, d)
+			}
+		}
+	}
+	return order
+}
+
+// before orders todos that are equally ready: earliest deadline first (todos
+// without one last), then the most urgent, then the oldest. A nil node comes
+// last.
+func before(a, b *node) bool {
+	if b == nil {
+		return a != nil
+	}
+	if a == nil {
+		return false
+	}
+	ad, bd := a.item.Deadline, b.item.Deadline
+	switch {
+	case ad.IsZero() != bd.IsZero():
+		return !ad.IsZero()
+	case !ad.Equal(bd):
+		return ad.Before(bd)
+	}
+	at, bt := a.item.Todo, b.item.Todo
+	switch {
+	case at.Priority != bt.Priority:
+		return at.Priority > bt.Priority
+	case !at.CreatedAt.Equal(bt.CreatedAt):
+		return at.CreatedAt.Before(bt.CreatedAt)
+	}
+	return at.ID < bt.ID
+}
+
+// earliest returns the earlier of two times, treating zero as unset.
+func earliest(a, b time.Time) time.Time {
+	if a.IsZero() || (!b.IsZero() && b.Before(a)) {
+		return b
+	}
+	return a
+}
+
+type queue struct {
+	nodes []*node
+	less  func(a, b *node) bool
+}
+
+func (q *queue) Len() int           { return len(q.nodes) }
+func (q *queue) Less(i, j int) bool { return q.less(q.nodes[i], q.nodes[j]) }
+func (q *queue) Swap(i, j int)      { q.nodes[i], q.nodes[j] = q.nodes[j], q.nodes[i] }
+func (q *queue) Push(x interface{}) { q.nodes = append(q.nodes, x.(*node)) }
+func (q *queue) Pop() interface{} {
+	n := q.nodes[len(q.nodes)-1]
+	q.nodes = q.nodes[:len(q.nodes)-1]
+	return n
+}
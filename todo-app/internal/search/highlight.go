@@ -0,0 +1,90 @@
+package search
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+// Highlight returns text as HTML with every occurrence of one of terms wrapped
+// in <mark></mark>, or "" if no term occurs. With maxWords > 0 a longer text
+// is cut down to a window of about maxWords words around the first match,
+// with "…" marking the cuts.
+func Highlight(text string, terms []string, maxWords int) string {
+	want := make(map[string]bool, len(terms))
+	for _, t := range terms {
+		want[t] = true
+	}
+
+	type span struct {
+		start, end int
+		match      bool
+	}
+	var words []span
+	first := -1
+	inWord := false
+	for i, r := range text {
+		isWord := unicode.IsLetter(r) || unicode.IsNumber(r)
+		switch {
+		case isWord && !inWord:
+			words = append(words, span{start: i})
+		case !isWord && inWord:
+			words[len(words)-1].end = i
+		}
+		inWord = isWord
+	}
+	if inWord {
+		words[len(words)-1].end = len(text)
+	}
+	for i := range words {
+		w := &words[i]
+		w.match = want[strings.ToLower(text[w.start:w.end])]
+		if w.match && first < 0 {
+			first = i
+		}
+	}
+	if first < 0 {
+		return ""
+	}
+
+	from, to := 0, len(text)
+	lo, hi := 0, len(words)
+	if maxWords > 0 && len(words) > maxWords {
+		lo = first - maxWords/3
+		if lo < 0 {
+			lo = 0
+		}
+		hi = lo + maxWords
+		if hi > len(words) {
+			hi = len(words)
+			lo = hi - maxWords
+		}
+		if lo > 0 {
+			from = words[lo].start
+		}
+		if hi < len(words) {
+			to = words[hi-1].end
+		}
+	}
+
+	var sb strings.Builder
+	if from > 0 {
+		sb.WriteString("…")
+	}
+	pos := from
+	for _, w := range words[lo:hi] {
+		if !w.match {
+			continue
+		}
+		sb.WriteString(html.EscapeString(text[pos:w.start]))
+		sb.WriteString("<mark>")
+		sb.WriteString(html.EscapeString(text[w.start:w.end]))
+		sb.WriteString("</mark>")
+		pos = w.end
+	}
+	sb.WriteString(html.EscapeString(text[pos:to]))
+	if to < len(text) {
+		sb.WriteString("…")
+	}
+	return sb.String()
+}
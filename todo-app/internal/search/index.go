@@ -0,0 +1,175 @@
+// Package search implements full-text search over todo titles and
+// descriptions: an inverted index ranked with BM25, and highlighting of the
+// matched terms.
+package search
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// BM25 parameters. Title matches weigh twice as much as description matches.
+const (
+	k1 = 1.2
+	b  = 0.75
+
+	TitleWeight       = 2.0
+	DescriptionWeight = 1.0
+)
+
+type field int
+
+const (
+	fieldTitle field = iota
+	fieldDescription
+	numFields
+)
+
+var weights = [numFields]float64{TitleWeight, DescriptionWeight}
+
+// Tokenize splits text into lowercase terms at anything that is not a letter
+// or a digit.
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// Terms returns the distinct terms of a query in order of appearance.
+func Terms(query string) []string {
+	var terms []string
+	seen := make(map[string]bool)
+	for _, t := range Tokenize(query) {
+		if !seen[t] {
+			seen[t] = true
+			terms = append(terms, t)
+		}
+	}
+	return terms
+}
+
+type document struct {
+	freqs  [numFields]map[string]int
+	length [numFields]int
+}
+
+// Index is an inverted index of todos. It is not safe for concurrent use;
+// storage backends guard it with the same lock as their todos.
+type Index struct {
+	docs     map[string]*document
+	postings map[string]map[string]struct{} // term -> ids of todos containing it
+	totalLen [numFields]int
+}
+
+func NewIndex() *Index {
+	return &Index{
+		docs:     make(map[string]*document),
+		postings: make(map[string]map[string]struct{}),
+	}
+}
+
+// Hit is a todo matching a search, with its relevance score.
+type Hit struct {
+	ID    string
+	Score float64
+}
+
+// Put indexes a todo's text, replacing whatever was indexed for id before.
+func (x *Index) Put(id, title, description string) {
+	x.Remove(id)
+
+	doc := &document{}
+	for f, text := range [numFields]string{title, description} {
+		tokens := Tokenize(text)
+		doc.freqs[f] = make(map[string]int)
+		doc.length[f] = len(tokens)
+		x.totalLen[f] += len(tokens)
+		for _, t := range tokens {
+			doc.freqs[f][t]++
+			if x.postings[t] == nil {
+				x.postings[t] = make(map[string]struct{})
+			}
+			x.postings[t][id] = struct{}{}
+		}
+	}
+	x.docs[id] = doc
+}
+
+// Remove drops a todo from the index. Unknown ids are ignored.
+func (x *Index) Remove(id string) {
+	doc, ok := x.docs[id]
+	if !ok {
+		return
+	}
+	for f := range doc.freqs {
+		x.totalLen[f] -= doc.length[f]
+		for t := range doc.freqs[f] {
+			delete(x.postings[t], id)
+			if len(x.postings[t]) == 0 {
+				delete(x.postings, t)
+			}
+		}
+	}
+	delete(x.docs, id)
+}
+
+// Search returns the todos containing every term of query, best match first.
+// Ties are broken by id so results are stable.
+func (x *Index) Search(query string) []Hit {
+	terms := Terms(query)
+	if len(terms) == 0 {
+		return nil
+	}
+
+	// Walk the rarest term's postings and check the others.
+	sort.Slice(terms, func(i, j int) bool {
+		return len(x.postings[terms[i]]) < len(x.postings[terms[j]])
+	})
+	var hits []Hit
+	for id := range x.postings[terms[0]] {
+		matchesAll := true
+		for _, t := range terms[1:] {
+			if _, ok := x.postings[t][id]; !ok {
+				matchesAll = false
+				break
+			}
+		}
+		if matchesAll {
+			hits = append(hits, Hit{ID: id, Score: x.score(x.docs[id], terms)})
+		}
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID < hits[j].ID
+	})
+	return hits
+}
+
+// score is the BM25 score of doc for terms, summed over fields with each
+// field's weight.
+func (x *Index) score(doc *document, terms []string) float64 {
+	n := float64(len(x.docs))
+	var score float64
+	for _, t := range terms {
+		df := float64(len(x.postings[t]))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for f := field(0); f < numFields; f++ {
+			tf := float64(doc.freqs[f][t])
+			if tf == 0 {
+				continue
+			}
+			avgLen := float64(x.totalLen[f]) / n
+			norm := 1 - b
+			if avgLen > 0 {
+				norm += b * float64(doc.length[f]) / avgLen
+			}
+			score += weights[f] * idf * tf * (k1 + 1) / (tf + k1*norm)
+		}
+	}
+	return score
+}
@@ -0,0 +1,223 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"todo-app/internal/apperr"
+	"todo-app/internal/filter"
+	"todo-app/internal/models"
+	"todo-app/internal/schedule"
+	"todo-app/internal/storage"
+	"todo-app/internal/validation"
+	"todo-app/internal/workflow"
+)
+
+// ErrBlocked is returned when an action that requires an unblocked todo is
+// attempted while some of the todo's blockers are still open.
+var ErrBlocked = apperr.New(apperr.Conflict, "todo_blocked", "todo is blocked")
+
+// Dependencies are the todos a todo is blocked by and the todos it blocks,
+// oldest first.
+type Dependencies struct {
+	BlockedBy []*models.Todo
+	Blocks    []*models.Todo
+}
+
+// Dependencies returns the direct dependencies of a todo in both directions.
+func (s *TodoService) Dependencies(ctx context.Context, id string) (*Dependencies, error) {
+	todo, err := s.storage.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	blockers, err := s.blockers(ctx, todo)
+	if err != nil {
+		return nil, err
+	}
+	dependents, err := s.dependents(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &Dependencies{BlockedBy: blockers, Blocks: dependents}, nil
+}
+
+// blockers loads the todos todo is blocked by, skipping deleted ones.
+func (s *TodoService) blockers(ctx context.Context, todo *models.Todo) ([]*models.Todo, error) {
+	var blockers []*models.Todo
+	for _, id := range todo.BlockedBy {
+		blocker, err := s.storage.GetByID(ctx, id)
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		blockers = append(blockers, blocker)
+	}
+	sortOldestFirst(blockers)
+	return blockers, nil
+}
+
+func (s *TodoService) dependents(ctx context.Context, id string) ([]*models.Todo, error) {
+	page, err := s.storage.Query(ctx, storage.Query{
+		Filter: filter.Compare{Field: filter.FieldBlockedBy, Op: filter.OpEq, Value: id},
+		Sort:   []storage.SortField{{Field: storage.SortCreatedAt}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return page.Todos, nil
+}
+
+// AddBlocker records that a todo is blocked by another one. expectedVersion
+// works as for PatchTodo.
+func (s *TodoService) AddBlocker(ctx context.Context, id string, expectedVersion int64, blockerID string) (*models.Todo, error) {
+	return s.modify(ctx, id, expectedVersion, func(todo *models.Todo) (*workflow.Transition, error) {
+		before := todo.BlockedBy
+		todo.BlockedBy = models.NormalizeIDs(append(append([]string(nil), todo.BlockedBy...), blockerID))
+		return nil, s.checkBlockers(ctx, todo, before)
+	})
+}
+
+// RemoveBlocker removes a blocker from a todo. Removing a blocker the todo
+// does not have is not an error.
+func (s *TodoService) RemoveBlocker(ctx context.Context, id string, expectedVersion int64, blockerID string) (*models.Todo, error) {
+	return s.modify(ctx, id, expectedVersion, func(todo *models.Todo) (*workflow.Transition, error) {
+		todo.BlockedBy = withoutID(todo.BlockedBy, blockerID)
+		return nil, nil
+	})
+}
+
+func withoutID(ids []string, id string) []string {
+	var out []string
+	for _, have := range ids {
+		if have != id {
+			out = append(out, have)
+		}
+	}
+	return out
+}
+
+// checkBlockers validates the blockers todo gained since it had previous:
+// each must exist, and none may already depend on todo, directly or not,
+// since the dependencies would then form a cycle that can never be started.
+func (s *TodoService) checkBlockers(ctx context.Context, todo *models.Todo, previous []string) error {
+	had := make(map[string]bool, len(previous))
+	for _, id := range previous {
+		had[id] = true
+	}
+
+	var errs validation.Errors
+	for _, id := range todo.BlockedBy {
+		if had[id] {
+			continue
+		}
+		if id == todo.ID {
+			errs.Add("blocked_by", "cycle", "a todo cannot be blocked by itself")
+			continue
+		}
+		blocker, err := s.storage.GetByID(ctx, id)
+		if errors.Is(err, storage.ErrNotFound) {
+			errs.Add("blocked_by", "exists", "no todo with ID %q", id)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		path, err := s.dependencyPath(ctx, blocker, todo.ID, map[string]bool{})
+		if err != nil {
+			return err
+		}
+		if path != nil {
+			titles := []string{todo.Title}
+			for _, t := range path {
+				titles = append(titles, t.Title)
+			}
+			errs.Add("blocked_by", "cycle", "%q would wait for itself: %s", todo.Title, strings.Join(titles, " → "))
+		}
+	}
+	return errs.Err()
+}
+
+// dependencyPath looks for target among the blockers of from, directly or
+// not, and returns the chain of todos from from to target if found.
+func (s *TodoService) dependencyPath(ctx context.Context, from *models.Todo, target string, seen map[string]bool) ([]*models.Todo, error) {
+	if from.ID == target {
+		return []*models.Todo{from}, nil
+	}
+	if seen[from.ID] {
+		return nil, nil
+	}
+	seen[from.ID] = true
+	for _, id := range from.BlockedBy {
+		next, err := s.storage.GetByID(ctx, id)
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		path, err := s.dependencyPath(ctx, next, target, seen)
+		if err != nil {
+			return nil, err
+		}
+		if path != nil {
+			return append([]*models.Todo{from}, path...), nil
+		}
+	}
+	return nil, nil
+}
+
+// checkUnblocked is a workflow before hook that stops actions marked
+// require_unblocked while any of the todo's blockers is still open.
+func (s *TodoService) checkUnblocked(ctx context.Context, t workflow.Transition) error {
+	if a, ok := s.workflow.Action(t.Action); !ok || !a.RequireUnblocked {
+		return nil
+	}
+	blockers, err := s.blockers(ctx, t.Todo)
+	if err != nil {
+		return err
+	}
+	var open []string
+	for _, b := range blockers {
+		if !s.workflow.IsDone(b.Status) {
+			open = append(open, fmt.Sprintf("%q (%s)", b.Title, b.Status))
+		}
+	}
+	if len(open) > 0 {
+		return fmt.Errorf("%w: cannot %s %q while it waits for %s", ErrBlocked, t.Action, t.Todo.Title, strings.Join(open, ", "))
+	}
+	return nil
+}
+
+// unlinkBlocker removes a todo that is about to be deleted from the blockers
+// of every todo waiting for it.
+func (s *TodoService) unlinkBlocker(ctx context.Context, id string) error {
+	dependents, err := s.dependents(ctx, id)
+	if err != nil {
+		return err
+	}
+	for _, d := range dependents {
+		if _, err := s.RemoveBlocker(ctx, d.ID, 0, id); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Plan orders the open todos so each comes after its blockers and finds the
+// critical path through them; see schedule.Build.
+func (s *TodoService) Plan(ctx context.Context) (*schedule.Plan, error) {
+	todos, err := s.storage.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	open := todos[:0]
+	for _, todo := range todos {
+		if !s.workflow.IsDone(todo.Status) {
+			open = append(open, todo)
+		}
+	}
+	return schedule.Build(open), nil
+}
@@ -0,0 +1,29 @@
+package service
+
+import (
+	"hash/fnv"
+	"sync"
+
+	"todo-app/internal/events"
+)
+
+// Events returns the bus the service publishes its changes on: a
+// TodoCreated, TodoUpdated (followed by StatusChanged if the status changed)
+// or TodoDeleted for every todo it saves, including the follow-on changes
+// made by roll-ups and recurrence and each todo a tag rename changes.
+func (s *TodoService) Events() *events.Bus {
+	return s.events
+}
+
+// todoLocks serialize saving a change to a todo with publishing it, so that
+// the events of a todo are published in the order its changes were saved
+// even when requests race. A fixed set of locks is shared by hashing IDs.
+type todoLocks [64]sync.Mutex
+
+func (l *todoLocks) lock(id string) func() {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	m := &l[h.Sum32()%uint32(len(l))]
+	m.Lock()
+	return m.Unlock
+}
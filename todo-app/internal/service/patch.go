@@ -0,0 +1,113 @@
+package service
+
+import (
+	"fmt"
+	"todo-app/internal/apperr"
+	"todo-app/internal/models"
+)
+
+// Patchable fields, named as in the todo's JSON representation.
+const (
+	FieldTitle        = "title"
+	FieldDescription  = "description"
+	FieldStatus       = "status"
+	FieldDueDate      = "due_date"
+	FieldPriority     = "priority"
+	FieldTags         = "tags"
+	FieldParentID     = "parent_id"
+	FieldAutoComplete = "auto_complete"
+	FieldBlockedBy    = "blocked_by"
+	FieldRecurrence   = "recurrence"
+	FieldReminders    = "reminders"
+	FieldPosition     = "position"
+)
+
+// ErrInvalidPatch is returned for patches naming unknown or read-only fields.
+var ErrInvalidPatch = apperr.New(apperr.Validation, "invalid_patch", "invalid patch")
+
+// Fields of a recurrence that a patch can set, named as in its JSON
+// representation. The link to the next occurrence is kept by the service.
+const (
+	RecurrenceRule     = "rule"
+	RecurrenceTimeZone = "time_zone"
+	RecurrenceStart    = "start"
+)
+
+// TodoPatch is a field-mask update. Every field named in Mask is set to its
+// value in Values, zero values included, so a masked zero value clears the
+// field. Fields not in Mask are left untouched.
+//
+// RecurrenceMask does the same one level down: when it is not nil, a masked
+// recurrence only sets the recurrence fields it names and keeps the others,
+// starting from no recurrence if the todo has none. A nil
+// Values.Recurrence still stops the todo repeating.
+type TodoPatch struct {
+	Mask           []string
+	Values         models.Todo
+	RecurrenceMask []string
+}
+
+// Set adds field to the mask. The caller sets the value in p.Values.
+func (p *TodoPatch) Set(field string) {
+	for _, f := range p.Mask {
+		if f == field {
+			return
+		}
+	}
+	p.Mask = append(p.Mask, field)
+}
+
+// Apply copies the masked fields from p.Values onto todo.
+func (p *TodoPatch) Apply(todo *models.Todo) error {
+	for _, field := range p.Mask {
+		switch field {
+		case FieldTitle:
+			todo.Title = p.Values.Title
+		case FieldDescription:
+			todo.Description = p.Values.Description
+		case FieldStatus:
+			todo.Status = p.Values.Status
+		case FieldDueDate:
+			todo.DueDate = p.Values.DueDate
+		case FieldPriority:
+			todo.Priority = p.Values.Priority
+		case FieldTags:
+			todo.Tags = models.NormalizeTags(p.Values.Tags)
+		case FieldParentID:
+			todo.ParentID = p.Values.ParentID
+		case FieldAutoComplete:
+			todo.AutoComplete = p.Values.AutoComplete
+		case FieldBlockedBy:
+			todo.BlockedBy = models.NormalizeIDs(p.Values.BlockedBy)
+		case FieldRecurrence:
+			if p.RecurrenceMask == nil || p.Values.Recurrence == nil {
+				setRecurrence(todo, p.Values.Recurrence)
+				continue
+			}
+			var merged models.Recurrence
+			if todo.Recurrence != nil {
+				merged = *todo.Recurrence
+			}
+			for _, field := range p.RecurrenceMask {
+				switch field {
+				case RecurrenceRule:
+					merged.Rule = p.Values.Recurrence.Rule
+				case RecurrenceTimeZone:
+					merged.TimeZone = p.Values.Recurrence.TimeZone
+				case RecurrenceStart:
+					merged.Start = p.Values.Recurrence.Start
+				default:
+					return fmt.Errorf("%w: field %q of recurrence cannot be changed", ErrInvalidPatch, field)
+				}
+			}
+			setRecurrence(todo, &merged)
+		case FieldReminders:
+			todo.Reminders = models.NormalizeReminders(p.Values.Reminders)
+		case FieldPosition:
+			todo.Position = p.Values.Position
+		default:
+			return fmt.Errorf("%w: field %q cannot be changed", ErrInvalidPatch, field)
+		}
+	}
+	return nil
+}
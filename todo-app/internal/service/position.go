@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"todo-app/internal/models"
+	"todo-app/internal/storage"
+	"todo-app/internal/validation"
+	"todo-app/internal/workflow"
+)
+
+// positionGap is the distance between the positions of todos created one
+// after another, and after a renumbering. Moving a todo takes the midpoint of
+// its new neighbours, so about 20 todos can be moved into the same gap before
+// the positions are spread out again.
+const positionGap = 1 << 20
+
+// nextPosition returns a position after every existing todo. Todos created
+// concurrently may get the same position; ties sort by ID.
+func (s *TodoService) nextPosition(ctx context.Context) (int64, error) {
+	page, err := s.storage.Query(ctx, storage.Query{
+		Sort:  []storage.SortField{{Field: storage.SortPosition, Desc: true}},
+		Limit: 1,
+	})
+	if err != nil {
+		return 0, err
+	}
+	if len(page.Todos) == 0 {
+		return positionGap, nil
+	}
+	return page.Todos[0].Position + positionGap, nil
+}
+
+// MoveTodo reorders a todo to sit right after the todo with ID after and
+// before the todo with ID before. One of them may be empty: the todo then
+// moves to just after after (or just before before) in the order of all
+// todos. Only the moved todo changes, unless its neighbours are too close
+// together, in which case every todo is first given a new position.
+// expectedVersion works as for PatchTodo.
+func (s *TodoService) MoveTodo(ctx context.Context, id string, expectedVersion int64, after, before string) (*models.Todo, error) {
+	var errs validation.Errors
+	switch {
+	case after == "" && before == "":
+		errs.Add("after", "required", "after or before is required")
+	case after == id || before == id:
+		errs.Add("after", "self", "a todo cannot be moved next to itself")
+	}
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+	if _, err := s.storage.GetByID(ctx, id); err != nil {
+		return nil, err
+	}
+
+	for renumbered := false; ; renumbered = true {
+		position, ok, err := s.positionBetween(ctx, id, after, before)
+		if err != nil {
+			return nil, err
+		}
+		if !ok && !renumbered {
+			if err := s.renumber(ctx, id); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		return s.modify(ctx, id, expectedVersion, func(todo *models.Todo) (*workflow.Transition, error) {
+			todo.Position = position
+			return nil, nil
+		})
+	}
+}
+
+// positionBetween finds a free position between the requested neighbours of
+// the todo being moved. ok is false if they leave no room.
+func (s *TodoService) positionBetween(ctx context.Context, id, after, before string) (position int64, ok bool, err error) {
+	todos, err := s.byPosition(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+	index := map[string]int{}
+	others := todos[:0]
+	for _, todo := range todos {
+		if todo.ID != id {
+			index[todo.ID] = len(others)
+			others = append(others, todo)
+		}
+	}
+
+	var errs validation.Errors
+	lo, hi := -1, len(others)
+	if after != "" {
+		i, found := index[after]
+		if !found {
+			errs.Add("after", "exists", "todo %s does not exist", after)
+		}
+		lo = i
+	}
+	if before != "" {
+		i, found := index[before]
+		if !found {
+			errs.Add("before", "exists", "todo %s does not exist", before)
+		}
+		hi = i
+	}
+	if err := errs.Err(); err != nil {
+		return 0, false, err
+	}
+	switch {
+	case after == "":
+		lo = hi - 1
+	case before == "":
+		hi = lo + 1
+	case lo >= hi:
+		errs.Add("before", "order", "todo %s does not come after %s", before, after)
+		return 0, false, errs.Err()
+	}
+
+	var low, high int64
+	switch {
+	case lo < 0:
+		high = others[hi].Position
+		low = high - 2*positionGap
+	case hi >= len(others):
+		low = others[lo].Position
+		high = low + 2*positionGap
+	default:
+		low, high = others[lo].Position, others[hi].Position
+	}
+	position = low + (high-low)/2
+	return position, position > low && position < high, nil
+}
+
+// byPosition returns every todo in board order.
+func (s *TodoService) byPosition(ctx context.Context) ([]*models.Todo, error) {
+	page, err := s.storage.Query(ctx, storage.Query{Sort: []storage.SortField{{Field: storage.SortPosition}}})
+	if err != nil {
+		return nil, err
+	}
+	return page.Todos, nil
+}
+
+// renumber spreads the positions of all todos positionGap apart again,
+// keeping their order. The todo being moved is left alone, so that its
+// version still matches what the caller expects.
+func (s *TodoService) renumber(ctx context.Context, moving string) error {
+	todos, err := s.byPosition(ctx)
+	if err != nil {
+		return err
+	}
+	for i, todo := range todos {
+		position := int64(i+1) * positionGap
+		if todo.ID == moving || todo.Position == position {
+			continue
+		}
+		_, err := s.modify(ctx, todo.ID, 0, func(todo *models.Todo) (*workflow.Transition, error) {
+			todo.Position = position
+			return nil, nil
+		})
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
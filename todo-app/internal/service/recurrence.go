@@ -0,0 +1,199 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+	"todo-app/internal/events"
+	"todo-app/internal/models"
+	"todo-app/internal/recurrence"
+	"todo-app/internal/validation"
+	"todo-app/internal/workflow"
+)
+
+// Bounds for the number of occurrences previewed at once.
+const (
+	DefaultOccurrences = 10
+	MaxOccurrences     = 1000
+)
+
+// setRecurrence gives todo a copy of r, or stops it repeating if r is nil.
+// The link to an already created next occurrence is kept, so changing the
+// rule of a done todo does not create a second one.
+func setRecurrence(todo *models.Todo, r *models.Recurrence) {
+	if r == nil {
+		todo.Recurrence = nil
+		return
+	}
+	c := *r
+	c.NextID = ""
+	if todo.Recurrence != nil {
+		c.NextID = todo.Recurrence.NextID
+	}
+	todo.Recurrence = &c
+}
+
+// normalizeRecurrence starts a series without a start at the todo's due date
+// and writes its rule in canonical form. Invalid rules are left for
+// validateRecurrence to report.
+func normalizeRecurrence(todo *models.Todo) {
+	r := todo.Recurrence
+	if r == nil {
+		return
+	}
+	if r.Start.IsZero() {
+		r.Start = todo.DueDate
+	}
+	if rule, err := recurrence.Parse(r.Rule); err == nil {
+		r.Rule = rule.String()
+	}
+}
+
+// validateRecurrence checks that a repeating todo has a valid rule and time
+// zone, and a due date for the occurrences to follow from.
+func validateRecurrence(todo *models.Todo, errs *validation.Errors) {
+	r := todo.Recurrence
+	if r == nil {
+		return
+	}
+	if todo.DueDate.IsZero() && !errs.Has("due_date") {
+		errs.Add("due_date", "required", "is required for a repeating todo")
+	}
+	if _, err := recurrence.Parse(r.Rule); err != nil {
+		errs.Add("recurrence.rule", "rrule", "%v", err)
+	}
+	if _, err := location(r.TimeZone); err != nil {
+		errs.Add("recurrence.time_zone", "time_zone", "%q is not a known IANA time zone such as \"Europe/Berlin\"", r.TimeZone)
+	}
+}
+
+// location loads an IANA time zone; empty means UTC. The server's own zone
+// ("Local") is refused, since a rule must not change meaning when the server
+// moves.
+func location(name string) (*time.Location, error) {
+	if name == "Local" {
+		return nil, errors.New("the server's time zone cannot be used")
+	}
+	return time.LoadLocation(name)
+}
+
+// ExpandRecurrence previews the first n occurrences of r, bounded like
+// ListTodos's page size, without creating any todos.
+func (s *TodoService) ExpandRecurrence(r models.Recurrence, n int) ([]recurrence.Occurrence, error) {
+	var errs validation.Errors
+	if r.Start.IsZero() {
+		errs.Add("start", "required", "is required")
+	}
+	rule, err := recurrence.Parse(r.Rule)
+	if err != nil {
+		errs.Add("rule", "rrule", "%v", err)
+	}
+	loc, err := location(r.TimeZone)
+	if err != nil {
+		errs.Add("time_zone", "time_zone", "%q is not a known IANA time zone such as \"Europe/Berlin\"", r.TimeZone)
+	}
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+	return rule.Expand(r.Start.In(loc), time.Time{}, occurrenceLimit(n)), nil
+}
+
+// Occurrences previews the next n occurrences of a repeating todo after its
+// own, bounded like ListTodos's page size. A todo that does not repeat has
+// none.
+func (s *TodoService) Occurrences(ctx context.Context, id string, n int) ([]recurrence.Occurrence, error) {
+	todo, err := s.storage.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	rule, start, ok := series(todo)
+	if !ok {
+		return nil, nil
+	}
+	return rule.Expand(start, after(todo), occurrenceLimit(n)), nil
+}
+
+func occurrenceLimit(n int) int {
+	switch {
+	case n <= 0:
+		return DefaultOccurrences
+	case n > MaxOccurrences:
+		return MaxOccurrences
+	}
+	return n
+}
+
+// series returns the rule of a repeating todo and the start of its series in
+// the rule's time zone.
+func series(todo *models.Todo) (*recurrence.Rule, time.Time, bool) {
+	r := todo.Recurrence
+	if r == nil {
+		return nil, time.Time{}, false
+	}
+	rule, err := recurrence.Parse(r.Rule)
+	if err != nil {
+		return nil, time.Time{}, false
+	}
+	loc, err := location(r.TimeZone)
+	if err != nil {
+		return nil, time.Time{}, false
+	}
+	return rule, r.Start.In(loc), true
+}
+
+// after is the time the occurrences following todo come after: its due date,
+// or the start of the series if the todo was moved before it.
+func after(todo *models.Todo) time.Time {
+	if todo.DueDate.Before(todo.Recurrence.Start) {
+		return todo.Recurrence.Start
+	}
+	return todo.DueDate
+}
+
+// recur creates the next occurrence of a repeating todo that was just done,
+// due at the first occurrence of its rule after its own due date, and links
+// it from the done todo. Like rollUp it is best effort, and it returns the
+// done todo with the link, or nil if no occurrence was created because the
+// series has ended or creating it failed.
+func (s *TodoService) recur(ctx context.Context, todo *models.Todo) *models.Todo {
+	rule, start, ok := series(todo)
+	if !ok {
+		return nil
+	}
+	next, ok := rule.Next(start, after(todo))
+	if !ok {
+		return nil
+	}
+
+	occurrence := models.NewTodo(todo.Title, todo.Description, next.Time)
+	occurrence.Status = s.workflow.Initial()
+	occurrence.Priority = todo.Priority
+	occurrence.Tags = append([]string(nil), todo.Tags...)
+	occurrence.ParentID = todo.ParentID
+	occurrence.AutoComplete = todo.AutoComplete
+	occurrence.Reminders = append([]models.Reminder(nil), todo.Reminders...)
+	// The next occurrence takes the finished one's place on the board.
+	occurrence.Position = todo.Position
+	occurrence.Recurrence = &models.Recurrence{Rule: todo.Recurrence.Rule, TimeZone: todo.Recurrence.TimeZone, Start: todo.Recurrence.Start}
+	unlock := s.locks.lock(occurrence.ID)
+	err := s.storage.Create(ctx, occurrence)
+	if err == nil {
+		s.events.Publish(ctx, events.TodoCreated{Todo: occurrence.Clone()})
+	}
+	unlock()
+	if err != nil {
+		return nil
+	}
+
+	linked, err := s.modify(ctx, todo.ID, 0, func(todo *models.Todo) (*workflow.Transition, error) {
+		if todo.Recurrence == nil || todo.Recurrence.NextID != "" {
+			return nil, errUnchanged
+		}
+		todo.Recurrence.NextID = occurrence.ID
+		return nil, nil
+	})
+	if err != nil {
+		return nil
+	}
+	return linked
+}
@@ -0,0 +1,392 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"time"
+
+	"github.com/google/uuid"
+	"todo-app/internal/apperr"
+	"todo-app/internal/hlc"
+	"todo-app/internal/models"
+	"todo-app/internal/storage"
+	"todo-app/internal/validation"
+	"todo-app/internal/workflow"
+)
+
+// Sync lets clients that work offline catch up with what changed while they
+// were away, and send back what they changed. Storage numbers every save;
+// a sync token records how far a client has read. Every field of a todo
+// carries the hybrid logical clock time of its last change, and a client's
+// change only wins for the fields that have not changed since the client
+// made it.
+
+// ServerNode is the node name of the server's clock. Clients use their own.
+const ServerNode = "server"
+
+// ErrInvalidSyncToken is returned for a sync token the server did not issue.
+var ErrInvalidSyncToken = apperr.New(apperr.Invalid, "invalid_sync_token", "invalid sync token")
+
+// Clock returns the clock the service stamps changes with.
+func (s *TodoService) Clock() *hlc.Clock {
+	return s.clock
+}
+
+// SetNode names the node the service stamps changes with, for a service
+// embedded in a client that syncs with a server under its own name. It must
+// be called before the service changes anything.
+func (s *TodoService) SetNode(node string) {
+	s.clock = hlc.NewClock(node)
+}
+
+// ChangeSet is one page of the changes since a sync token.
+type ChangeSet struct {
+	// Changes holds the todos saved and the tombstones of those deleted, in
+	// the order they were saved. A todo appears once, as last saved.
+	Changes []*storage.Change
+	// Token continues after these changes. It is the token asked for if
+	// there were none.
+	Token string
+	// More is set when further changes follow without waiting.
+	More bool
+}
+
+// Changes returns the changes since token, which comes from an earlier
+// ChangeSet or is empty to start from the beginning. limit is bounded like
+// ListTodos's page size.
+func (s *TodoService) Changes(ctx context.Context, token string, limit int) (*ChangeSet, error) {
+	after, err := decodeSyncToken(token)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case limit <= 0:
+		limit = DefaultPageSize
+	case limit > MaxPageSize:
+		limit = MaxPageSize
+	}
+
+	changes, err := s.storage.Changes(ctx, after, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	set := &ChangeSet{Changes: changes, Token: token}
+	if len(changes) > limit {
+		set.Changes, set.More = changes[:limit], true
+	}
+	if n := len(set.Changes); n > 0 {
+		set.Token = encodeSyncToken(set.Changes[n-1].Key())
+	}
+	return set, nil
+}
+
+// syncToken is the decoded form of a sync token.
+type syncToken struct {
+	Seq int64  `json:"s"`
+	ID  string `json:"i"`
+}
+
+func encodeSyncToken(key storage.ChangeKey) string {
+	data, _ := json.Marshal(syncToken{Seq: key.Seq, ID: key.ID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeSyncToken(token string) (storage.ChangeKey, error) {
+	if token == "" {
+		return storage.ChangeKey{}, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return storage.ChangeKey{}, ErrInvalidSyncToken
+	}
+	var t syncToken
+	if err := json.Unmarshal(data, &t); err != nil || t.Seq < 0 {
+		return storage.ChangeKey{}, ErrInvalidSyncToken
+	}
+	return storage.ChangeKey{Seq: t.Seq, ID: t.ID}, nil
+}
+
+// ClientChange is a change a client made to a todo, possibly while offline.
+type ClientChange struct {
+	ID string
+	// Delete deletes the todo, with its subtasks as Subtasks says.
+	// Otherwise Patch is applied to the todo, creating it if it does not
+	// exist.
+	Delete   bool
+	Subtasks SubtaskPolicy
+	Patch    TodoPatch
+	// Clock is when the client made the change, by its own clock.
+	Clock hlc.Timestamp
+}
+
+// Outcomes of a client change.
+const (
+	// SyncApplied means the change was applied in full.
+	SyncApplied = "applied"
+	// SyncMerged means some fields of the change were not applied because
+	// they changed later; SyncResult.Ignored names them.
+	SyncMerged = "merged"
+	// SyncDeleted means the todo is deleted. Deletions win over edits, so
+	// an edit of a deleted todo is dropped.
+	SyncDeleted = "deleted"
+	// SyncRejected means the change failed; SyncResult.Err says why.
+	SyncRejected = "rejected"
+)
+
+// SyncResult is the outcome of a client change.
+type SyncResult struct {
+	ID     string
+	Status string
+	// Todo is the todo after the change, unless it is deleted or the change
+	// was rejected.
+	Todo    *models.Todo
+	Ignored []string
+	Err     error
+}
+
+// ApplyChanges applies a batch of client changes, in order. A rejected
+// change does not stop the ones after it.
+//
+// Each field of an edit is only applied if the edit is later than the
+// field's last change, so concurrent edits of different fields both win and
+// of the same field the last one wins. Applying a change twice has no
+// further effect. Status changes must be allowed by the workflow, except
+// for todos the client created: those may start in any status.
+func (s *TodoService) ApplyChanges(ctx context.Context, changes []ClientChange) []SyncResult {
+	results := make([]SyncResult, len(changes))
+	for i, c := range changes {
+		results[i] = s.applyChange(ctx, c)
+	}
+	return results
+}
+
+func (s *TodoService) applyChange(ctx context.Context, c ClientChange) SyncResult {
+	result := SyncResult{ID: c.ID, Status: SyncRejected}
+	if result.Err = s.observe(c); result.Err != nil {
+		return result
+	}
+	deleted, err := s.deleted(ctx, c.ID)
+	if err != nil || deleted {
+		result.Err = err
+		if deleted {
+			result.Status = SyncDeleted
+		}
+		return result
+	}
+
+	if c.Delete {
+		err := s.DeleteTodo(ctx, c.ID, c.Subtasks)
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			result.Status = SyncDeleted
+		case err != nil:
+			result.Err = err
+		default:
+			result.Status = SyncApplied
+		}
+		return result
+	}
+
+	todo, ignored, err := s.merge(ctx, c)
+	if errors.Is(err, storage.ErrNotFound) {
+		todo, err = s.insertChange(ctx, c)
+	}
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.Todo, result.Ignored = todo, ignored
+	result.Status = SyncApplied
+	if len(ignored) > 0 {
+		result.Status = SyncMerged
+	}
+	return result
+}
+
+// observe checks a change's ID and clock and moves the server's clock past
+// the change, so that later server-side changes win over it.
+func (s *TodoService) observe(c ClientChange) error {
+	var errs validation.Errors
+	if c.ID == "" {
+		errs.Add("id", "required", "is required")
+	}
+	switch {
+	case c.Clock.IsZero():
+		errs.Add("clock", "required", "is required")
+	case c.Clock.Node == ServerNode:
+		errs.Add("clock", "node", "node name %q is reserved for the server", ServerNode)
+	case errors.Is(s.clock.Observe(c.Clock), hlc.ErrDrift):
+		errs.Add("clock", "drift", "%s is more than %s ahead of the server's clock", c.Clock, hlc.MaxDrift)
+	}
+	return errs.Err()
+}
+
+// deleted reports whether the todo with the given ID was deleted.
+func (s *TodoService) deleted(ctx context.Context, id string) (bool, error) {
+	_, err := s.storage.Tombstone(ctx, id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// merge applies the fields of an edit that are later than the todo's, and
+// returns the todo and the fields that were not.
+func (s *TodoService) merge(ctx context.Context, c ClientChange) (*models.Todo, []string, error) {
+	todo, err := s.storage.GetByID(ctx, c.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	patch, ignored := laterFields(todo, c)
+	if len(patch.Mask) == 0 {
+		// Nothing to save: every field is newer, or already has this edit.
+		return todo, ignored, nil
+	}
+
+	todo, err = s.modify(ctx, c.ID, 0, func(todo *models.Todo) (*workflow.Transition, error) {
+		patch, ignored = laterFields(todo, c)
+		t, err := s.applyPatch(ctx, todo, patch)
+		if err != nil {
+			return nil, err
+		}
+		for _, field := range patch.Mask {
+			setClock(todo, field, c.Clock)
+		}
+		return t, nil
+	})
+	return todo, ignored, err
+}
+
+// laterFields returns the part of an edit later than the todo's fields, and
+// the fields the edit is earlier for. Fields whose clock equals the edit's
+// already have it and are in neither.
+func laterFields(todo *models.Todo, c ClientChange) (patch TodoPatch, ignored []string) {
+	patch.Values = c.Patch.Values
+	for _, field := range c.Patch.Mask {
+		switch c.Clock.Compare(todo.Clocks[field]) {
+		case 1:
+			patch.Set(field)
+		case -1:
+			ignored = append(ignored, field)
+		}
+	}
+	return patch, ignored
+}
+
+// insertChange creates a todo the client created, with the ID it gave it.
+func (s *TodoService) insertChange(ctx context.Context, c ClientChange) (*models.Todo, error) {
+	if _, err := uuid.Parse(c.ID); err != nil {
+		var errs validation.Errors
+		errs.Add("id", "uuid", "must be a UUID")
+		return nil, errs.Err()
+	}
+	todo := models.NewTodo("", "", time.Time{})
+	todo.ID = c.ID
+	todo.Status = s.workflow.Initial()
+	if err := c.Patch.Apply(todo); err != nil {
+		return nil, err
+	}
+	normalizeRecurrence(todo)
+	for _, field := range c.Patch.Mask {
+		setClock(todo, field, c.Clock)
+	}
+	if err := s.insert(ctx, todo); err != nil {
+		return nil, err
+	}
+	return todo, nil
+}
+
+// clockedFields are the fields that carry clocks: those a patch can change.
+var clockedFields = []string{
+	FieldTitle, FieldDescription, FieldStatus, FieldDueDate, FieldPriority, FieldTags, FieldParentID,
+	FieldAutoComplete, FieldBlockedBy, FieldRecurrence, FieldReminders, FieldPosition,
+}
+
+// stamp sets the clock of every field a change to a todo changed to the
+// current time, unless the change set the clock itself, as merged client
+// edits do. The time is after the fields' previous clocks even if the
+// server's clock was reset since, e.g. by a restart.
+func (s *TodoService) stamp(before, after *models.Todo) {
+	var changed []string
+	for _, field := range clockedFields {
+		if after.Clocks[field] != before.Clocks[field] || sameValue(fieldValue(before, field), fieldValue(after, field)) {
+			continue
+		}
+		// Previous clocks passed the drift check when they were set.
+		s.clock.Observe(before.Clocks[field])
+		changed = append(changed, field)
+	}
+	if len(changed) == 0 {
+		return
+	}
+	now := s.clock.Now()
+	for _, field := range changed {
+		setClock(after, field, now)
+	}
+}
+
+func setClock(todo *models.Todo, field string, ts hlc.Timestamp) {
+	if todo.Clocks == nil {
+		todo.Clocks = map[string]hlc.Timestamp{}
+	}
+	todo.Clocks[field] = ts
+}
+
+// sameValue reports whether two field values are equal. Slices are compared
+// element by element, so a nil slice equals an empty one: clients and
+// storage backends differ in which one they give back for an empty list.
+func sameValue(a, b interface{}) bool {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if va.Kind() != reflect.Slice || vb.Kind() != reflect.Slice {
+		return reflect.DeepEqual(a, b)
+	}
+	if va.Len() != vb.Len() {
+		return false
+	}
+	for i := 0; i < va.Len(); i++ {
+		if !reflect.DeepEqual(va.Index(i).Interface(), vb.Index(i).Interface()) {
+			return false
+		}
+	}
+	return true
+}
+
+// fieldValue returns a field of a todo in a form that sameValue compares by
+// value.
+func fieldValue(todo *models.Todo, field string) interface{} {
+	switch field {
+	case FieldTitle:
+		return todo.Title
+	case FieldDescription:
+		return todo.Description
+	case FieldStatus:
+		return todo.Status
+	case FieldDueDate:
+		return todo.DueDate.UTC()
+	case FieldPriority:
+		return todo.Priority
+	case FieldTags:
+		return todo.Tags
+	case FieldParentID:
+		return todo.ParentID
+	case FieldAutoComplete:
+		return todo.AutoComplete
+	case FieldBlockedBy:
+		return todo.BlockedBy
+	case FieldRecurrence:
+		if todo.Recurrence == nil {
+			return nil
+		}
+		r := *todo.Recurrence
+		r.Start = r.Start.UTC()
+		return r
+	case FieldReminders:
+		return todo.Reminders
+	case FieldPosition:
+		return todo.Position
+	}
+	return nil
+}
@@ -1,64 +1,413 @@
 package service
 
 import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
 	"time"
+	"todo-app/internal/apperr"
+	"todo-app/internal/events"
+	"todo-app/internal/filter"
+	"todo-app/internal/hlc"
 	"todo-app/internal/models"
 	"todo-app/internal/storage"
+	"todo-app/internal/validation"
+	"todo-app/internal/workflow"
+	"unicode/utf8"
 )
 
 type TodoService struct {
-	storage storage.TodoStorage
+	storage  storage.TodoStorage
+	workflow *workflow.Workflow
+	events   *events.Bus
+	locks    todoLocks
+	clock    *hlc.Clock
 }
 
-func NewTodoService(storage storage.TodoStorage) *TodoService {
-	return &TodoService{storage: storage}
+// NewTodoService creates a service storing todos in storage. It registers a
+// before hook on workflow that keeps blocked todos from starting actions
+// marked require_unblocked.
+func NewTodoService(storage storage.TodoStorage, workflow *workflow.Workflow) *TodoService {
+	s := &TodoService{storage: storage, workflow: workflow, events: events.NewBus(), clock: hlc.NewClock(ServerNode)}
+	workflow.OnBefore(s.checkUnblocked)
+	return s
 }
 
-func (s *TodoService) CreateTodo(title, description string, dueDate time.Time) (*models.Todo, error) {
+// Workflow returns the status workflow todos follow.
+func (s *TodoService) Workflow() *workflow.Workflow {
+	return s.workflow
+}
+
+// CreateTodo creates a todo, as a subtask of parentID if that is not empty,
+// blocked by the todos in blockedBy, repeating as recurrence says if that is
+// not nil and reminded of at the given times before it is due.
+func (s *TodoService) CreateTodo(ctx context.Context, title, description string, dueDate time.Time, priority models.Priority, tags []string, parentID string, autoComplete bool, blockedBy []string, recurrence *models.Recurrence, reminders []models.Reminder) (*models.Todo, error) {
 	todo := models.NewTodo(title, description, dueDate)
-	if err := s.storage.Create(todo); err != nil {
+	todo.Status = s.workflow.Initial()
+	todo.Priority = priority
+	todo.Tags = models.NormalizeTags(tags)
+	todo.ParentID = parentID
+	todo.AutoComplete = autoComplete
+	todo.BlockedBy = models.NormalizeIDs(blockedBy)
+	setRecurrence(todo, recurrence)
+	normalizeRecurrence(todo)
+	todo.Reminders = models.NormalizeReminders(reminders)
+	if err := s.insert(ctx, todo); err != nil {
 		return nil, err
 	}
 	return todo, nil
 }
 
-func (s *TodoService) GetTodo(id string) (*models.Todo, error) {
-	return s.storage.GetByID(id)
+// insert checks a new todo and saves it, placing it after every other todo
+// unless it has a position already.
+func (s *TodoService) insert(ctx context.Context, todo *models.Todo) error {
+	if err := s.validate(todo); err != nil {
+		return err
+	}
+	if err := s.checkParent(ctx, todo); err != nil {
+		return err
+	}
+	if err := s.checkBlockers(ctx, todo, nil); err != nil {
+		return err
+	}
+	if todo.Position == 0 {
+		position, err := s.nextPosition(ctx)
+		if err != nil {
+			return err
+		}
+		todo.Position = position
+	}
+	unlock := s.locks.lock(todo.ID)
+	defer unlock()
+	if err := s.storage.Create(ctx, todo); err != nil {
+		return err
+	}
+	s.events.Publish(ctx, events.TodoCreated{Todo: todo.Clone()})
+	return nil
 }
 
-func (s *TodoService) GetAllTodos() ([]*models.Todo, error) {
-	return s.storage.GetAll()
+func (s *TodoService) GetTodo(ctx context.Context, id string) (*models.Todo, error) {
+	return s.storage.GetByID(ctx, id)
 }
 
-func (s *TodoService) UpdateTodo(id, title, description string, status models.Status, dueDate time.Time) (*models.Todo, error) {
-	todo, err := s.storage.GetByID(id)
-	if err != nil {
-		return nil, err
+func (s *TodoService) GetAllTodos(ctx context.Context) ([]*models.Todo, error) {
+	return s.storage.GetAll(ctx)
+}
+
+// Page size bounds for ListTodos.
+const (
+	DefaultPageSize = 100
+	MaxPageSize     = 1000
+)
+
+// ListTodos returns one page of the todos matching expr (nil matches all). A
+// missing limit gets DefaultPageSize and larger limits are capped at
+// MaxPageSize, so a listing is never unbounded.
+func (s *TodoService) ListTodos(ctx context.Context, expr filter.Expr, q storage.Query) (*storage.Page, error) {
+	q.Filter = expr
+	switch {
+	case q.Limit <= 0:
+		q.Limit = DefaultPageSize
+	case q.Limit > MaxPageSize:
+		q.Limit = MaxPageSize
 	}
-	
+	return s.storage.Query(ctx, q)
+}
+
+// SearchTodos runs a full-text search over titles and descriptions. limit is
+// bounded like ListTodos's page size.
+func (s *TodoService) SearchTodos(ctx context.Context, query string, limit int) ([]*storage.SearchHit, error) {
+	switch {
+	case limit <= 0:
+		limit = DefaultPageSize
+	case limit > MaxPageSize:
+		limit = MaxPageSize
+	}
+	return s.storage.Search(ctx, query, limit)
+}
+
+// ErrVersionMismatch is returned when an update names an expected version
+// that is no longer the todo's current version.
+var ErrVersionMismatch = apperr.New(apperr.Precondition, "version_mismatch", "todo does not match the expected version")
+
+// maxUpdateAttempts bounds how often an unconditional update is retried after
+// losing a race with another writer.
+const maxUpdateAttempts = 3
+
+// UpdateTodo changes the non-empty fields of a todo; see PatchTodo for
+// expectedVersion. A nil tags leaves the tags alone, while an empty one
+// removes them all.
+func (s *TodoService) UpdateTodo(ctx context.Context, id string, expectedVersion int64, title, description string, status models.Status, dueDate time.Time, priority models.Priority, tags []string) (*models.Todo, error) {
+	var patch TodoPatch
 	if title != "" {
-		todo.Title = title
+		patch.Set(FieldTitle)
+		patch.Values.Title = title
 	}
 	if description != "" {
-		todo.Description = description
+		patch.Set(FieldDescription)
+		patch.Values.Description = description
 	}
 	if status != "" {
-		todo.Status = status
+		patch.Set(FieldStatus)
+		patch.Values.Status = status
 	}
 	if !dueDate.IsZero() {
-		todo.DueDate = dueDate
+		patch.Set(FieldDueDate)
+		patch.Values.DueDate = dueDate
+	}
+	if priority != models.PriorityNone {
+		patch.Set(FieldPriority)
+		patch.Values.Priority = priority
+	}
+	if tags != nil {
+		patch.Set(FieldTags)
+		patch.Values.Tags = tags
 	}
-	
-	if err := s.storage.Update(todo); err != nil {
+	return s.PatchTodo(ctx, id, expectedVersion, patch)
+}
+
+// PatchTodo applies a field-mask update to a todo. If expectedVersion is
+// non-zero the patch only applies to that version of the todo and fails with
+// ErrVersionMismatch otherwise. With expectedVersion zero the caller did not
+// ask for a precondition, so a concurrent change is simply re-read and the
+// patch applied on top of it.
+//
+// A status change must be allowed by the workflow and runs its hooks like
+// the equivalent action would.
+func (s *TodoService) PatchTodo(ctx context.Context, id string, expectedVersion int64, patch TodoPatch) (*models.Todo, error) {
+	return s.modify(ctx, id, expectedVersion, func(todo *models.Todo) (*workflow.Transition, error) {
+		return s.applyPatch(ctx, todo, patch)
+	})
+}
+
+// applyPatch applies a patch to a todo being modified, checks the result
+// and returns the status transition the patch makes, if any.
+func (s *TodoService) applyPatch(ctx context.Context, todo *models.Todo, patch TodoPatch) (*workflow.Transition, error) {
+	from, parentID, blockedBy := todo.Status, todo.ParentID, todo.BlockedBy
+	if err := patch.Apply(todo); err != nil {
 		return nil, err
 	}
-	return todo, nil
+	normalizeRecurrence(todo)
+	if err := s.validate(todo); err != nil {
+		return nil, err
+	}
+	if todo.ParentID != parentID {
+		if err := s.checkParent(ctx, todo); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.checkBlockers(ctx, todo, blockedBy); err != nil {
+		return nil, err
+	}
+	if todo.Status == from {
+		return nil, nil
+	}
+	return s.workflow.Between(from, todo.Status, "")
+}
+
+// Transition performs a workflow action such as "start" or "complete" on a
+// todo. reason is recorded with the transition and required by some actions.
+// expectedVersion works as for PatchTodo.
+func (s *TodoService) Transition(ctx context.Context, id string, expectedVersion int64, action, reason string) (*models.Todo, error) {
+	return s.modify(ctx, id, expectedVersion, func(todo *models.Todo) (*workflow.Transition, error) {
+		t, err := s.workflow.Fire(action, todo.Status, reason)
+		if err != nil {
+			return nil, err
+		}
+		todo.Status = t.To
+		return t, nil
+	})
+}
+
+// modify is the read-modify-write loop shared by all updates. change edits
+// the todo in place and returns the status transition it makes, if any,
+// whose hooks then run around the save. The fields it changes are stamped
+// with the time (see stamp). Once saved, the change rolls up to the todo's
+// parents (see afterSave). Every save is published on the event bus.
+func (s *TodoService) modify(ctx context.Context, id string, expectedVersion int64, change func(todo *models.Todo) (*workflow.Transition, error)) (*models.Todo, error) {
+	for attempt := 1; ; attempt++ {
+		todo, err := s.storage.GetByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if expectedVersion != 0 && todo.Version != expectedVersion {
+			return nil, ErrVersionMismatch
+		}
+
+		before := todo.Clone()
+		t, err := change(todo)
+		if err != nil {
+			return nil, err
+		}
+		if t != nil {
+			t.Todo = todo
+			if err := s.workflow.Before(ctx, *t); err != nil {
+				return nil, err
+			}
+		}
+		s.stamp(before, todo)
+
+		unlock := s.locks.lock(id)
+		err = s.storage.Update(ctx, todo)
+		if err != nil {
+			unlock()
+		}
+		if errors.Is(err, storage.ErrConflict) {
+			if expectedVersion != 0 {
+				return nil, ErrVersionMismatch
+			}
+			if attempt < maxUpdateAttempts {
+				continue
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		after := todo.Clone()
+		s.events.Publish(ctx, events.TodoUpdated{Before: before, After: after})
+		if t != nil {
+			s.events.Publish(ctx, events.StatusChanged{Todo: after, From: t.From, To: t.To, Action: t.Action, Reason: t.Reason})
+		}
+		unlock()
+		if t != nil {
+			t.Todo = todo.Clone()
+			s.workflow.After(ctx, *t)
+		}
+		return s.afterSave(ctx, before, todo), nil
+	}
+}
+
+// validate checks a todo against the rules in its struct tags and the domain
+// rules tags cannot express. All violations are returned together as
+// validation.Errors.
+func (s *TodoService) validate(todo *models.Todo) error {
+	errs := validation.Struct(todo)
+	if !errs.Has("title") && strings.TrimSpace(todo.Title) == "" {
+		errs.Add("title", "required", "must not be blank")
+	}
+	if !errs.Has("status") && !s.workflow.IsStatus(todo.Status) {
+		statuses := make([]string, 0, len(s.workflow.Statuses()))
+		for _, status := range s.workflow.Statuses() {
+			statuses = append(statuses, string(status))
+		}
+		errs.Add("status", "status", "must be one of %s", strings.Join(statuses, ", "))
+	}
+	if todo.Priority < models.PriorityNone || todo.Priority > models.PriorityUrgent {
+		errs.Add("priority", "priority", "must be one of none, low, medium, high, urgent")
+	}
+	if !errs.Has("tags") {
+		for _, tag := range todo.Tags {
+			if !validTag(tag) {
+				errs.Add("tags", "tag", "%q is not a valid tag (use up to %d lowercase letters, digits, '-', '_', '.' or '/')", tag, maxTagLength)
+				break
+			}
+		}
+	}
+	validateRecurrence(todo, &errs)
+	if !errs.Has("reminders") {
+		for _, r := range todo.Reminders {
+			if r < 0 || time.Duration(r) > maxReminder {
+				errs.Add("reminders", "reminder", "%s is not between 0 and %s before the due date", r, models.Reminder(maxReminder))
+				break
+			}
+		}
+	}
+	return errs.Err()
+}
+
+// maxReminder bounds how long before its due date a todo can be reminded of.
+const maxReminder = 365 * 24 * time.Hour
+
+// maxTagLength bounds the length of a tag in characters.
+const maxTagLength = 50
+
+var tagPattern = regexp.MustCompile(`^[\p{Ll}\p{Lo}\p{N}][\p{Ll}\p{Lo}\p{N}_./-]*$`)
+
+func validTag(tag string) bool {
+	return utf8.RuneCountInString(tag) <= maxTagLength && tagPattern.MatchString(tag)
+}
+
+// ListTags returns every tag in use with its number of todos.
+func (s *TodoService) ListTags(ctx context.Context) ([]storage.TagCount, error) {
+	return s.storage.Tags(ctx)
 }
 
-func (s *TodoService) DeleteTodo(id string) error {
-	return s.storage.Delete(id)
+// RenameTag renames a tag on every todo carrying it. Renaming to an existing
+// tag merges the two.
+func (s *TodoService) RenameTag(ctx context.Context, from, to string) (int, error) {
+	return s.MergeTags(ctx, []string{from}, to)
 }
 
-func (s *TodoService) FilterByStatus(status models.Status) ([]*models.Todo, error) {
-	return s.storage.FilterByStatus(status)
-}
\ No newline at end of file
+// MergeTags replaces each of the from tags with into on every todo, returning
+// the number of todos changed. Each todo is saved, stamped and published as
+// an update of its own, so a merge that fails partway has renamed the tags
+// of the todos before the failure.
+func (s *TodoService) MergeTags(ctx context.Context, from []string, into string) (int, error) {
+	var errs validation.Errors
+	from = models.NormalizeTags(from)
+	if len(from) == 0 {
+		errs.Add("from", "required", "is required")
+	}
+	into = strings.ToLower(strings.TrimSpace(into))
+	if !validTag(into) {
+		errs.Add("to", "tag", "%q is not a valid tag", into)
+	}
+	if err := errs.Err(); err != nil {
+		return 0, err
+	}
+
+	var tagged filter.Expr
+	for _, tag := range from {
+		if tag == into {
+			continue
+		}
+		var c filter.Expr = filter.Compare{Field: filter.FieldTag, Op: filter.OpEq, Value: tag}
+		if tagged != nil {
+			c = filter.Or{Left: tagged, Right: c}
+		}
+		tagged = c
+	}
+	if tagged == nil {
+		return 0, nil
+	}
+	page, err := s.storage.Query(ctx, storage.Query{
+		Filter: tagged,
+		Sort:   []storage.SortField{{Field: storage.SortCreatedAt}},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	for _, todo := range page.Todos {
+		_, err := s.modify(ctx, todo.ID, 0, func(todo *models.Todo) (*workflow.Transition, error) {
+			todo.Tags = replaceTags(todo.Tags, from, into)
+			return nil, nil
+		})
+		if errors.Is(err, storage.ErrNotFound) {
+			// Deleted since the query.
+			continue
+		}
+		if err != nil {
+			return changed, err
+		}
+		changed++
+	}
+	return changed, nil
+}
+
+// replaceTags replaces every tag in from with to.
+func replaceTags(tags, from []string, to string) []string {
+	replaced := make([]string, 0, len(tags)+1)
+	for _, tag := range tags {
+		for _, f := range from {
+			if tag == f {
+				tag = to
+				break
+			}
+		}
+		replaced = append(replaced, tag)
+	}
+	return models.NormalizeTags(replaced)
+}
@@ -0,0 +1,317 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"todo-app/internal/apperr"
+	"todo-app/internal/events"
+	"todo-app/internal/filter"
+	"todo-app/internal/models"
+	"todo-app/internal/storage"
+	"todo-app/internal/validation"
+	"todo-app/internal/workflow"
+)
+
+// ErrHasSubtasks is returned when deleting a todo that has subtasks without
+// saying what should happen to them.
+var ErrHasSubtasks = apperr.New(apperr.Conflict, "has_subtasks", "todo has subtasks")
+
+// SubtaskPolicy says what happens to the subtasks of a deleted todo.
+type SubtaskPolicy string
+
+const (
+	// SubtasksReject refuses to delete a todo that has subtasks.
+	SubtasksReject SubtaskPolicy = ""
+	// SubtasksCascade deletes the whole subtree.
+	SubtasksCascade SubtaskPolicy = "cascade"
+	// SubtasksPromote moves the subtasks up to the deleted todo's parent.
+	SubtasksPromote SubtaskPolicy = "promote"
+)
+
+// Progress counts a todo's direct subtasks and how many of them are done.
+type Progress struct {
+	Done  int
+	Total int
+}
+
+// TreeNode is a todo with its subtasks, oldest first.
+type TreeNode struct {
+	Todo     *models.Todo
+	Progress Progress
+	Children []*TreeNode
+}
+
+// Subtasks returns the direct subtasks of a todo, oldest first.
+func (s *TodoService) Subtasks(ctx context.Context, id string) ([]*models.Todo, error) {
+	if _, err := s.storage.GetByID(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.subtasks(ctx, id)
+}
+
+func (s *TodoService) subtasks(ctx context.Context, id string) ([]*models.Todo, error) {
+	page, err := s.storage.Query(ctx, storage.Query{
+		Filter: filter.Compare{Field: filter.FieldParent, Op: filter.OpEq, Value: id},
+		Sort:   []storage.SortField{{Field: storage.SortCreatedAt}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return page.Todos, nil
+}
+
+// Progress reports how many of a todo's direct subtasks are done.
+func (s *TodoService) Progress(ctx context.Context, id string) (Progress, error) {
+	subtasks, err := s.subtasks(ctx, id)
+	if err != nil {
+		return Progress{}, err
+	}
+	return s.progress(subtasks), nil
+}
+
+func (s *TodoService) progress(subtasks []*models.Todo) Progress {
+	p := Progress{Total: len(subtasks)}
+	for _, todo := range subtasks {
+		if s.workflow.IsDone(todo.Status) {
+			p.Done++
+		}
+	}
+	return p
+}
+
+// Tree returns a todo with all of its subtasks, however deeply nested.
+func (s *TodoService) Tree(ctx context.Context, id string) (*TreeNode, error) {
+	todo, err := s.storage.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.subtree(ctx, todo)
+}
+
+func (s *TodoService) subtree(ctx context.Context, todo *models.Todo) (*TreeNode, error) {
+	subtasks, err := s.subtasks(ctx, todo.ID)
+	if err != nil {
+		return nil, err
+	}
+	node := &TreeNode{Todo: todo, Progress: s.progress(subtasks)}
+	for _, sub := range subtasks {
+		child, err := s.subtree(ctx, sub)
+		if err != nil {
+			return nil, err
+		}
+		node.Children = append(node.Children, child)
+	}
+	return node, nil
+}
+
+// Forest returns every todo arranged as trees of subtasks, top-level todos
+// oldest first. A todo whose parent no longer exists is shown at the top
+// level.
+func (s *TodoService) Forest(ctx context.Context) ([]*TreeNode, error) {
+	todos, err := s.storage.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sortOldestFirst(todos)
+
+	nodes := make(map[string]*TreeNode, len(todos))
+	for _, todo := range todos {
+		nodes[todo.ID] = &TreeNode{Todo: todo}
+	}
+	var roots []*TreeNode
+	for _, todo := range todos {
+		node := nodes[todo.ID]
+		parent, ok := nodes[todo.ParentID]
+		if !ok {
+			roots = append(roots, node)
+			continue
+		}
+		parent.Children = append(parent.Children, node)
+		parent.Progress.Total++
+		if s.workflow.IsDone(todo.Status) {
+			parent.Progress.Done++
+		}
+	}
+	return roots, nil
+}
+
+func sortOldestFirst(todos []*models.Todo) {
+	sort.Slice(todos, func(i, j int) bool {
+		if !todos[i].CreatedAt.Equal(todos[j].CreatedAt) {
+			return todos[i].CreatedAt.Before(todos[j].CreatedAt)
+		}
+		return todos[i].ID < todos[j].ID
+	})
+}
+
+// checkParent makes sure a todo's parent exists and is not the todo itself
+// or one of its subtasks, which would detach the subtree into a cycle.
+func (s *TodoService) checkParent(ctx context.Context, todo *models.Todo) error {
+	var errs validation.Errors
+	seen := map[string]bool{}
+	for id := todo.ParentID; id != "" && !seen[id]; {
+		if id == todo.ID {
+			errs.Add("parent_id", "cycle", "a todo cannot be moved under itself or one of its subtasks")
+			return errs
+		}
+		seen[id] = true
+		parent, err := s.storage.GetByID(ctx, id)
+		if errors.Is(err, storage.ErrNotFound) && id == todo.ParentID {
+			errs.Add("parent_id", "exists", "no todo with ID %q", id)
+			return errs
+		}
+		if errors.Is(err, storage.ErrNotFound) {
+			// An ancestor further up is gone; the chain ends here.
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		id = parent.ParentID
+	}
+	return nil
+}
+
+// errUnchanged tells modify that a change turned out to be unnecessary.
+var errUnchanged = errors.New("unchanged")
+
+// rollUp completes an auto-completing todo once all of its subtasks are done,
+// which may in turn complete its own parent. The change that triggered it has
+// already been saved, so rolling up is best effort: if it fails, the todo is
+// simply left for the user to complete. It returns the completed todo, or nil
+// if nothing changed.
+func (s *TodoService) rollUp(ctx context.Context, id string) *models.Todo {
+	todo, err := s.modify(ctx, id, 0, func(todo *models.Todo) (*workflow.Transition, error) {
+		if !todo.AutoComplete || s.workflow.IsDone(todo.Status) {
+			return nil, errUnchanged
+		}
+		subtasks, err := s.subtasks(ctx, todo.ID)
+		if err != nil {
+			return nil, err
+		}
+		if p := s.progress(subtasks); p.Total == 0 || p.Done < p.Total {
+			return nil, errUnchanged
+		}
+		t, err := s.workflow.Finish(todo.Status)
+		if err != nil {
+			return nil, err
+		}
+		todo.Status = t.To
+		return t, nil
+	})
+	if err != nil {
+		return nil
+	}
+	return todo
+}
+
+// afterSave follows up on a saved change from before to after. A repeating
+// todo that was finished gets its next occurrence (see recur). Then the todos
+// affected are rolled up: the parent of a todo that was finished or moved, the
+// old parent of a moved todo, and a todo that was just told to auto-complete.
+// It returns after, or its newer version if it changed again.
+func (s *TodoService) afterSave(ctx context.Context, before, after *models.Todo) *models.Todo {
+	moved := before.ParentID != after.ParentID
+	finished := !s.workflow.IsDone(before.Status) && s.workflow.IsDone(after.Status)
+	if finished && after.Recurrence != nil && after.Recurrence.NextID == "" {
+		// The next occurrence is created first, so that an auto-completing
+		// parent waits for it too.
+		if linked := s.recur(ctx, after); linked != nil {
+			after = linked
+		}
+	}
+	if after.ParentID != "" && (moved || finished) {
+		s.rollUp(ctx, after.ParentID)
+	}
+	if moved && before.ParentID != "" {
+		s.rollUp(ctx, before.ParentID)
+	}
+	if after.AutoComplete && !before.AutoComplete {
+		if completed := s.rollUp(ctx, after.ID); completed != nil {
+			return completed
+		}
+	}
+	return after
+}
+
+// DeleteTodo deletes a todo. policy decides what happens to its subtasks;
+// with SubtasksReject a todo that has any cannot be deleted.
+func (s *TodoService) DeleteTodo(ctx context.Context, id string, policy SubtaskPolicy) error {
+	todo, err := s.storage.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	subtasks, err := s.subtasks(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if len(subtasks) > 0 {
+		switch policy {
+		case SubtasksCascade:
+			for _, sub := range subtasks {
+				if err := s.deleteSubtree(ctx, sub); err != nil {
+					return err
+				}
+			}
+		case SubtasksPromote:
+			for _, sub := range subtasks {
+				_, err := s.modify(ctx, sub.ID, 0, func(sub *models.Todo) (*workflow.Transition, error) {
+					sub.ParentID = todo.ParentID
+					return nil, nil
+				})
+				if err != nil && !errors.Is(err, storage.ErrNotFound) {
+					return err
+				}
+			}
+		default:
+			return fmt.Errorf("%w: it has %d; delete them with it or promote them", ErrHasSubtasks, len(subtasks))
+		}
+	}
+
+	if err := s.unlinkBlocker(ctx, id); err != nil {
+		return err
+	}
+	if err := s.delete(ctx, todo); err != nil {
+		return err
+	}
+	if todo.ParentID != "" {
+		// The deleted todo may have been the last unfinished subtask.
+		s.rollUp(ctx, todo.ParentID)
+	}
+	return nil
+}
+
+// deleteSubtree deletes a todo and its subtasks, deepest first, so that a
+// failure part way leaves no subtask without its parent.
+func (s *TodoService) deleteSubtree(ctx context.Context, todo *models.Todo) error {
+	subtasks, err := s.subtasks(ctx, todo.ID)
+	if err != nil {
+		return err
+	}
+	for _, sub := range subtasks {
+		if err := s.deleteSubtree(ctx, sub); err != nil {
+			return err
+		}
+	}
+	if err := s.unlinkBlocker(ctx, todo.ID); err != nil {
+		return err
+	}
+	if err := s.delete(ctx, todo); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+// delete deletes a todo from storage and publishes its deletion.
+func (s *TodoService) delete(ctx context.Context, todo *models.Todo) error {
+	unlock := s.locks.lock(todo.ID)
+	defer unlock()
+	if err := s.storage.Delete(ctx, todo.ID); err != nil {
+		return err
+	}
+	s.events.Publish(ctx, events.TodoDeleted{Todo: todo})
+	return nil
+}
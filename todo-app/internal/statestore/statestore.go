@@ -0,0 +1,78 @@
+// Package statestore saves the state of the server's background subsystems,
+// such as which reminders were sent or which webhook deliveries are pending,
+// as JSON. Each subsystem names its own state type.
+package statestore
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+
+	"todo-app/internal/storage"
+)
+
+// Store loads and saves a state of type T.
+type Store[T any] interface {
+	// Load returns the saved state, or nil if nothing was saved yet.
+	Load() (*T, error)
+	Save(state *T) error
+}
+
+// File keeps the state in a JSON file, replaced atomically on every save.
+type File[T any] struct {
+	Path string
+}
+
+func (f File[T]) Load() (*T, error) {
+	data, err := os.ReadFile(f.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var state T
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func (f File[T]) Save(state *T) error {
+	return storage.WriteFileAtomic(f.Path, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(state)
+	})
+}
+
+// Memory keeps the state in memory, for servers whose todos do not outlive
+// them either. The state is kept encoded, so that the saved copy does not
+// change with the caller's.
+type Memory[T any] struct {
+	mu    sync.Mutex
+	state []byte
+}
+
+func (m *Memory[T]) Load() (*T, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.state == nil {
+		return nil, nil
+	}
+	var state T
+	return &state, json.Unmarshal(m.state, &state)
+}
+
+func (m *Memory[T]) Save(state *T) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.state = data
+	return nil
+}
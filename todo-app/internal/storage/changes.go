@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"sort"
+	"time"
+	"todo-app/internal/models"
+)
+
+// Tombstone records that a todo was deleted, so that clients syncing changes
+// learn of the deletion. Tombstones are kept for good; a todo created again
+// with the same ID replaces its tombstone.
+type Tombstone struct {
+	ID        string    `json:"id"`
+	DeletedAt time.Time `json:"deleted_at"`
+	// Seq is the change sequence number of the deletion.
+	Seq int64 `json:"seq"`
+}
+
+// Change is a todo as last saved, or the tombstone of a deleted one.
+type Change struct {
+	Todo      *models.Todo
+	Tombstone *Tombstone
+}
+
+// Key returns the change's place in the order of changes.
+func (c *Change) Key() ChangeKey {
+	if c.Tombstone != nil {
+		return ChangeKey{Seq: c.Tombstone.Seq, ID: c.Tombstone.ID}
+	}
+	return ChangeKey{Seq: c.Todo.Seq, ID: c.Todo.ID}
+}
+
+// ChangeKey orders changes: by the sequence number of the save, then by todo
+// ID, since a write changing several todos at once may give them all the same
+// number. The zero key comes before every change.
+type ChangeKey struct {
+	Seq int64
+	ID  string
+}
+
+// Less reports whether k comes before other.
+func (k ChangeKey) Less(other ChangeKey) bool {
+	if k.Seq != other.Seq {
+		return k.Seq < other.Seq
+	}
+	return k.ID < other.ID
+}
+
+// collectChanges returns copies of the todos and tombstones after key, in key
+// order, up to limit of them (0 means all). Todos without a sequence number
+// have not been saved yet and are left out.
+func collectChanges(todos map[string]*models.Todo, tombstones map[string]*Tombstone, after ChangeKey, limit int) []*Change {
+	var changes []*Change
+	for _, todo := range todos {
+		if todo.Seq > 0 && after.Less(ChangeKey{Seq: todo.Seq, ID: todo.ID}) {
+			changes = append(changes, &Change{Todo: todo.Clone()})
+		}
+	}
+	for _, t := range tombstones {
+		if after.Less(ChangeKey{Seq: t.Seq, ID: t.ID}) {
+			t := *t
+			changes = append(changes, &Change{Tombstone: &t})
+		}
+	}
+	return sortChanges(changes, limit)
+}
+
+// sortChanges puts changes in key order and keeps the first limit of them
+// (0 means all).
+func sortChanges(changes []*Change, limit int) []*Change {
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key().Less(changes[j].Key()) })
+	if limit > 0 && len(changes) > limit {
+		changes = changes[:limit]
+	}
+	return changes
+}
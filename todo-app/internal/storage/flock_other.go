@@ -0,0 +1,16 @@
+//go:build !unix
+
+package storage
+
+import "os"
+
+// Advisory file locking is only implemented on Unix. Elsewhere a single
+// process is still safe, but processes sharing a JSON file are not
+// coordinated.
+func lockFile(f *os.File, exclusive bool) error {
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,192 @@
+package storage
+
+import (
+	"sort"
+	"todo-app/internal/filter"
+	"todo-app/internal/models"
+	"todo-app/internal/search"
+)
+
+// TagCount is a tag and the number of todos carrying it.
+type TagCount struct {
+	Tag   string
+	Count int
+}
+
+type idSet map[string]struct{}
+
+// todoIndex holds the secondary indexes the in-memory backends keep next to
+// their map of todos: full text, tags, priorities, parents and blockers. It
+// is guarded by the same lock as the map.
+type todoIndex struct {
+	text       *search.Index
+	tags       map[string]idSet
+	priorities map[models.Priority]idSet
+	children   map[string]idSet       // by parent ID; "" holds top-level todos
+	dependents map[string]idSet       // by blocker ID
+	indexed    map[string]indexedTodo // what put last recorded per todo
+}
+
+type indexedTodo struct {
+	tags      []string
+	priority  models.Priority
+	parentID  string
+	blockedBy []string
+}
+
+func newTodoIndex() *todoIndex {
+	return &todoIndex{
+		text:       search.NewIndex(),
+		tags:       make(map[string]idSet),
+		priorities: make(map[models.Priority]idSet),
+		children:   make(map[string]idSet),
+		dependents: make(map[string]idSet),
+		indexed:    make(map[string]indexedTodo),
+	}
+}
+
+// put indexes todo, replacing whatever was indexed for its ID.
+func (x *todoIndex) put(todo *models.Todo) {
+	x.remove(todo.ID)
+
+	x.text.Put(todo.ID, todo.Title, todo.Description)
+	for _, tag := range todo.Tags {
+		addID(x.tags, tag, todo.ID)
+	}
+	addID(x.priorities, todo.Priority, todo.ID)
+	addID(x.children, todo.ParentID, todo.ID)
+	for _, blocker := range todo.BlockedBy {
+		addID(x.dependents, blocker, todo.ID)
+	}
+	x.indexed[todo.ID] = indexedTodo{
+		tags:      append([]string(nil), todo.Tags...),
+		priority:  todo.Priority,
+		parentID:  todo.ParentID,
+		blockedBy: append([]string(nil), todo.BlockedBy...),
+	}
+}
+
+func (x *todoIndex) remove(id string) {
+	old, ok := x.indexed[id]
+	if !ok {
+		return
+	}
+	x.text.Remove(id)
+	for _, tag := range old.tags {
+		removeID(x.tags, tag, id)
+	}
+	removeID(x.priorities, old.priority, id)
+	removeID(x.children, old.parentID, id)
+	for _, blocker := range old.blockedBy {
+		removeID(x.dependents, blocker, id)
+	}
+	delete(x.indexed, id)
+}
+
+func addID[K comparable](sets map[K]idSet, key K, id string) {
+	if sets[key] == nil {
+		sets[key] = make(idSet)
+	}
+	sets[key][id] = struct{}{}
+}
+
+func removeID[K comparable](sets map[K]idSet, key K, id string) {
+	delete(sets[key], id)
+	if len(sets[key]) == 0 {
+		delete(sets, key)
+	}
+}
+
+// candidates narrows a filter down to the todos that can match it using the
+// tag, priority, parent and blocker indexes. ok is false when the indexes cannot narrow it and
+// every todo has to be checked. The result is a superset of the matches, so
+// the filter must still be applied.
+func (x *todoIndex) candidates(e filter.Expr) (ids idSet, ok bool) {
+	switch e := e.(type) {
+	case filter.Compare:
+		switch {
+		case e.Field == filter.FieldTag && e.Op == filter.OpEq:
+			return union(x.tags[e.Value]), true
+		case e.Field == filter.FieldParent && e.Op == filter.OpEq:
+			return union(x.children[e.Value]), true
+		case e.Field == filter.FieldBlockedBy && e.Op == filter.OpEq:
+			return union(x.dependents[e.Value]), true
+		case e.Field == filter.FieldPriority:
+			ids := make(idSet)
+			for p, set := range x.priorities {
+				if filter.Match(e, &models.Todo{Priority: p}) {
+					ids = union(ids, set)
+				}
+			}
+			return ids, true
+		}
+	case filter.And:
+		left, lok := x.candidates(e.Left)
+		right, rok := x.candidates(e.Right)
+		switch {
+		case lok && rok:
+			return intersect(left, right), true
+		case lok:
+			return left, true
+		case rok:
+			return right, true
+		}
+	case filter.Or:
+		left, lok := x.candidates(e.Left)
+		right, rok := x.candidates(e.Right)
+		if lok && rok {
+			return union(left, right), true
+		}
+	}
+	return nil, false
+}
+
+func union(sets ...idSet) idSet {
+	out := make(idSet)
+	for _, set := range sets {
+		for id := range set {
+			out[id] = struct{}{}
+		}
+	}
+	return out
+}
+
+func intersect(a, b idSet) idSet {
+	if len(b) < len(a) {
+		a, b = b, a
+	}
+	out := make(idSet)
+	for id := range a {
+		if _, ok := b[id]; ok {
+			out[id] = struct{}{}
+		}
+	}
+	return out
+}
+
+// selectTodos returns copies of the todos that may match e, for queryTodos to
+// filter and sort.
+func (x *todoIndex) selectTodos(todos map[string]*models.Todo, e filter.Expr) []*models.Todo {
+	ids, ok := x.candidates(e)
+	if !ok {
+		out := make([]*models.Todo, 0, len(todos))
+		for _, todo := range todos {
+			out = append(out, todo.Clone())
+		}
+		return out
+	}
+	out := make([]*models.Todo, 0, len(ids))
+	for id := range ids {
+		out = append(out, todos[id].Clone())
+	}
+	return out
+}
+
+func (x *todoIndex) tagCounts() []TagCount {
+	counts := make([]TagCount, 0, len(x.tags))
+	for tag, ids := range x.tags {
+		counts = append(counts, TagCount{Tag: tag, Count: len(ids)})
+	}
+	sort.Slice(counts, func(i, j int) bool { return counts[i].Tag < counts[j].Tag })
+	return counts
+}
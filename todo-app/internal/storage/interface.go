@@ -1,12 +1,32 @@
 package storage
 
-import "todo-app/internal/models"
+import (
+    "context"
+    "todo-app/internal/models"
+)
 
+// TodoStorage persists todos. Implementations must return ctx.Err() once ctx
+// is done instead of starting or continuing work.
 type TodoStorage interface {
-    Create(todo *models.Todo) error
-    GetByID(id string) (*models.Todo, error)
-    GetAll() ([]*models.Todo, error)
-    Update(todo *models.Todo) error
-    Delete(id string) error
-    FilterByStatus(status models.Status) ([]*models.Todo, error)
+    Create(ctx context.Context, todo *models.Todo) error
+    GetByID(ctx context.Context, id string) (*models.Todo, error)
+    GetAll(ctx context.Context) ([]*models.Todo, error)
+    // Query returns one sorted page of todos.
+    Query(ctx context.Context, q Query) (*Page, error)
+    Update(ctx context.Context, todo *models.Todo) error
+    // Delete removes a todo, leaving a tombstone of it.
+    Delete(ctx context.Context, id string) error
+    // Search returns up to limit todos (0 means all) whose title or
+    // description contains every term of query, best match first.
+    Search(ctx context.Context, query string, limit int) ([]*SearchHit, error)
+    // Tags lists every tag in use with the number of todos carrying it,
+    // sorted by tag.
+    Tags(ctx context.Context) ([]TagCount, error)
+    // Changes returns up to limit (0 means all) todos and tombstones whose
+    // last save comes after the key after, in key order. Every save gives
+    // the todo (or tombstone) a sequence number greater than that of any
+    // change Changes has returned before.
+    Changes(ctx context.Context, after ChangeKey, limit int) ([]*Change, error)
+    // Tombstone returns the tombstone of a deleted todo, or ErrNotFound.
+    Tombstone(ctx context.Context, id string) (*Tombstone, error)
 }
\ No newline at end of file
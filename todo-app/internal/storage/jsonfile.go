@@ -1,73 +1,742 @@
 package storage
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"sort"
 	"sync"
 	"time"
+	"todo-app/internal/hlc"
 	"todo-app/internal/models"
 )
 
+// compactThreshold is the number of log records after which the log is folded
+// back into the snapshot.
+const compactThreshold = 1000
+
+// JSONFileStorage keeps todos in memory and persists them as a JSON snapshot
+// plus an append-only mutation log next to it (<file>.wal). Every mutation is
+// appended and fsynced to the log before it is acknowledged; the snapshot is
+// only rewritten, atomically, when the log is compacted.
+//
+// Mutations are applied to the map under mutex and queued; a background
+// flusher owns the log file and writes everything queued since its last run
+// with a single fsync. Callers wait for the flush that covers their record
+// without holding any lock, so bursts of writes coalesce into one disk write.
+//
+// Several processes may share the same files. Every read-modify-write of the
+// files happens under an advisory lock on <file>.lock, and before touching
+// the map each process catches up with records other processes appended, or
+// reloads entirely if the snapshot was replaced. Because the log holds
+// per-todo records rather than whole-file rewrites, concurrent writers merge.
+// For the same reason change sequence numbers are given out by the flusher,
+// under the file lock, rather than when a mutation is queued.
 type JSONFileStorage struct {
-	filepath string
-	todos    map[string]*models.Todo
-	mutex    sync.RWMutex
+	filepath   string
+	todos      map[string]*models.Todo
+	tombstones map[string]*Tombstone
+	index      *todoIndex
+	mutex      sync.RWMutex
+
+	// Guarded by mutex.
+	seq       int64 // highest change sequence number seen
+	pending   []pendingRecord
+	closed    bool
+	err       error       // sticky: set when the log could not be written
+	snapshot  os.FileInfo // snapshot as of our last load or compaction
+	logOffset int64       // bytes of the log already reflected in todos
+
+	// lockFile carries the inter-process lock. flock locks belong to the open
+	// file, so lockMu keeps our own goroutines from converting each other's
+	// lock; it is always taken before mutex.
+	lockFile *os.File
+	lockMu   sync.Mutex
+
+	// Owned by the flusher goroutine.
+	log        *os.File
+	logRecords int
+
+	flushInterval time.Duration
+	kick          chan struct{}
+	quit          chan struct{}
+	done          chan struct{}
+}
+
+type pendingRecord struct {
+	rec  logRecord
+	done chan error
+	// version is the version of the todo an update replaces. Another
+	// process may have saved the todo since we checked it, so it is checked
+	// again, under the file lock, before the record is written. It is 0 for
+	// records that replace whatever is there.
+	version int64
+}
+
+type logOp string
+
+const (
+	opPut    logOp = "put"
+	opDelete logOp = "delete"
+)
+
+// logRecord is one line of the mutation log. A put carries the todo, a
+// delete its tombstone; deletes logged before tombstones were kept have none.
+type logRecord struct {
+	Op        logOp
+	ID        string
+	Todo      *models.Todo
+	Tombstone *Tombstone
+}
+
+// storedRecord is how a logRecord is written.
+type storedRecord struct {
+	Op        logOp       `json:"op"`
+	ID        string      `json:"id"`
+	Todo      *storedTodo `json:"todo,omitempty"`
+	Tombstone *Tombstone  `json:"tombstone,omitempty"`
+}
+
+func (rec logRecord) MarshalJSON() ([]byte, error) {
+	return json.Marshal(storedRecord{Op: rec.Op, ID: rec.ID, Todo: newStoredTodo(rec.Todo), Tombstone: rec.Tombstone})
+}
+
+func (rec *logRecord) UnmarshalJSON(data []byte) error {
+	var stored storedRecord
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return err
+	}
+	*rec = logRecord{Op: stored.Op, ID: stored.ID, Todo: stored.Todo.todo(), Tombstone: stored.Tombstone}
+	return nil
+}
+
+// setSeq gives the record's todo or tombstone its change sequence number.
+func (rec logRecord) setSeq(seq int64) {
+	switch {
+	case rec.Todo != nil:
+		rec.Todo.Seq = seq
+	case rec.Tombstone != nil:
+		rec.Tombstone.Seq = seq
+	}
+}
+
+// storedTodo is a todo as the files keep it: with the bookkeeping its JSON
+// otherwise leaves out.
+type storedTodo struct {
+	*models.Todo
+	Clocks map[string]hlc.Timestamp `json:"clocks,omitempty"`
+	Seq    int64                    `json:"seq,omitempty"`
+}
+
+func newStoredTodo(todo *models.Todo) *storedTodo {
+	if todo == nil {
+		return nil
+	}
+	return &storedTodo{Todo: todo, Clocks: todo.Clocks, Seq: todo.Seq}
+}
+
+func (s *storedTodo) todo() *models.Todo {
+	if s == nil || s.Todo == nil {
+		return nil
+	}
+	s.Todo.Clocks = s.Clocks
+	s.Todo.Seq = s.Seq
+	return s.Todo
+}
+
+// snapshotFormat identifies the current snapshot layout, snapshotFile.
+// Snapshots written before tombstones were kept are a bare JSON object of
+// todos by ID.
+const snapshotFormat = 2
+
+type snapshotFile struct {
+	Format     int                    `json:"format"`
+	Todos      map[string]*storedTodo `json:"todos"`
+	Tombstones map[string]*Tombstone  `json:"tombstones"`
 }
 
-func NewJSONFileStorage(filepath string) (*JSONFileStorage, error) {
+// NewJSONFileStorage opens the store at filepath. flushInterval is how long
+// the flusher waits after the first queued mutation before writing, trading
+// write latency for larger batches; zero flushes as soon as possible.
+func NewJSONFileStorage(filepath string, flushInterval time.Duration) (*JSONFileStorage, error) {
 	storage := &JSONFileStorage{
-		filepath: filepath,
-		todos:    make(map[string]*models.Todo),
+		filepath:      filepath,
+		todos:         make(map[string]*models.Todo),
+		tombstones:    make(map[string]*Tombstone),
+		index:         newTodoIndex(),
+		flushInterval: flushInterval,
+		kick:          make(chan struct{}, 1),
+		quit:          make(chan struct{}),
+		done:          make(chan struct{}),
 	}
 
-	// Load existing data if file exists
-	if _, err := os.Stat(filepath); err == nil {
-		if err := storage.load(); err != nil {
-			return nil, err
+	lockFile, err := os.OpenFile(filepath+".lock", os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	storage.lockFile = lockFile
+
+	log, err := os.OpenFile(storage.logPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		lockFile.Close()
+		return nil, err
+	}
+	storage.log = log
+
+	// Load, then fold whatever was replayed into a fresh snapshot so the next
+	// start doesn't have to replay it again.
+	err = storage.withFileLock(true, func() error {
+		storage.mutex.Lock()
+		defer storage.mutex.Unlock()
+
+		if err := storage.loadLocked(); err != nil {
+			return err
 		}
+		storage.numberLocked()
+		return storage.compactLocked()
+	})
+	if err != nil {
+		log.Close()
+		lockFile.Close()
+		return nil, err
 	}
 
+	go storage.run()
 	return storage, nil
 }
 
-func (j *JSONFileStorage) load() error {
-	j.mutex.Lock()
-	defer j.mutex.Unlock()
+func (j *JSONFileStorage) logPath() string {
+	return j.filepath + ".wal"
+}
+
+// withFileLock runs fn while holding the inter-process lock.
+func (j *JSONFileStorage) withFileLock(exclusive bool, fn func() error) error {
+	j.lockMu.Lock()
+	defer j.lockMu.Unlock()
+
+	if err := lockFile(j.lockFile, exclusive); err != nil {
+		return err
+	}
+	defer unlockFile(j.lockFile)
+	return fn()
+}
+
+// loadLocked rebuilds the map from the snapshot and the whole log, then
+// re-applies our own queued mutations on top. The caller must hold the file
+// lock and j.mutex.
+func (j *JSONFileStorage) loadLocked() error {
+	todos := make(map[string]*models.Todo)
+	tombstones := make(map[string]*Tombstone)
+	info, err := os.Stat(j.filepath)
+	switch {
+	case err == nil:
+		if todos, tombstones, err = readSnapshot(j.filepath); err != nil {
+			return err
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return err
+	}
 
-	file, err := os.Open(j.filepath)
+	j.todos = todos
+	j.tombstones = tombstones
+	j.index = newTodoIndex()
+	for _, todo := range todos {
+		j.index.put(todo)
+		j.seq = max(j.seq, todo.Seq)
+	}
+	for _, t := range tombstones {
+		j.seq = max(j.seq, t.Seq)
+	}
+	j.snapshot = info
+	j.logOffset = 0
+	return j.catchUpLogLocked(true)
+}
+
+func readSnapshot(path string) (map[string]*models.Todo, map[string]*Tombstone, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	todos := make(map[string]*models.Todo)
+	tombstones := make(map[string]*Tombstone)
+	if _, ok := raw["format"]; !ok {
+		for id, data := range raw {
+			var todo storedTodo
+			if err := json.Unmarshal(data, &todo); err != nil {
+				return nil, nil, fmt.Errorf("%s: todo %s: %w", path, id, err)
+			}
+			todos[id] = todo.todo()
+		}
+		return todos, tombstones, nil
+	}
+
+	var snapshot snapshotFile
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if snapshot.Format != snapshotFormat {
+		return nil, nil, fmt.Errorf("%s: unsupported snapshot format %d", path, snapshot.Format)
+	}
+	for id, todo := range snapshot.Todos {
+		todos[id] = todo.todo()
+	}
+	for id, t := range snapshot.Tombstones {
+		tombstones[id] = t
+	}
+	return todos, tombstones, nil
+}
+
+// numberLocked gives the todos saved before change sequence numbers were kept
+// one each, in the order they were created, so that a full sync returns them.
+// The caller must hold the exclusive file lock and j.mutex.
+func (j *JSONFileStorage) numberLocked() {
+	var unnumbered []*models.Todo
+	for _, todo := range j.todos {
+		if todo.Seq == 0 {
+			unnumbered = append(unnumbered, todo)
+		}
+	}
+	sort.Slice(unnumbered, func(a, b int) bool {
+		if !unnumbered[a].CreatedAt.Equal(unnumbered[b].CreatedAt) {
+			return unnumbered[a].CreatedAt.Before(unnumbered[b].CreatedAt)
+		}
+		return unnumbered[a].ID < unnumbered[b].ID
+	})
+	for _, todo := range unnumbered {
+		j.seq++
+		todo.Seq = j.seq
+	}
+}
+
+// catchUpLogLocked applies log records past logOffset, then re-applies our
+// queued mutations so they still win over what was read. An update whose
+// todo another process saved in the meantime is dropped from the queue and
+// fails with ErrConflict instead, as it would have had it come second in the
+// same process, and so does any later update of ours built on it. Only the
+// todos read from the files are checked: reloaded says the whole map was,
+// otherwise just those the new records touched, the rest still holding our
+// queued mutations. A dropped update is never left in the map, as the entry
+// it overwrote was replaced by the saved todo. A torn final record (a writer
+// died mid-append) was never acknowledged and is skipped; the next flush
+// truncates it away.
+func (j *JSONFileStorage) catchUpLogLocked(reloaded bool) error {
+	file, err := os.Open(j.logPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 
-	decoder := json.NewDecoder(file)
-	return decoder.Decode(&j.todos)
+	if _, err := file.Seek(j.logOffset, io.SeekStart); err != nil {
+		return err
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+
+	touched := make(map[string]bool)
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		var rec logRecord
+		if err := json.Unmarshal(data[:i], &rec); err != nil {
+			return fmt.Errorf("%s: offset %d: %w", j.logPath(), j.logOffset, err)
+		}
+		j.applyLocked(rec)
+		touched[rec.ID] = true
+		j.logOffset += int64(i + 1)
+		data = data[i+1:]
+	}
+
+	kept := j.pending[:0]
+	rejected := make(map[string]bool)
+	for _, p := range j.pending {
+		if p.version != 0 && (reloaded || touched[p.rec.ID]) {
+			if current, ok := j.todos[p.rec.ID]; rejected[p.rec.ID] || !ok || current.Version != p.version {
+				rejected[p.rec.ID] = true
+				p.done <- ErrConflict
+				continue
+			}
+		}
+		j.applyLocked(p.rec)
+		kept = append(kept, p)
+	}
+	j.pending = kept
+	return nil
 }
 
-func (j *JSONFileStorage) save() error {
-	j.mutex.Lock()
-	defer j.mutex.Unlock()
+// changedLocked reports whether another process has touched the files since
+// we last read them: reload means the snapshot was replaced, tail means only
+// new log records were appended. The caller must hold j.mutex (a read lock is
+// enough).
+func (j *JSONFileStorage) changedLocked() (reload, tail bool, err error) {
+	info, err := os.Stat(j.filepath)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		if j.snapshot != nil {
+			return true, false, nil
+		}
+	case err != nil:
+		return false, false, err
+	case j.snapshot == nil || !os.SameFile(info, j.snapshot) ||
+		!info.ModTime().Equal(j.snapshot.ModTime()) || info.Size() != j.snapshot.Size():
+		return true, false, nil
+	}
 
-	file, err := os.Create(j.filepath)
+	logInfo, err := os.Stat(j.logPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return j.logOffset > 0, false, nil
+	}
 	if err != nil {
+		return false, false, err
+	}
+	if logInfo.Size() < j.logOffset {
+		return true, false, nil
+	}
+	return false, logInfo.Size() > j.logOffset, nil
+}
+
+// syncLocked brings the map up to date with the files. The caller must hold
+// the file lock and j.mutex.
+func (j *JSONFileStorage) syncLocked() error {
+	reload, tail, err := j.changedLocked()
+	switch {
+	case err != nil:
 		return err
+	case reload:
+		return j.loadLocked()
+	case tail:
+		return j.catchUpLogLocked(false)
 	}
-	defer file.Close()
+	return nil
+}
+
+// refresh picks up changes made by other processes. The common case, nothing
+// changed, costs two stat calls and no file lock.
+func (j *JSONFileStorage) refresh() error {
+	j.mutex.RLock()
+	reload, tail, err := j.changedLocked()
+	j.mutex.RUnlock()
+	if err != nil || (!reload && !tail) {
+		return err
+	}
+
+	return j.withFileLock(false, func() error {
+		j.mutex.Lock()
+		defer j.mutex.Unlock()
+		return j.syncLocked()
+	})
+}
+
+func (j *JSONFileStorage) applyLocked(rec logRecord) {
+	switch rec.Op {
+	case opPut:
+		j.todos[rec.ID] = rec.Todo
+		delete(j.tombstones, rec.ID)
+		j.index.put(rec.Todo)
+		j.seq = max(j.seq, rec.Todo.Seq)
+	case opDelete:
+		delete(j.todos, rec.ID)
+		j.index.remove(rec.ID)
+		tombstone := rec.Tombstone
+		if tombstone == nil {
+			tombstone = &Tombstone{ID: rec.ID}
+		}
+		j.tombstones[rec.ID] = tombstone
+		j.seq = max(j.seq, tombstone.Seq)
+	}
+}
+
+// enqueueLocked applies rec to the in-memory map and queues it for the flusher.
+// The caller must hold j.mutex for writing and must wait on the returned
+// channel only after releasing it.
+func (j *JSONFileStorage) enqueueLocked(rec logRecord, version int64) (<-chan error, error) {
+	if j.closed {
+		return nil, ErrClosed
+	}
+	if j.err != nil {
+		return nil, j.err
+	}
+
+	j.applyLocked(rec)
+	done := make(chan error, 1)
+	j.pending = append(j.pending, pendingRecord{rec: rec, done: done, version: version})
+
+	select {
+	case j.kick <- struct{}{}:
+	default:
+	}
+	return done, nil
+}
+
+// wait blocks until the flush covering a mutation finishes. If ctx ends first
+// the mutation may still be persisted; the caller just stops waiting for it.
+func wait(ctx context.Context, done <-chan error) error {
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run is the flusher loop.
+func (j *JSONFileStorage) run() {
+	defer close(j.done)
+	for {
+		select {
+		case <-j.kick:
+		case <-j.quit:
+			j.flush()
+			return
+		}
+
+		if j.flushInterval > 0 {
+			timer := time.NewTimer(j.flushInterval)
+			select {
+			case <-timer.C:
+			case <-j.quit:
+				timer.Stop()
+				j.flush()
+				return
+			}
+		}
+		j.flush()
+	}
+}
+
+// flush writes every queued record with one write and one fsync, then
+// releases the waiting callers. A failed write leaves the in-memory map ahead
+// of the disk, so the error is made sticky and the store refuses further
+// mutations rather than acknowledging writes it can no longer persist.
+func (j *JSONFileStorage) flush() {
+	var batch []pendingRecord
+	err := j.withFileLock(true, func() error {
+		j.mutex.Lock()
+		if err := j.syncLocked(); err != nil {
+			j.mutex.Unlock()
+			return err
+		}
+		batch = j.pending
+		j.pending = nil
+		offset := j.logOffset
+		// The map holds the records' todos and tombstones themselves, so
+		// numbering the records numbers those too.
+		for _, p := range batch {
+			j.seq++
+			p.rec.setSeq(j.seq)
+		}
+		j.mutex.Unlock()
+
+		if len(batch) == 0 {
+			return nil
+		}
+
+		// Drop a torn record some writer left behind so ours starts on a
+		// fresh line.
+		if err := j.log.Truncate(offset); err != nil {
+			return err
+		}
+		n, err := j.writeBatch(batch)
+		if err != nil {
+			return err
+		}
 
-	encoder := json.NewEncoder(file)
-	encoder.SetIndent("", "  ")
-	return encoder.Encode(j.todos)
+		j.mutex.Lock()
+		defer j.mutex.Unlock()
+		j.logOffset += n
+		j.logRecords += len(batch)
+		if j.logRecords >= compactThreshold {
+			return j.compactLocked()
+		}
+		return nil
+	})
+
+	if err != nil {
+		j.mutex.Lock()
+		j.err = fmt.Errorf("%w: json storage: %w", ErrUnavailable, err)
+		// Fail anything still queued as well; it will never be written.
+		batch = append(batch, j.pending...)
+		j.pending = nil
+		j.mutex.Unlock()
+	}
+
+	for _, p := range batch {
+		p.done <- err
+	}
+}
+
+func (j *JSONFileStorage) writeBatch(batch []pendingRecord) (int64, error) {
+	var buf bytes.Buffer
+	for _, p := range batch {
+		data, err := json.Marshal(p.rec)
+		if err != nil {
+			return 0, err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+
+	n, err := j.log.Write(buf.Bytes())
+	if err != nil {
+		return int64(n), err
+	}
+	return int64(n), j.log.Sync()
+}
+
+// compactLocked writes the current state as a new snapshot and truncates the
+// log. The snapshot is renamed into place before the log is cleared, so a
+// crash in between only means some records are replayed twice, which is
+// harmless. The snapshot may also contain mutations still queued for the log;
+// they are re-applied on replay just the same. The caller must hold the
+// exclusive file lock and j.mutex.
+func (j *JSONFileStorage) compactLocked() error {
+	if err := WriteFileAtomic(j.filepath, func(w io.Writer) error {
+		snapshot := snapshotFile{
+			Format:     snapshotFormat,
+			Todos:      make(map[string]*storedTodo, len(j.todos)),
+			Tombstones: j.tombstones,
+		}
+		for id, todo := range j.todos {
+			snapshot.Todos[id] = newStoredTodo(todo)
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(snapshot)
+	}); err != nil {
+		return err
+	}
+	info, err := os.Stat(j.filepath)
+	if err != nil {
+		return err
+	}
+	j.snapshot = info
+
+	if err := j.log.Truncate(0); err != nil {
+		return err
+	}
+	if err := j.log.Sync(); err != nil {
+		return err
+	}
+	j.logOffset = 0
+	j.logRecords = 0
+	return nil
+}
+
+// WriteFileAtomic writes a file by writing a temp file in the same directory,
+// fsyncing it and renaming it over path. Readers see either the old or the new
+// contents, never a partial write.
+func WriteFileAtomic(path string, write func(io.Writer) error) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// syncDir makes a rename in dir durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// Close flushes queued mutations, compacts the log and releases the files.
+func (j *JSONFileStorage) Close() error {
+	j.mutex.Lock()
+	if j.closed {
+		j.mutex.Unlock()
+		return nil
+	}
+	j.closed = true
+	j.mutex.Unlock()
+
+	close(j.quit)
+	<-j.done
+
+	err := j.withFileLock(true, func() error {
+		j.mutex.Lock()
+		defer j.mutex.Unlock()
+
+		if j.err != nil {
+			return j.err
+		}
+		if err := j.syncLocked(); err != nil {
+			return err
+		}
+		return j.compactLocked()
+	})
+
+	if closeErr := j.log.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := j.lockFile.Close(); err == nil {
+		err = closeErr
+	}
+	return err
 }
 
-func (j *JSONFileStorage) Create(todo *models.Todo) error {
+func (j *JSONFileStorage) Create(ctx context.Context, todo *models.Todo) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := j.refresh(); err != nil {
+		return err
+	}
+
 	j.mutex.Lock()
-	j.todos[todo.ID] = todo
+	done, err := j.enqueueLocked(logRecord{Op: opPut, ID: todo.ID, Todo: todo.Clone()}, 0)
 	j.mutex.Unlock()
 
-	return j.save()
+	if err != nil {
+		return err
+	}
+	return wait(ctx, done)
 }
 
-func (j *JSONFileStorage) GetByID(id string) (*models.Todo, error) {
+func (j *JSONFileStorage) GetByID(ctx context.Context, id string) (*models.Todo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := j.refresh(); err != nil {
+		return nil, err
+	}
+
 	j.mutex.RLock()
 	defer j.mutex.RUnlock()
 
@@ -75,55 +744,153 @@ func (j *JSONFileStorage) GetByID(id string) (*models.Todo, error) {
 	if !exists {
 		return nil, ErrNotFound
 	}
-	return todo, nil
+	return todo.Clone(), nil
 }
 
-func (j *JSONFileStorage) GetAll() ([]*models.Todo, error) {
+func (j *JSONFileStorage) GetAll(ctx context.Context) ([]*models.Todo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := j.refresh(); err != nil {
+		return nil, err
+	}
+
 	j.mutex.RLock()
 	defer j.mutex.RUnlock()
 
 	todos := make([]*models.Todo, 0, len(j.todos))
 	for _, todo := range j.todos {
-		todos = append(todos, todo)
+		todos = append(todos, todo.Clone())
 	}
 	return todos, nil
 }
 
-func (j *JSONFileStorage) Update(todo *models.Todo) error {
-	j.mutex.Lock()
-	defer j.mutex.Unlock()
+func (j *JSONFileStorage) Update(ctx context.Context, todo *models.Todo) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := j.refresh(); err != nil {
+		return err
+	}
 
-	if _, exists := j.todos[todo.ID]; !exists {
+	j.mutex.Lock()
+	current, exists := j.todos[todo.ID]
+	if !exists {
+		j.mutex.Unlock()
 		return ErrNotFound
 	}
+	if current.Version != todo.Version {
+		j.mutex.Unlock()
+		return ErrConflict
+	}
 
+	todo.Version++
 	todo.UpdatedAt = time.Now()
-	j.todos[todo.ID] = todo
+	done, err := j.enqueueLocked(logRecord{Op: opPut, ID: todo.ID, Todo: todo.Clone()}, current.Version)
+	j.mutex.Unlock()
 
-	return j.save()
+	if err != nil {
+		return err
+	}
+	return wait(ctx, done)
 }
 
-func (j *JSONFileStorage) Delete(id string) error {
-	j.mutex.Lock()
-	defer j.mutex.Unlock()
+func (j *JSONFileStorage) Delete(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := j.refresh(); err != nil {
+		return err
+	}
 
+	j.mutex.Lock()
 	if _, exists := j.todos[id]; !exists {
+		j.mutex.Unlock()
 		return ErrNotFound
 	}
 
-	delete(j.todos, id)
-	return j.save()
+	tombstone := &Tombstone{ID: id, DeletedAt: time.Now()}
+	done, err := j.enqueueLocked(logRecord{Op: opDelete, ID: id, Tombstone: tombstone}, 0)
+	j.mutex.Unlock()
+
+	if err != nil {
+		return err
+	}
+	return wait(ctx, done)
 }
 
-func (j *JSONFileStorage) FilterByStatus(status models.Status) ([]*models.Todo, error) {
+func (j *JSONFileStorage) Query(ctx context.Context, q Query) (*Page, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := j.refresh(); err != nil {
+		return nil, err
+	}
+
+	j.mutex.RLock()
+	todos := j.index.selectTodos(j.todos, q.Filter)
+	j.mutex.RUnlock()
+
+	return queryTodos(todos, q)
+}
+
+func (j *JSONFileStorage) Search(ctx context.Context, query string, limit int) ([]*SearchHit, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := j.refresh(); err != nil {
+		return nil, err
+	}
+
 	j.mutex.RLock()
 	defer j.mutex.RUnlock()
 
-	var filtered []*models.Todo
-	for _, todo := range j.todos {
-		if todo.Status == status {
-			filtered = append(filtered, todo)
-		}
+	return searchIndex(j.index.text, j.todos, query, limit), nil
+}
+
+func (j *JSONFileStorage) Tags(ctx context.Context) ([]TagCount, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := j.refresh(); err != nil {
+		return nil, err
+	}
+
+	j.mutex.RLock()
+	defer j.mutex.RUnlock()
+
+	return j.index.tagCounts(), nil
+}
+
+func (j *JSONFileStorage) Changes(ctx context.Context, after ChangeKey, limit int) ([]*Change, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := j.refresh(); err != nil {
+		return nil, err
 	}
-	return filtered, nil
-}
\ No newline at end of file
+
+	j.mutex.RLock()
+	defer j.mutex.RUnlock()
+
+	return collectChanges(j.todos, j.tombstones, after, limit), nil
+}
+
+func (j *JSONFileStorage) Tombstone(ctx context.Context, id string) (*Tombstone, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := j.refresh(); err != nil {
+		return nil, err
+	}
+
+	j.mutex.RLock()
+	defer j.mutex.RUnlock()
+
+	t, exists := j.tombstones[id]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	c := *t
+	return &c, nil
+}
@@ -0,0 +1,338 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"todo-app/internal/models"
+)
+
+// These tests rebuild the files a crash leaves behind at each step of a
+// write (log append, snapshot write, snapshot rename, log truncate) out of
+// files a real store wrote, then check that reopening them keeps every
+// acknowledged mutation and nothing that was never acknowledged.
+
+// crashImage copies the snapshot and the log of the store at from to to, as
+// they would be found after the process died at this point.
+func crashImage(t *testing.T, from, to string) {
+	t.Helper()
+	for _, suffix := range []string{"", ".wal"} {
+		data, err := os.ReadFile(from + suffix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(to+suffix, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func openJSON(t *testing.T, path string) *JSONFileStorage {
+	t.Helper()
+	store, err := NewJSONFileStorage(path, 0)
+	if err != nil {
+		t.Fatalf("open %s: %v", path, err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// state is the todos of a store by ID.
+func state(t *testing.T, store *JSONFileStorage) map[string]*models.Todo {
+	t.Helper()
+	todos, err := store.GetAll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	byID := make(map[string]*models.Todo, len(todos))
+	for _, todo := range todos {
+		byID[todo.ID] = todo
+	}
+	return byID
+}
+
+// checkRecovered reopens the store at path and compares its todos with want,
+// the state every acknowledged mutation adds up to.
+func checkRecovered(t *testing.T, path string, want map[string]*models.Todo) {
+	t.Helper()
+	got := state(t, openJSON(t, path))
+	for id, todo := range want {
+		recovered, ok := got[id]
+		switch {
+		case !ok:
+			t.Errorf("acknowledged todo %s (%q) was lost", id, todo.Title)
+		case recovered.Title != todo.Title || recovered.Version != todo.Version:
+			t.Errorf("todo %s recovered as %q version %d, want %q version %d",
+				id, recovered.Title, recovered.Version, todo.Title, todo.Version)
+		}
+	}
+	for id, todo := range got {
+		if _, ok := want[id]; !ok {
+			t.Errorf("unacknowledged todo %s (%q) was recovered", id, todo.Title)
+		}
+	}
+}
+
+// acknowledged runs a few mutations against a fresh store at path, each one
+// returning only once it is in the log, and returns the store and the state
+// they leave it in. The snapshot is the empty one written when the store was
+// opened, so everything is in the log.
+func acknowledged(t *testing.T, path string) (*JSONFileStorage, map[string]*models.Todo) {
+	t.Helper()
+	ctx := context.Background()
+	store := openJSON(t, path)
+	for _, todo := range []*models.Todo{
+		{ID: "a", Title: "write report", Version: 1},
+		{ID: "b", Title: "book flights", Version: 1},
+		{ID: "c", Title: "call plumber", Version: 1},
+	} {
+		if err := store.Create(ctx, todo); err != nil {
+			t.Fatal(err)
+		}
+	}
+	updated := &models.Todo{ID: "a", Title: "write the report", Version: 1}
+	if err := store.Update(ctx, updated); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete(ctx, "b"); err != nil {
+		t.Fatal(err)
+	}
+	return store, state(t, store)
+}
+
+// TestJSONFileCrashAfterLogAppend crashes once records are in the log but
+// before any compaction folded them into the snapshot.
+func TestJSONFileCrashAfterLogAppend(t *testing.T) {
+	dir := t.TempDir()
+	live := filepath.Join(dir, "live.json")
+	_, want := acknowledged(t, live)
+
+	crashed := filepath.Join(dir, "crashed.json")
+	crashImage(t, live, crashed)
+	checkRecovered(t, crashed, want)
+}
+
+// TestJSONFileCrashBeforeSnapshotRename crashes while compacting, after the
+// new snapshot was written to its temp file but before it was renamed into
+// place. The temp file holds a todo that was still queued and never
+// acknowledged.
+func TestJSONFileCrashBeforeSnapshotRename(t *testing.T) {
+	dir := t.TempDir()
+	live := filepath.Join(dir, "live.json")
+	store, want := acknowledged(t, live)
+
+	crashed := filepath.Join(dir, "crashed.json")
+	crashImage(t, live, crashed)
+
+	// The snapshot the compaction would have written, queued todo included.
+	if err := store.Create(context.Background(), &models.Todo{ID: "d", Title: "never acknowledged", Version: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := os.ReadFile(live)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(crashed+".tmp-123456", snapshot, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	checkRecovered(t, crashed, want)
+}
+
+// TestJSONFileCrashBeforeLogTruncate crashes while compacting, after the new
+// snapshot was renamed into place but before the log was truncated, so every
+// record is replayed on top of a snapshot that already holds it.
+func TestJSONFileCrashBeforeLogTruncate(t *testing.T) {
+	dir := t.TempDir()
+	live := filepath.Join(dir, "live.json")
+	_, want := acknowledged(t, live)
+
+	crashed := filepath.Join(dir, "crashed.json")
+	crashImage(t, live, crashed)
+	log, err := os.ReadFile(crashed + ".wal")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Opening compacts: this writes the snapshot and truncates the log.
+	// Putting the log back gives the files as they were between the two.
+	compacted := openJSON(t, crashed)
+	if err := compacted.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(crashed+".wal", log, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	checkRecovered(t, crashed, want)
+}
+
+// TestJSONFileCrashMidAppend crashes partway through appending a record, so
+// the log ends in a torn line. The record was never fsynced, so never
+// acknowledged.
+func TestJSONFileCrashMidAppend(t *testing.T) {
+	dir := t.TempDir()
+	live := filepath.Join(dir, "live.json")
+	_, want := acknowledged(t, live)
+
+	crashed := filepath.Join(dir, "crashed.json")
+	crashImage(t, live, crashed)
+
+	rec, err := json.Marshal(logRecord{Op: opPut, ID: "d", Todo: &models.Todo{ID: "d", Title: "never acknowledged", Version: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	log, err := os.OpenFile(crashed+".wal", os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := log.Write(rec[:len(rec)/2]); err != nil {
+		t.Fatal(err)
+	}
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	checkRecovered(t, crashed, want)
+}
+
+// TestJSONFileTornRecordFromOtherWriter leaves a torn record at the end of
+// the log of an open store, as another process sharing the files would when
+// it died mid-append. The store must skip it when catching up and write its
+// next record on a fresh line.
+func TestJSONFileTornRecordFromOtherWriter(t *testing.T) {
+	dir := t.TempDir()
+	live := filepath.Join(dir, "live.json")
+	store, want := acknowledged(t, live)
+
+	log, err := os.OpenFile(live+".wal", os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := log.Write([]byte(`{"op":"put","id":"d","todo":{"id":"d","title":"never ackn`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	e := &models.Todo{ID: "e", Title: "water plants", Version: 1}
+	if err := store.Create(context.Background(), e); err != nil {
+		t.Fatal(err)
+	}
+	want["e"] = e
+
+	crashed := filepath.Join(dir, "crashed.json")
+	crashImage(t, live, crashed)
+	checkRecovered(t, crashed, want)
+}
+
+// queuedUpdate starts an update on store, which flushes slowly, and returns
+// once it is applied in memory but not yet written, with a channel for its
+// result.
+func queuedUpdate(t *testing.T, store *JSONFileStorage, todo *models.Todo) <-chan error {
+	t.Helper()
+	result := make(chan error, 1)
+	go func() { result <- store.Update(context.Background(), todo.Clone()) }()
+	for deadline := time.Now().Add(time.Second); ; {
+		queued, err := store.GetByID(context.Background(), todo.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if queued.Title == todo.Title {
+			return result
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("update was never applied")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestJSONFileConcurrentUpdateConflict has two stores on the same files
+// update the same todo. The one that writes second must fail with
+// ErrConflict and serve the todo the other one saved.
+func TestJSONFileConcurrentUpdateConflict(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "todos.json")
+	slow, err := NewJSONFileStorage(path, 300*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { slow.Close() })
+	fast := openJSON(t, path)
+
+	if err := fast.Create(ctx, &models.Todo{ID: "x", Title: "x", Version: 1}); err != nil {
+		t.Fatal(err)
+	}
+	result := queuedUpdate(t, slow, &models.Todo{ID: "x", Title: "slow", Version: 1})
+	if err := fast.Update(ctx, &models.Todo{ID: "x", Title: "fast", Version: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-result; !errors.Is(err, ErrConflict) {
+		t.Fatalf("second update returned %v, want ErrConflict", err)
+	}
+
+	want := map[string]*models.Todo{"x": {ID: "x", Title: "fast", Version: 2}}
+	for name, store := range map[string]*JSONFileStorage{"slow": slow, "fast": fast} {
+		got, err := store.GetByID(ctx, "x")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Title != "fast" || got.Version != 2 {
+			t.Errorf("%s store serves %q version %d, want \"fast\" version 2", name, got.Title, got.Version)
+		}
+	}
+	slow.Close()
+	fast.Close()
+	checkRecovered(t, path, want)
+}
+
+// TestJSONFileUnrelatedAppendKeepsUpdate has another store append a record
+// for a different todo while an update is queued. The update must still be
+// written.
+func TestJSONFileUnrelatedAppendKeepsUpdate(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "todos.json")
+	slow, err := NewJSONFileStorage(path, 300*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { slow.Close() })
+	fast := openJSON(t, path)
+
+	if err := slow.Create(ctx, &models.Todo{ID: "x", Title: "x", Version: 1}); err != nil {
+		t.Fatal(err)
+	}
+	result := queuedUpdate(t, slow, &models.Todo{ID: "x", Title: "x2", Version: 1})
+	if err := fast.Create(ctx, &models.Todo{ID: "y", Title: "y", Version: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-result; err != nil {
+		t.Fatalf("update returned %v", err)
+	}
+
+	want := map[string]*models.Todo{
+		"x": {ID: "x", Title: "x2", Version: 2},
+		"y": {ID: "y", Title: "y", Version: 1},
+	}
+	for name, store := range map[string]*JSONFileStorage{"slow": slow, "fast": fast} {
+		got := state(t, store)
+		for id, todo := range want {
+			if got[id] == nil || got[id].Title != todo.Title || got[id].Version != todo.Version {
+				t.Errorf("%s store serves %s as %+v, want %q version %d", name, id, got[id], todo.Title, todo.Version)
+			}
+		}
+	}
+	slow.Close()
+	fast.Close()
+	checkRecovered(t, path, want)
+}
@@ -1,89 +1,186 @@
 package storage
 
 import (
-	"errors"
+	"context"
 	"sync"
 	"time"
+	"todo-app/internal/apperr"
 	"todo-app/internal/models"
 )
 
 type MemoryStorage struct {
-	todos map[string]*models.Todo
-	mutex sync.RWMutex
+	todos      map[string]*models.Todo
+	tombstones map[string]*Tombstone
+	seq        int64 // last change sequence number given out
+	index      *todoIndex
+	mutex      sync.RWMutex
 }
 
 func NewMemoryStorage() *MemoryStorage {
 	return &MemoryStorage{
-		todos: make(map[string]*models.Todo),
+		todos:      make(map[string]*models.Todo),
+		tombstones: make(map[string]*Tombstone),
+		index:      newTodoIndex(),
 	}
 }
 
-func (m *MemoryStorage) Create(todo *models.Todo) error {
+func (m *MemoryStorage) Create(ctx context.Context, todo *models.Todo) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
-	
-	m.todos[todo.ID] = todo
+
+	m.seq++
+	todo.Seq = m.seq
+	m.todos[todo.ID] = todo.Clone()
+	delete(m.tombstones, todo.ID)
+	m.index.put(todo)
 	return nil
 }
 
-func (m *MemoryStorage) GetByID(id string) (*models.Todo, error) {
+func (m *MemoryStorage) GetByID(ctx context.Context, id string) (*models.Todo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
-	
+
 	todo, exists := m.todos[id]
 	if !exists {
 		return nil, ErrNotFound
 	}
-	return todo, nil
+	return todo.Clone(), nil
 }
 
-func (m *MemoryStorage) GetAll() ([]*models.Todo, error) {
+func (m *MemoryStorage) GetAll(ctx context.Context) ([]*models.Todo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
-	
+
 	todos := make([]*models.Todo, 0, len(m.todos))
 	for _, todo := range m.todos {
-		todos = append(todos, todo)
+		todos = append(todos, todo.Clone())
 	}
 	return todos, nil
 }
 
-func (m *MemoryStorage) Update(todo *models.Todo) error {
+func (m *MemoryStorage) Update(ctx context.Context, todo *models.Todo) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
-	
-	if _, exists := m.todos[todo.ID]; !exists {
+
+	current, exists := m.todos[todo.ID]
+	if !exists {
 		return ErrNotFound
 	}
-	
+	if current.Version != todo.Version {
+		return ErrConflict
+	}
+
+	todo.Version++
 	todo.UpdatedAt = time.Now()
-	m.todos[todo.ID] = todo
+	m.seq++
+	todo.Seq = m.seq
+	m.todos[todo.ID] = todo.Clone()
+	m.index.put(todo)
 	return nil
 }
 
-func (m *MemoryStorage) Delete(id string) error {
+func (m *MemoryStorage) Delete(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
-	
+
 	if _, exists := m.todos[id]; !exists {
 		return ErrNotFound
 	}
-	
+
 	delete(m.todos, id)
+	m.index.remove(id)
+	m.seq++
+	m.tombstones[id] = &Tombstone{ID: id, DeletedAt: time.Now(), Seq: m.seq}
 	return nil
 }
 
-func (m *MemoryStorage) FilterByStatus(status models.Status) ([]*models.Todo, error) {
+func (m *MemoryStorage) Query(ctx context.Context, q Query) (*Page, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mutex.RLock()
+	todos := m.index.selectTodos(m.todos, q.Filter)
+	m.mutex.RUnlock()
+
+	return queryTodos(todos, q)
+}
+
+func (m *MemoryStorage) Search(ctx context.Context, query string, limit int) ([]*SearchHit, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
-	
-	var filtered []*models.Todo
-	for _, todo := range m.todos {
-		if todo.Status == status {
-			filtered = append(filtered, todo)
-		}
+
+	return searchIndex(m.index.text, m.todos, query, limit), nil
+}
+
+func (m *MemoryStorage) Tags(ctx context.Context) ([]TagCount, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return m.index.tagCounts(), nil
+}
+
+func (m *MemoryStorage) Changes(ctx context.Context, after ChangeKey, limit int) ([]*Change, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return collectChanges(m.todos, m.tombstones, after, limit), nil
+}
+
+func (m *MemoryStorage) Tombstone(ctx context.Context, id string) (*Tombstone, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
-	return filtered, nil
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	t, exists := m.tombstones[id]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	c := *t
+	return &c, nil
 }
 
-var ErrNotFound = errors.New("todo not found")
\ No newline at end of file
+var (
+	ErrNotFound = apperr.New(apperr.NotFound, "todo_not_found", "todo not found")
+	// ErrConflict means the todo changed since the caller read it.
+	ErrConflict = apperr.New(apperr.Conflict, "version_conflict", "todo was modified concurrently")
+	ErrClosed   = apperr.New(apperr.Unavailable, "storage_closed", "storage closed")
+	// ErrUnavailable wraps failures of the underlying files or database that
+	// persist until the storage is reopened.
+	ErrUnavailable = apperr.New(apperr.Unavailable, "storage_unavailable", "storage unavailable")
+)
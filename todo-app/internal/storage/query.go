@@ -0,0 +1,266 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"todo-app/internal/apperr"
+	"todo-app/internal/filter"
+	"todo-app/internal/models"
+)
+
+// Sortable fields, named as in the todo's JSON representation.
+const (
+	SortID        = "id"
+	SortTitle     = "title"
+	SortStatus    = "status"
+	SortDueDate   = "due_date"
+	SortPriority  = "priority"
+	SortCreatedAt = "created_at"
+	SortUpdatedAt = "updated_at"
+	SortPosition  = "position"
+)
+
+var ErrInvalidQuery = apperr.New(apperr.Invalid, "invalid_query", "invalid query")
+
+// SortField orders results by one field.
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// Query selects one page of todos. Results are always totally ordered: ties
+// on the Sort fields are broken by ascending ID.
+type Query struct {
+	// Filter restricts the results; nil matches every todo.
+	Filter filter.Expr
+	Sort   []SortField
+	// Limit is the maximum number of todos returned; 0 means no limit.
+	Limit int
+	// Cursor continues after the last todo of a previous page. It must come
+	// from a Page produced by a query with the same Sort.
+	Cursor string
+}
+
+// Page is the result of a Query.
+type Page struct {
+	Todos []*models.Todo
+	// NextCursor is set when more todos follow.
+	NextCursor string
+}
+
+// ParseSort parses a comma-separated sort specification such as
+// "due_date,-created_at", where a leading "-" sorts descending.
+func ParseSort(spec string) ([]SortField, error) {
+	var fields []SortField
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		field := SortField{Field: strings.TrimPrefix(part, "-"), Desc: strings.HasPrefix(part, "-")}
+		if !isSortField(field.Field) {
+			return nil, fmt.Errorf("%w: cannot sort by %q", ErrInvalidQuery, field.Field)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+func isSortField(field string) bool {
+	switch field {
+	case SortID, SortTitle, SortStatus, SortDueDate, SortPriority, SortCreatedAt, SortUpdatedAt, SortPosition:
+		return true
+	}
+	return false
+}
+
+// orderBy returns q.Sort with the ID tiebreaker appended, after validating it.
+func (q Query) orderBy() ([]SortField, error) {
+	order := make([]SortField, 0, len(q.Sort)+1)
+	for _, f := range q.Sort {
+		if !isSortField(f.Field) {
+			return nil, fmt.Errorf("%w: cannot sort by %q", ErrInvalidQuery, f.Field)
+		}
+		order = append(order, f)
+		if f.Field == SortID {
+			return order, nil
+		}
+	}
+	return append(order, SortField{Field: SortID}), nil
+}
+
+func sortSpec(order []SortField) string {
+	parts := make([]string, len(order))
+	for i, f := range order {
+		parts[i] = f.Field
+		if f.Desc {
+			parts[i] = "-" + parts[i]
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// sortValue is a todo field as it is compared: a string for text fields,
+// Unix nanoseconds (0 for unset) for times and the rank for priorities, which
+// matches how SQLite stores and orders them.
+type sortValue struct {
+	str  string
+	num  int64
+	text bool
+}
+
+func fieldValue(todo *models.Todo, field string) sortValue {
+	switch field {
+	case SortID:
+		return sortValue{str: todo.ID, text: true}
+	case SortTitle:
+		return sortValue{str: todo.Title, text: true}
+	case SortStatus:
+		return sortValue{str: string(todo.Status), text: true}
+	case SortDueDate:
+		return sortValue{num: toUnixNano(todo.DueDate)}
+	case SortPriority:
+		return sortValue{num: int64(todo.Priority)}
+	case SortCreatedAt:
+		return sortValue{num: toUnixNano(todo.CreatedAt)}
+	case SortUpdatedAt:
+		return sortValue{num: toUnixNano(todo.UpdatedAt)}
+	case SortPosition:
+		return sortValue{num: todo.Position}
+	}
+	return sortValue{}
+}
+
+func (v sortValue) compare(o sortValue) int {
+	if v.text {
+		return strings.Compare(v.str, o.str)
+	}
+	switch {
+	case v.num < o.num:
+		return -1
+	case v.num > o.num:
+		return 1
+	}
+	return 0
+}
+
+func (v sortValue) String() string {
+	if v.text {
+		return v.str
+	}
+	return strconv.FormatInt(v.num, 10)
+}
+
+// compareKeys orders two sort keys under order.
+func compareKeys(a, b []sortValue, order []SortField) int {
+	for i, f := range order {
+		c := a[i].compare(b[i])
+		if f.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func keyOf(todo *models.Todo, order []SortField) []sortValue {
+	key := make([]sortValue, len(order))
+	for i, f := range order {
+		key[i] = fieldValue(todo, f.Field)
+	}
+	return key
+}
+
+// cursor is the decoded form of Query.Cursor: the sort key of the last todo on
+// the previous page, so the next page starts strictly after it regardless of
+// inserts and deletes in between.
+type cursor struct {
+	Sort   string   `json:"s"`
+	Values []string `json:"v"`
+}
+
+func encodeCursor(order []SortField, key []sortValue) string {
+	c := cursor{Sort: sortSpec(order), Values: make([]string, len(key))}
+	for i, v := range key {
+		c.Values[i] = v.String()
+	}
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string, order []SortField) ([]sortValue, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil || len(c.Values) != len(order) {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	if c.Sort != sortSpec(order) {
+		return nil, fmt.Errorf("%w: cursor was issued for sort %q", ErrInvalidQuery, c.Sort)
+	}
+
+	key := make([]sortValue, len(order))
+	for i, f := range order {
+		if fieldValue(&models.Todo{}, f.Field).text {
+			key[i] = sortValue{str: c.Values[i], text: true}
+			continue
+		}
+		n, err := strconv.ParseInt(c.Values[i], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+		}
+		key[i] = sortValue{num: n}
+	}
+	return key, nil
+}
+
+// queryTodos evaluates q over an in-memory set of todos. The todos must
+// already be copies the caller may hand out.
+func queryTodos(todos []*models.Todo, q Query) (*Page, error) {
+	order, err := q.orderBy()
+	if err != nil {
+		return nil, err
+	}
+
+	matched := todos[:0]
+	for _, todo := range todos {
+		if filter.Match(q.Filter, todo) {
+			matched = append(matched, todo)
+		}
+	}
+	todos = matched
+
+	keys := make(map[*models.Todo][]sortValue, len(todos))
+	for _, todo := range todos {
+		keys[todo] = keyOf(todo, order)
+	}
+	sort.Slice(todos, func(i, j int) bool {
+		return compareKeys(keys[todos[i]], keys[todos[j]], order) < 0
+	})
+
+	if q.Cursor != "" {
+		after, err := decodeCursor(q.Cursor, order)
+		if err != nil {
+			return nil, err
+		}
+		start := sort.Search(len(todos), func(i int) bool {
+			return compareKeys(keys[todos[i]], after, order) > 0
+		})
+		todos = todos[start:]
+	}
+
+	page := &Page{Todos: todos}
+	if q.Limit > 0 && len(todos) > q.Limit {
+		page.Todos = todos[:q.Limit]
+		page.NextCursor = encodeCursor(order, keys[todos[q.Limit-1]])
+	}
+	return page, nil
+}
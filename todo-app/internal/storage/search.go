@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"todo-app/internal/models"
+	"todo-app/internal/search"
+)
+
+// snippetWords bounds the length of a description excerpt in a SearchHit.
+const snippetWords = 20
+
+// SearchHit is one full-text search result.
+type SearchHit struct {
+	Todo  *models.Todo
+	Score float64
+	// Highlights maps "title" and "description" to an HTML excerpt of the
+	// field with the matched terms wrapped in <mark>. Fields without a match
+	// are absent.
+	Highlights map[string]string
+}
+
+func newSearchHit(todo *models.Todo, score float64, terms []string) *SearchHit {
+	hit := &SearchHit{Todo: todo, Score: score, Highlights: make(map[string]string)}
+	if title := search.Highlight(todo.Title, terms, 0); title != "" {
+		hit.Highlights["title"] = title
+	}
+	if description := search.Highlight(todo.Description, terms, snippetWords); description != "" {
+		hit.Highlights["description"] = description
+	}
+	return hit
+}
+
+// searchIndex runs query against index and returns up to limit hits (0 means
+// no limit) with copies of the matching todos. The caller must hold the lock
+// guarding index and todos.
+func searchIndex(index *search.Index, todos map[string]*models.Todo, query string, limit int) []*SearchHit {
+	found := index.Search(query)
+	if limit > 0 && len(found) > limit {
+		found = found[:limit]
+	}
+
+	terms := search.Terms(query)
+	hits := make([]*SearchHit, 0, len(found))
+	for _, f := range found {
+		hits = append(hits, newSearchHit(todos[f.ID].Clone(), f.Score, terms))
+	}
+	return hits
+}
@@ -0,0 +1,787 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"todo-app/internal/hlc"
+	"todo-app/internal/models"
+	"todo-app/internal/search"
+
+	_ "modernc.org/sqlite"
+)
+
+// migration is a single schema change. Migrations are applied in order and
+// recorded in schema_migrations, so each one runs exactly once per database.
+type migration struct {
+	version    int
+	name       string
+	statements []string
+}
+
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "create todos",
+		statements: []string{
+			`CREATE TABLE todos (
+				id          TEXT PRIMARY KEY,
+				title       TEXT NOT NULL,
+				description TEXT NOT NULL DEFAULT '',
+				status      TEXT NOT NULL,
+				due_date    INTEGER NOT NULL DEFAULT 0,
+				created_at  INTEGER NOT NULL,
+				updated_at  INTEGER NOT NULL
+			)`,
+			`CREATE INDEX idx_todos_status ON todos (status)`,
+			`CREATE INDEX idx_todos_due_date ON todos (due_date)`,
+		},
+	},
+	{
+		version: 2,
+		name:    "add todo version",
+		statements: []string{
+			`ALTER TABLE todos ADD COLUMN version INTEGER NOT NULL DEFAULT 1`,
+		},
+	},
+	{
+		version: 3,
+		name:    "add full-text index",
+		statements: []string{
+			// A standalone FTS table keyed by todo id: external content would
+			// tie it to todos' implicit rowids, which VACUUM may renumber.
+			`CREATE VIRTUAL TABLE todos_fts USING fts5(
+				id UNINDEXED,
+				title,
+				description,
+				tokenize = 'unicode61 remove_diacritics 0'
+			)`,
+			`INSERT INTO todos_fts (id, title, description) SELECT id, title, description FROM todos`,
+			`CREATE TRIGGER todos_fts_insert AFTER INSERT ON todos BEGIN
+				INSERT INTO todos_fts (id, title, description) VALUES (new.id, new.title, new.description);
+			END`,
+			`CREATE TRIGGER todos_fts_update AFTER UPDATE OF title, description ON todos BEGIN
+				DELETE FROM todos_fts WHERE id = old.id;
+				INSERT INTO todos_fts (id, title, description) VALUES (new.id, new.title, new.description);
+			END`,
+			`CREATE TRIGGER todos_fts_delete AFTER DELETE ON todos BEGIN
+				DELETE FROM todos_fts WHERE id = old.id;
+			END`,
+		},
+	},
+	{
+		version: 4,
+		name:    "add priority and tags",
+		statements: []string{
+			`ALTER TABLE todos ADD COLUMN priority INTEGER NOT NULL DEFAULT 0`,
+			`CREATE INDEX idx_todos_priority ON todos (priority)`,
+			`CREATE TABLE todo_tags (
+				todo_id TEXT NOT NULL REFERENCES todos (id) ON DELETE CASCADE,
+				tag     TEXT NOT NULL,
+				PRIMARY KEY (todo_id, tag)
+			)`,
+			`CREATE INDEX idx_todo_tags_tag ON todo_tags (tag, todo_id)`,
+		},
+	},
+	{
+		version: 5,
+		name:    "add subtasks",
+		statements: []string{
+			`ALTER TABLE todos ADD COLUMN parent_id TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE todos ADD COLUMN auto_complete INTEGER NOT NULL DEFAULT 0`,
+			`CREATE INDEX idx_todos_parent_id ON todos (parent_id)`,
+		},
+	},
+	{
+		version: 6,
+		name:    "add dependencies",
+		statements: []string{
+			// blocker_id has no foreign key: the service unlinks a deleted
+			// blocker from its dependents itself.
+			`CREATE TABLE todo_blockers (
+				todo_id    TEXT NOT NULL REFERENCES todos (id) ON DELETE CASCADE,
+				blocker_id TEXT NOT NULL,
+				PRIMARY KEY (todo_id, blocker_id)
+			)`,
+			`CREATE INDEX idx_todo_blockers_blocker_id ON todo_blockers (blocker_id, todo_id)`,
+		},
+	},
+	{
+		version: 7,
+		name:    "add recurrence",
+		statements: []string{
+			// An empty recurrence_rule means the todo does not repeat.
+			`ALTER TABLE todos ADD COLUMN recurrence_rule TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE todos ADD COLUMN recurrence_time_zone TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE todos ADD COLUMN recurrence_start INTEGER NOT NULL DEFAULT 0`,
+			`ALTER TABLE todos ADD COLUMN recurrence_next_id TEXT NOT NULL DEFAULT ''`,
+		},
+	},
+	{
+		version: 8,
+		name:    "add reminders",
+		statements: []string{
+			// before_due is how long before the due date, in nanoseconds.
+			`CREATE TABLE todo_reminders (
+				todo_id    TEXT NOT NULL REFERENCES todos (id) ON DELETE CASCADE,
+				before_due INTEGER NOT NULL,
+				PRIMARY KEY (todo_id, before_due)
+			)`,
+		},
+	},
+	{
+		version: 9,
+		name:    "add positions",
+		statements: []string{
+			`ALTER TABLE todos ADD COLUMN position INTEGER NOT NULL DEFAULT 0`,
+			// Existing todos keep the order they were created in.
+			`UPDATE todos SET position = (
+				SELECT n FROM (SELECT id, ROW_NUMBER() OVER (ORDER BY created_at, id) AS n FROM todos) AS ranked
+				WHERE ranked.id = todos.id
+			) * 1048576`,
+			`CREATE INDEX idx_todos_position ON todos (position)`,
+		},
+	},
+	{
+		version: 10,
+		name:    "add change tracking",
+		statements: []string{
+			// seq is the change sequence number of the todo's last save;
+			// existing todos share the first one. clocks holds the field
+			// clocks as JSON, or '' for none.
+			`ALTER TABLE todos ADD COLUMN seq INTEGER NOT NULL DEFAULT 0`,
+			`ALTER TABLE todos ADD COLUMN clocks TEXT NOT NULL DEFAULT ''`,
+			`UPDATE todos SET seq = 1`,
+			`CREATE INDEX idx_todos_seq ON todos (seq, id)`,
+			`CREATE TABLE tombstones (
+				id         TEXT PRIMARY KEY,
+				deleted_at INTEGER NOT NULL,
+				seq        INTEGER NOT NULL
+			)`,
+			`CREATE INDEX idx_tombstones_seq ON tombstones (seq, id)`,
+			// A single row holding the last sequence number given out.
+			`CREATE TABLE change_seq (seq INTEGER NOT NULL)`,
+			`INSERT INTO change_seq (seq) VALUES (1)`,
+		},
+	},
+}
+
+type SQLiteStorage struct {
+	db *sql.DB
+}
+
+func NewSQLiteStorage(path string) (*SQLiteStorage, error) {
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)", path)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows a single writer; one connection avoids SQLITE_BUSY
+	// between our own goroutines.
+	db.SetMaxOpenConns(1)
+
+	storage := &SQLiteStorage{db: db}
+	if err := storage.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return storage, nil
+}
+
+// migrate brings the schema up to the latest version.
+func (s *SQLiteStorage) migrate() error {
+	if _, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		name       TEXT NOT NULL,
+		applied_at INTEGER NOT NULL
+	)`); err != nil {
+		return err
+	}
+
+	var current int
+	if err := s.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if err := s.apply(m); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+		}
+	}
+	return nil
+}
+
+func (s *SQLiteStorage) apply(m migration) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range m.statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+		m.version, m.name, time.Now().UnixNano()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStorage) Close() error {
+	return s.db.Close()
+}
+
+// todoColumns are the columns of the todos table; selectColumns adds the
+// todo's tags, blockers and reminders, comma-separated, from todo_tags,
+// todo_blockers and todo_reminders.
+const (
+	todoColumns = `id, title, description, status, due_date, created_at, updated_at, version, priority, parent_id, auto_complete,
+		recurrence_rule, recurrence_time_zone, recurrence_start, recurrence_next_id, position, seq, clocks`
+	selectColumns = `todos.id, todos.title, todos.description, todos.status, todos.due_date, todos.created_at,
+		todos.updated_at, todos.version, todos.priority, todos.parent_id, todos.auto_complete,
+		todos.recurrence_rule, todos.recurrence_time_zone, todos.recurrence_start, todos.recurrence_next_id, todos.position,
+		todos.seq, todos.clocks,
+		(SELECT group_concat(tag, ',') FROM todo_tags WHERE todo_id = todos.id),
+		(SELECT group_concat(blocker_id, ',') FROM todo_blockers WHERE todo_id = todos.id),
+		(SELECT group_concat(before_due, ',') FROM todo_reminders WHERE todo_id = todos.id)`
+)
+
+func (s *SQLiteStorage) Create(ctx context.Context, todo *models.Todo) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	seq, err := nextSeq(ctx, tx)
+	if err != nil {
+		return err
+	}
+	clocks, err := encodeClocks(todo.Clocks)
+	if err != nil {
+		return err
+	}
+	rec := recurrenceColumns(todo.Recurrence)
+	if _, err := tx.ExecContext(ctx, `INSERT INTO todos (`+todoColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		todo.ID, todo.Title, todo.Description, string(todo.Status),
+		toUnixNano(todo.DueDate), toUnixNano(todo.CreatedAt), toUnixNano(todo.UpdatedAt), todo.Version, int(todo.Priority),
+		todo.ParentID, todo.AutoComplete, rec.Rule, rec.TimeZone, toUnixNano(rec.Start), rec.NextID, todo.Position, seq, clocks); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM tombstones WHERE id = ?`, todo.ID); err != nil {
+		return err
+	}
+	if err := insertTags(ctx, tx, todo.ID, todo.Tags); err != nil {
+		return err
+	}
+	if err := insertBlockers(ctx, tx, todo.ID, todo.BlockedBy); err != nil {
+		return err
+	}
+	if err := insertReminders(ctx, tx, todo.ID, todo.Reminders); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	todo.Seq = seq
+	return nil
+}
+
+// nextSeq gives out the next change sequence number. Writes are serialised,
+// so they commit in the order of their numbers.
+func nextSeq(ctx context.Context, tx *sql.Tx) (int64, error) {
+	var seq int64
+	err := tx.QueryRowContext(ctx, `UPDATE change_seq SET seq = seq + 1 RETURNING seq`).Scan(&seq)
+	return seq, err
+}
+
+func encodeClocks(clocks map[string]hlc.Timestamp) (string, error) {
+	if len(clocks) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(clocks)
+	return string(data), err
+}
+
+// recurrenceColumns returns the values of the recurrence_* columns, which
+// are all empty for a todo that does not repeat.
+func recurrenceColumns(r *models.Recurrence) models.Recurrence {
+	if r == nil {
+		return models.Recurrence{}
+	}
+	return *r
+}
+
+func insertTags(ctx context.Context, tx *sql.Tx, id string, tags []string) error {
+	for _, tag := range tags {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO todo_tags (todo_id, tag) VALUES (?, ?)`, id, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func insertBlockers(ctx context.Context, tx *sql.Tx, id string, blockers []string) error {
+	for _, blocker := range blockers {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO todo_blockers (todo_id, blocker_id) VALUES (?, ?)`, id, blocker); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func insertReminders(ctx context.Context, tx *sql.Tx, id string, reminders []models.Reminder) error {
+	for _, r := range reminders {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO todo_reminders (todo_id, before_due) VALUES (?, ?)`, id, int64(r)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLiteStorage) GetByID(ctx context.Context, id string) (*models.Todo, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+selectColumns+` FROM todos WHERE id = ?`, id)
+	todo, err := scanTodo(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return todo, err
+}
+
+func (s *SQLiteStorage) GetAll(ctx context.Context) ([]*models.Todo, error) {
+	return s.selectTodos(ctx, `SELECT `+selectColumns+` FROM todos`)
+}
+
+func (s *SQLiteStorage) Update(ctx context.Context, todo *models.Todo) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	seq, err := nextSeq(ctx, tx)
+	if err != nil {
+		return err
+	}
+	clocks, err := encodeClocks(todo.Clocks)
+	if err != nil {
+		return err
+	}
+	updatedAt := time.Now()
+	rec := recurrenceColumns(todo.Recurrence)
+	res, err := tx.ExecContext(ctx, `UPDATE todos SET title = ?, description = ?, status = ?, due_date = ?, priority = ?, parent_id = ?, auto_complete = ?,
+		recurrence_rule = ?, recurrence_time_zone = ?, recurrence_start = ?, recurrence_next_id = ?, position = ?, seq = ?, clocks = ?,
+		updated_at = ?, version = version + 1
+		WHERE id = ? AND version = ?`,
+		todo.Title, todo.Description, string(todo.Status),
+		toUnixNano(todo.DueDate), int(todo.Priority), todo.ParentID, todo.AutoComplete,
+		rec.Rule, rec.TimeZone, toUnixNano(rec.Start), rec.NextID, todo.Position, seq, clocks, toUnixNano(updatedAt), todo.ID, todo.Version)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		// Either the row is gone or its version moved on.
+		tx.Rollback()
+		if _, err := s.GetByID(ctx, todo.ID); err != nil {
+			return err
+		}
+		return ErrConflict
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM todo_tags WHERE todo_id = ?`, todo.ID); err != nil {
+		return err
+	}
+	if err := insertTags(ctx, tx, todo.ID, todo.Tags); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM todo_blockers WHERE todo_id = ?`, todo.ID); err != nil {
+		return err
+	}
+	if err := insertBlockers(ctx, tx, todo.ID, todo.BlockedBy); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM todo_reminders WHERE todo_id = ?`, todo.ID); err != nil {
+		return err
+	}
+	if err := insertReminders(ctx, tx, todo.ID, todo.Reminders); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	todo.Version++
+	todo.UpdatedAt = updatedAt
+	todo.Seq = seq
+	return nil
+}
+
+func (s *SQLiteStorage) Delete(ctx context.Context, id string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM todos WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if err := requireRow(res); err != nil {
+		return err
+	}
+	seq, err := nextSeq(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT OR REPLACE INTO tombstones (id, deleted_at, seq) VALUES (?, ?, ?)`,
+		id, toUnixNano(time.Now()), seq); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStorage) Changes(ctx context.Context, after ChangeKey, limit int) ([]*Change, error) {
+	// Read both tables in one transaction so that they agree.
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// LIMIT -1 means no limit.
+	rowLimit := limit
+	if rowLimit <= 0 {
+		rowLimit = -1
+	}
+	rows, err := tx.QueryContext(ctx, `SELECT `+selectColumns+` FROM todos
+		WHERE seq > ? OR (seq = ? AND id > ?) ORDER BY seq, id LIMIT ?`, after.Seq, after.Seq, after.ID, rowLimit)
+	if err != nil {
+		return nil, err
+	}
+	todos, err := scanTodos(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err = tx.QueryContext(ctx, `SELECT id, deleted_at, seq FROM tombstones
+		WHERE seq > ? OR (seq = ? AND id > ?) ORDER BY seq, id LIMIT ?`, after.Seq, after.Seq, after.ID, rowLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := make([]*Change, 0, len(todos))
+	for _, todo := range todos {
+		changes = append(changes, &Change{Todo: todo})
+	}
+	for rows.Next() {
+		var (
+			t         Tombstone
+			deletedAt int64
+		)
+		if err := rows.Scan(&t.ID, &deletedAt, &t.Seq); err != nil {
+			return nil, err
+		}
+		t.DeletedAt = fromUnixNano(deletedAt)
+		changes = append(changes, &Change{Tombstone: &t})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return sortChanges(changes, limit), nil
+}
+
+func (s *SQLiteStorage) Tombstone(ctx context.Context, id string) (*Tombstone, error) {
+	var (
+		t         Tombstone
+		deletedAt int64
+	)
+	err := s.db.QueryRowContext(ctx, `SELECT id, deleted_at, seq FROM tombstones WHERE id = ?`, id).Scan(&t.ID, &deletedAt, &t.Seq)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	t.DeletedAt = fromUnixNano(deletedAt)
+	return &t, nil
+}
+
+func (s *SQLiteStorage) Query(ctx context.Context, q Query) (*Page, error) {
+	order, err := q.orderBy()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		where []string
+		args  []interface{}
+	)
+	if q.Filter != nil {
+		clause, clauseArgs, err := filterSQL(q.Filter)
+		if err != nil {
+			return nil, err
+		}
+		where = append(where, clause)
+		args = append(args, clauseArgs...)
+	}
+	if q.Cursor != "" {
+		after, err := decodeCursor(q.Cursor, order)
+		if err != nil {
+			return nil, err
+		}
+		clause, clauseArgs := keysetClause(order, after)
+		where = append(where, clause)
+		args = append(args, clauseArgs...)
+	}
+
+	query := `SELECT ` + selectColumns + ` FROM todos`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, ` AND `)
+	}
+
+	terms := make([]string, len(order))
+	for i, f := range order {
+		terms[i] = f.Field
+		if f.Desc {
+			terms[i] += ` DESC`
+		}
+	}
+	query += ` ORDER BY ` + strings.Join(terms, ", ")
+	if q.Limit > 0 {
+		// One extra row tells us whether there is a next page.
+		query += ` LIMIT ?`
+		args = append(args, q.Limit+1)
+	}
+
+	todos, err := s.selectTodos(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	page := &Page{Todos: todos}
+	if q.Limit > 0 && len(todos) > q.Limit {
+		page.Todos = todos[:q.Limit]
+		page.NextCursor = encodeCursor(order, keyOf(todos[q.Limit-1], order))
+	}
+	return page, nil
+}
+
+func (s *SQLiteStorage) Tags(ctx context.Context) ([]TagCount, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT tag, COUNT(*) FROM todo_tags GROUP BY tag ORDER BY tag`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []TagCount
+	for rows.Next() {
+		var c TagCount
+		if err := rows.Scan(&c.Tag, &c.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+// Search ranks with FTS5's bm25(), using the same field weights as the
+// in-memory index; highlighting is done in Go so that all backends escape
+// and excerpt text the same way.
+func (s *SQLiteStorage) Search(ctx context.Context, query string, limit int) ([]*SearchHit, error) {
+	terms := search.Terms(query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	// Quote every term so FTS5 treats it as a plain string, not syntax.
+	phrases := make([]string, len(terms))
+	for i, t := range terms {
+		phrases[i] = `"` + strings.ReplaceAll(t, `"`, `""`) + `"`
+	}
+	stmt := fmt.Sprintf(`SELECT -bm25(todos_fts, 0, %g, %g) AS score, %s FROM todos_fts JOIN todos USING (id)
+		WHERE todos_fts MATCH ? ORDER BY score DESC, id`,
+		search.TitleWeight, search.DescriptionWeight, selectColumns)
+	args := []interface{}{strings.Join(phrases, " AND ")}
+	if limit > 0 {
+		stmt += ` LIMIT ?`
+		args = append(args, limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hits []*SearchHit
+	for rows.Next() {
+		var score float64
+		todo, err := scanTodo(scoredRow{rows, &score})
+		if err != nil {
+			return nil, err
+		}
+		hits = append(hits, newSearchHit(todo, score, terms))
+	}
+	return hits, rows.Err()
+}
+
+// scoredRow scans a leading score column ahead of the todo columns.
+type scoredRow struct {
+	rows  *sql.Rows
+	score *float64
+}
+
+func (r scoredRow) Scan(dest ...interface{}) error {
+	return r.rows.Scan(append([]interface{}{r.score}, dest...)...)
+}
+
+// keysetClause matches rows that sort strictly after key, e.g. for
+// (a, b DESC): a > ? OR (a = ? AND b < ?). Field names were validated by
+// Query.orderBy and are the column names.
+func keysetClause(order []SortField, key []sortValue) (string, []interface{}) {
+	var (
+		alternatives []string
+		args         []interface{}
+	)
+	for i, f := range order {
+		var terms []string
+		for j := 0; j < i; j++ {
+			terms = append(terms, order[j].Field+` = ?`)
+			args = append(args, key[j].arg())
+		}
+		op := ` > ?`
+		if f.Desc {
+			op = ` < ?`
+		}
+		terms = append(terms, f.Field+op)
+		args = append(args, key[i].arg())
+		alternatives = append(alternatives, `(`+strings.Join(terms, ` AND `)+`)`)
+	}
+	return `(` + strings.Join(alternatives, ` OR `) + `)`, args
+}
+
+func (v sortValue) arg() interface{} {
+	if v.text {
+		return v.str
+	}
+	return v.num
+}
+
+func (s *SQLiteStorage) selectTodos(ctx context.Context, query string, args ...interface{}) ([]*models.Todo, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanTodos(rows)
+}
+
+// scanTodos reads and closes rows of selectColumns.
+func scanTodos(rows *sql.Rows) ([]*models.Todo, error) {
+	defer rows.Close()
+
+	var todos []*models.Todo
+	for rows.Next() {
+		todo, err := scanTodo(rows)
+		if err != nil {
+			return nil, err
+		}
+		todos = append(todos, todo)
+	}
+	return todos, rows.Err()
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanTodo(row rowScanner) (*models.Todo, error) {
+	var (
+		todo                          models.Todo
+		status                        string
+		dueDate, createdAt, updatedAt int64
+		priority                      int
+		rec                           models.Recurrence
+		recStart                      int64
+		tags, blockedBy, reminders    sql.NullString
+		clocks                        string
+	)
+	if err := row.Scan(&todo.ID, &todo.Title, &todo.Description, &status, &dueDate, &createdAt, &updatedAt, &todo.Version, &priority, &todo.ParentID, &todo.AutoComplete,
+		&rec.Rule, &rec.TimeZone, &recStart, &rec.NextID, &todo.Position, &todo.Seq, &clocks, &tags, &blockedBy, &reminders); err != nil {
+		return nil, err
+	}
+	if clocks != "" {
+		if err := json.Unmarshal([]byte(clocks), &todo.Clocks); err != nil {
+			return nil, fmt.Errorf("todo %s: bad clocks: %w", todo.ID, err)
+		}
+	}
+	if rec.Rule != "" {
+		rec.Start = fromUnixNano(recStart)
+		todo.Recurrence = &rec
+	}
+	todo.Status = models.Status(status)
+	todo.Priority = models.Priority(priority)
+	if tags.Valid {
+		todo.Tags = models.NormalizeTags(strings.Split(tags.String, ","))
+	}
+	if blockedBy.Valid {
+		todo.BlockedBy = models.NormalizeIDs(strings.Split(blockedBy.String, ","))
+	}
+	if reminders.Valid {
+		for _, r := range strings.Split(reminders.String, ",") {
+			n, err := strconv.ParseInt(r, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("todo %s: bad reminder %q", todo.ID, r)
+			}
+			todo.Reminders = append(todo.Reminders, models.Reminder(n))
+		}
+		todo.Reminders = models.NormalizeReminders(todo.Reminders)
+	}
+	todo.DueDate = fromUnixNano(dueDate)
+	todo.CreatedAt = fromUnixNano(createdAt)
+	todo.UpdatedAt = fromUnixNano(updatedAt)
+	return &todo, nil
+}
+
+func requireRow(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Times are stored as Unix nanoseconds, with 0 standing in for the zero
+// time (e.g. a todo without a due date).
+func toUnixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func fromUnixNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"todo-app/internal/filter"
+
+	"modernc.org/sqlite"
+)
+
+// SQLite's lower() only folds ASCII, so text containment is left to the same
+// Go function filter.Match uses.
+func init() {
+	sqlite.MustRegisterFunction("contains_fold", &sqlite.FunctionImpl{
+		NArgs:         2,
+		Deterministic: true,
+		Scalar: func(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+			have, _ := args[0].(string)
+			want, _ := args[1].(string)
+			return filter.ContainsFold(have, want), nil
+		},
+	})
+}
+
+// filterSQL translates a filter expression into a WHERE clause with the same
+// semantics as filter.Match.
+func filterSQL(e filter.Expr) (string, []interface{}, error) {
+	switch e := e.(type) {
+	case filter.And:
+		return joinSQL(e.Left, e.Right, "AND")
+	case filter.Or:
+		return joinSQL(e.Left, e.Right, "OR")
+	case filter.Not:
+		clause, args, err := filterSQL(e.Expr)
+		if err != nil {
+			return "", nil, err
+		}
+		return `NOT ` + clause, args, nil
+	case filter.Compare:
+		return compareSQL(e)
+	}
+	return "", nil, fmt.Errorf("%w: unsupported filter %T", ErrInvalidQuery, e)
+}
+
+func joinSQL(left, right filter.Expr, op string) (string, []interface{}, error) {
+	l, largs, err := filterSQL(left)
+	if err != nil {
+		return "", nil, err
+	}
+	r, rargs, err := filterSQL(right)
+	if err != nil {
+		return "", nil, err
+	}
+	return `(` + l + ` ` + op + ` ` + r + `)`, append(largs, rargs...), nil
+}
+
+var filterColumns = map[filter.Field]string{
+	filter.FieldStatus:      "status",
+	filter.FieldTitle:       "title",
+	filter.FieldDescription: "description",
+	filter.FieldDue:         "due_date",
+	filter.FieldCreated:     "created_at",
+	filter.FieldUpdated:     "updated_at",
+	filter.FieldParent:      "parent_id",
+}
+
+func compareSQL(c filter.Compare) (string, []interface{}, error) {
+	if c.Field == filter.FieldText {
+		title, targs, err := compareSQL(filter.Compare{Field: filter.FieldTitle, Op: c.Op, Value: c.Value})
+		if err != nil {
+			return "", nil, err
+		}
+		desc, dargs, _ := compareSQL(filter.Compare{Field: filter.FieldDescription, Op: c.Op, Value: c.Value})
+		join := ` OR `
+		if c.Op == filter.OpNe {
+			join = ` AND `
+		}
+		return `(` + title + join + desc + `)`, append(targs, dargs...), nil
+	}
+
+	switch c.Field {
+	case filter.FieldTag:
+		exists := `(EXISTS (SELECT 1 FROM todo_tags WHERE todo_tags.todo_id = todos.id AND todo_tags.tag = ?))`
+		switch c.Op {
+		case filter.OpEq:
+			return exists, []interface{}{c.Value}, nil
+		case filter.OpNe:
+			return `NOT ` + exists, []interface{}{c.Value}, nil
+		}
+		return "", nil, fmt.Errorf("%w: operator %q cannot be used with %s", ErrInvalidQuery, c.Op, c.Field)
+	case filter.FieldBlockedBy:
+		exists := `(EXISTS (SELECT 1 FROM todo_blockers WHERE todo_blockers.todo_id = todos.id AND todo_blockers.blocker_id = ?))`
+		switch c.Op {
+		case filter.OpEq:
+			return exists, []interface{}{c.Value}, nil
+		case filter.OpNe:
+			return `NOT ` + exists, []interface{}{c.Value}, nil
+		}
+		return "", nil, fmt.Errorf("%w: operator %q cannot be used with %s", ErrInvalidQuery, c.Op, c.Field)
+	case filter.FieldPriority:
+		switch c.Op {
+		case filter.OpEq, filter.OpLt, filter.OpLe, filter.OpGt, filter.OpGe:
+			return `(todos.priority ` + string(c.Op) + ` ?)`, []interface{}{int(c.Priority)}, nil
+		case filter.OpNe:
+			return `(todos.priority <> ?)`, []interface{}{int(c.Priority)}, nil
+		}
+		return "", nil, fmt.Errorf("%w: operator %q cannot be used with %s", ErrInvalidQuery, c.Op, c.Field)
+	}
+
+	column, ok := filterColumns[c.Field]
+	if !ok {
+		return "", nil, fmt.Errorf("%w: unknown field %q", ErrInvalidQuery, c.Field)
+	}
+
+	if c.Field.IsTime() {
+		// Unset times are stored as 0 and never satisfy an ordering.
+		at := toUnixNano(c.Time)
+		switch c.Op {
+		case filter.OpEq:
+			return `(` + column + ` = ?)`, []interface{}{at}, nil
+		case filter.OpNe:
+			return `(` + column + ` <> ?)`, []interface{}{at}, nil
+		case filter.OpLt, filter.OpLe, filter.OpGt, filter.OpGe:
+			return `(` + column + ` <> 0 AND ` + column + ` ` + string(c.Op) + ` ?)`, []interface{}{at}, nil
+		}
+	} else {
+		switch c.Op {
+		case filter.OpContains:
+			return `contains_fold(` + column + `, ?)`, []interface{}{c.Value}, nil
+		case filter.OpEq:
+			return `(` + column + ` = ?)`, []interface{}{c.Value}, nil
+		case filter.OpNe:
+			return `(` + column + ` <> ?)`, []interface{}{c.Value}, nil
+		}
+	}
+	return "", nil, fmt.Errorf("%w: operator %q cannot be used with %s", ErrInvalidQuery, c.Op, c.Field)
+}
@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"todo-app/internal/filter"
+	"todo-app/internal/models"
+)
+
+// TestContainsFoldsUnicodeInEveryBackend checks that the ":" operator ignores
+// case beyond ASCII, and so matches the same todos, whichever backend
+// evaluates it: in memory through filter.Match, or in SQLite.
+func TestContainsFoldsUnicodeInEveryBackend(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	sqliteStore, err := NewSQLiteStorage(filepath.Join(dir, "todos.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqliteStore.Close() })
+	backends := map[string]TodoStorage{
+		"memory": NewMemoryStorage(),
+		"json":   openJSON(t, filepath.Join(dir, "todos.json")),
+		"sqlite": sqliteStore,
+	}
+
+	todos := []*models.Todo{
+		{ID: "ecole", Title: "ÉCOLE: inscrire les enfants", Status: models.StatusPending},
+		{ID: "uber", Title: "Plan trip", Description: "ÜBERNACHTUNG buchen", Status: models.StatusPending},
+		{ID: "ascii", Title: "Call the SCHOOL", Status: models.StatusPending},
+	}
+	queries := map[string][]string{
+		"title:école":        {"ecole"},
+		"title:École":        {"ecole"},
+		"text:übernachtung":  {"uber"},
+		"title:school":       {"ascii"},
+		"NOT title:école":    {"ascii", "uber"},
+		"description:ünicod": nil,
+	}
+
+	for name, store := range backends {
+		for _, todo := range todos {
+			todo := todo.Clone()
+			todo.Version = 1
+			if err := store.Create(ctx, todo); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+		}
+		for query, want := range queries {
+			expr, err := filter.Parse(query)
+			if err != nil {
+				t.Fatalf("%s: %v", query, err)
+			}
+			page, err := store.Query(ctx, Query{Filter: expr})
+			if err != nil {
+				t.Fatalf("%s: %s: %v", name, query, err)
+			}
+			var got []string
+			for _, todo := range page.Todos {
+				got = append(got, todo.ID)
+			}
+			sort.Strings(got)
+			if strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Errorf("%s: %s matched %v, want %v", name, query, got, want)
+			}
+		}
+	}
+}
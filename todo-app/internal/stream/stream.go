@@ -0,0 +1,207 @@
+// Package stream keeps a bounded history of todo changes, taken from the
+// service's event bus, and fans them out to watchers such as the
+// Server-Sent Events endpoint. Every change has an ID, so a watcher that
+// reconnects can name the last change it saw and be sent the ones it missed,
+// as long as the history still reaches back that far.
+package stream
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"todo-app/internal/events"
+	"todo-app/internal/filter"
+	"todo-app/internal/models"
+)
+
+// Change types.
+const (
+	Created = "todo.created"
+	Updated = "todo.updated"
+	Deleted = "todo.deleted"
+)
+
+// Change is a todo that was created, updated or deleted.
+type Change struct {
+	// ID orders the changes of one server run: "<run>-<sequence number>".
+	ID         string       `json:"id"`
+	Type       string       `json:"type"`
+	OccurredAt time.Time    `json:"occurred_at"`
+	Todo       *models.Todo `json:"todo"`
+	// Previous is the todo before an update.
+	Previous *models.Todo `json:"previous,omitempty"`
+	// Origin is who made the change, if known (see events.WithOrigin).
+	Origin string `json:"origin,omitempty"`
+
+	seq uint64
+}
+
+// Matches reports whether the change concerns a todo matching e: an update
+// matches if the todo matched before or after it, so that watchers also see
+// todos leave their filter.
+func (c *Change) Matches(e filter.Expr) bool {
+	return filter.Match(e, c.Todo) || (c.Previous != nil && filter.Match(e, c.Previous))
+}
+
+// watcherBuffer is how many changes a watcher may fall behind by before it
+// is dropped. A dropped watcher reconnects and catches up from the history.
+const watcherBuffer = 256
+
+// Stream records changes and hands them to watchers.
+type Stream struct {
+	// run tells IDs of this server run from those of earlier ones, whose
+	// changes are not in the history.
+	run  string
+	size int
+
+	mu       sync.Mutex
+	seq      uint64
+	history  []*Change // oldest first, at most size
+	watchers map[*Watcher]bool
+	closed   bool
+}
+
+// New creates a stream remembering the last size changes.
+func New(size int) *Stream {
+	if size < 1 {
+		size = 1
+	}
+	return &Stream{
+		run:      strconv.FormatInt(time.Now().UnixNano(), 36),
+		size:     size,
+		watchers: map[*Watcher]bool{},
+	}
+}
+
+// Subscribe records the changes published on bus. It subscribes
+// synchronously, so that changes get their IDs in the order they were
+// saved; handing them on never blocks.
+func (s *Stream) Subscribe(bus *events.Bus) *events.Subscription {
+	return bus.Subscribe("stream", func(ctx context.Context, e events.Event) {
+		origin := events.Origin(ctx)
+		switch e := e.(type) {
+		case events.TodoCreated:
+			s.add(&Change{Type: Created, Todo: e.Todo, Origin: origin})
+		case events.TodoUpdated:
+			s.add(&Change{Type: Updated, Todo: e.After, Previous: e.Before, Origin: origin})
+		case events.TodoDeleted:
+			s.add(&Change{Type: Deleted, Todo: e.Todo, Origin: origin})
+		}
+	})
+}
+
+func (s *Stream) add(c *Change) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	c.seq = s.seq
+	c.ID = s.run + "-" + strconv.FormatUint(c.seq, 10)
+	c.OccurredAt = time.Now()
+
+	if len(s.history) == s.size {
+		s.history[0] = nil
+		s.history = s.history[1:]
+	}
+	s.history = append(s.history, c)
+
+	for w := range s.watchers {
+		if !w.match(c) {
+			continue
+		}
+		select {
+		case w.c <- c:
+		default:
+			// Too far behind; it catches up from the history when it
+			// reconnects.
+			s.drop(w)
+		}
+	}
+}
+
+// Watcher receives the changes matching its filter.
+type Watcher struct {
+	c     chan *Change
+	match func(*Change) bool
+}
+
+// C delivers the changes. It is closed when the watcher falls too far behind
+// or the stream is closed.
+func (w *Watcher) C() <-chan *Change {
+	return w.c
+}
+
+// Watch starts watching the changes that match. If lastID names a change,
+// the matching changes after it are returned as missed; complete is false if
+// they are not all in the history any more (or lastID is from an earlier
+// server run), in which case the watcher should reload what it shows.
+func (s *Stream) Watch(lastID string, match func(*Change) bool) (w *Watcher, missed []*Change, complete bool) {
+	w = &Watcher{c: make(chan *Change, watcherBuffer), match: match}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		close(w.c)
+		return w, nil, true
+	}
+	s.watchers[w] = true
+
+	if lastID == "" {
+		return w, nil, true
+	}
+	after, ok := s.parseID(lastID)
+	if !ok {
+		return w, nil, false
+	}
+	oldest := s.seq + 1
+	if len(s.history) > 0 {
+		oldest = s.history[0].seq
+	}
+	complete = after+1 >= oldest
+	for _, c := range s.history {
+		if c.seq > after && match(c) {
+			missed = append(missed, c)
+		}
+	}
+	return w, missed, complete
+}
+
+// parseID returns the sequence number of an ID from this run.
+func (s *Stream) parseID(id string) (uint64, bool) {
+	run, seq, ok := strings.Cut(id, "-")
+	if !ok || run != s.run {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(seq, 10, 64)
+	if err != nil || n > s.seq {
+		return 0, false
+	}
+	return n, true
+}
+
+// Stop stops a watcher.
+func (s *Stream) Stop(w *Watcher) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.drop(w)
+}
+
+func (s *Stream) drop(w *Watcher) {
+	if s.watchers[w] {
+		delete(s.watchers, w)
+		close(w.c)
+	}
+}
+
+// Close stops every watcher, e.g. so that open event streams end when the
+// server shuts down.
+func (s *Stream) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for w := range s.watchers {
+		s.drop(w)
+	}
+}
@@ -0,0 +1,173 @@
+// Package validation checks structs against the rules in their `validate`
+// tags, e.g.
+//
+//	Title string `json:"title" validate:"required,min=1,max=255"`
+//
+// Rules are comma-separated; parameters follow "=". Every violation is
+// reported, not just the first, and fields are named by their JSON names so
+// the errors can be shown to API clients as they are.
+package validation
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"todo-app/internal/apperr"
+	"unicode/utf8"
+)
+
+// FieldError is one violated rule.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	return e.Field + " " + e.Message
+}
+
+// Errors collects every FieldError found while validating a value. A nil
+// Errors means the value is valid.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Error()
+	}
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+func (e Errors) ErrorKind() apperr.Kind { return apperr.Validation }
+func (e Errors) ErrorCode() string      { return "validation_failed" }
+
+// Add records a violation of rule on field.
+func (e *Errors) Add(field, rule, format string, args ...interface{}) {
+	*e = append(*e, FieldError{Field: field, Rule: rule, Message: fmt.Sprintf(format, args...)})
+}
+
+// Has reports whether field already has an error, so domain rules can skip
+// fields whose tags already failed.
+func (e Errors) Has(field string) bool {
+	for _, fe := range e {
+		if fe.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Err returns e as an error, or nil if it is empty.
+func (e Errors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// rule checks a field value against a parameter and returns a message
+// describing the violation, or "" if the value passes.
+type rule func(v reflect.Value, param string) string
+
+var rules = map[string]rule{
+	"required": required,
+	"min":      minimum,
+	"max":      maximum,
+}
+
+// Struct validates the exported fields of the struct v (or *struct) points
+// to. It panics on an unknown rule or a malformed parameter, which are
+// programming errors in the tag.
+func Struct(v interface{}) Errors {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	rt := rv.Type()
+
+	var errs Errors
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		tag := sf.Tag.Get("validate")
+		if tag == "" || !sf.IsExported() {
+			continue
+		}
+
+		name := jsonName(sf)
+		value := rv.Field(i)
+		for _, spec := range strings.Split(tag, ",") {
+			ruleName, param, _ := strings.Cut(spec, "=")
+			check, ok := rules[ruleName]
+			if !ok {
+				panic(fmt.Sprintf("validation: unknown rule %q on %s.%s", ruleName, rt.Name(), sf.Name))
+			}
+			if msg := check(value, param); msg != "" {
+				errs.Add(name, ruleName, "%s", msg)
+				// Later rules would only restate the failure, e.g. min after
+				// required on an empty string.
+				break
+			}
+		}
+	}
+	return errs
+}
+
+func jsonName(sf reflect.StructField) string {
+	name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return sf.Name
+	}
+	return name
+}
+
+func required(v reflect.Value, _ string) string {
+	if v.IsZero() {
+		return "is required"
+	}
+	return ""
+}
+
+// size is the length of strings (in characters), slices and maps, and the
+// value of numbers.
+func size(v reflect.Value) float64 {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String()))
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return float64(v.Len())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	}
+	panic(fmt.Sprintf("validation: cannot measure a %s", v.Kind()))
+}
+
+func number(param string) float64 {
+	n, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		panic(fmt.Sprintf("validation: bad rule parameter %q", param))
+	}
+	return n
+}
+
+func minimum(v reflect.Value, param string) string {
+	if size(v) >= number(param) {
+		return ""
+	}
+	if v.Kind() == reflect.String {
+		return fmt.Sprintf("must be at least %s characters", param)
+	}
+	return fmt.Sprintf("must be at least %s", param)
+}
+
+func maximum(v reflect.Value, param string) string {
+	if size(v) <= number(param) {
+		return ""
+	}
+	if v.Kind() == reflect.String {
+		return fmt.Sprintf("must be at most %s characters", param)
+	}
+	return fmt.Sprintf("must be at most %s", param)
+}
@@ -0,0 +1,414 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Status is where a delivery stands.
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusDelivered Status = "delivered"
+	// StatusDead marks a delivery in the dead-letter queue: it failed every
+	// attempt and is only tried again when retried by hand.
+	StatusDead Status = "dead"
+)
+
+// Limits on what the delivery log keeps.
+const (
+	// logSize is how many delivered deliveries are kept per webhook.
+	logSize = 100
+	// maxDeadLetters is how many dead deliveries are kept in all; the
+	// oldest go first.
+	maxDeadLetters = 1000
+	// maxAttemptLog is how many attempts are kept per delivery.
+	maxAttemptLog = 10
+)
+
+// deliveryTimeout bounds a single attempt, so that a hanging receiver does
+// not hold up the others.
+const deliveryTimeout = 10 * time.Second
+
+// maxBackoff caps the wait between two attempts.
+const maxBackoff = time.Hour
+
+// saveDelay is how long the changes of queued events and of attempts are
+// collected before they are saved together.
+const saveDelay = 100 * time.Millisecond
+
+// Delivery is one event sent to one webhook.
+type Delivery struct {
+	ID        string `json:"id"`
+	WebhookID string `json:"webhook_id"`
+	Event     Event  `json:"event"`
+	Status    Status `json:"status"`
+	// Failures counts the failed attempts since the delivery was queued or
+	// last retried from the dead-letter queue.
+	Failures int `json:"failures"`
+	// Attempts are the most recent attempts, oldest first.
+	Attempts []Attempt `json:"attempts"`
+	// NextAttempt is when a pending delivery is tried next.
+	NextAttempt *time.Time `json:"next_attempt,omitempty"`
+}
+
+func (del *Delivery) copy() Delivery {
+	c := *del
+	c.Attempts = append([]Attempt(nil), del.Attempts...)
+	if del.NextAttempt != nil {
+		next := *del.NextAttempt
+		c.NextAttempt = &next
+	}
+	return c
+}
+
+// Attempt is one try at sending a delivery.
+type Attempt struct {
+	At time.Time `json:"at"`
+	// StatusCode is the receiver's response status, 0 if there was none.
+	StatusCode int `json:"status_code,omitempty"`
+	// Error says why the attempt failed; it is empty for a success.
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// Run delivers queued events until ctx is cancelled. Each webhook's due
+// deliveries are sent by a goroutine of their own, so a slow or hanging
+// receiver holds up only its own deliveries. An attempt cut short by the
+// cancellation is not counted and is made again after a restart. Run also
+// saves the changes deliveries make, and saves the last of them before it
+// returns.
+func (d *Dispatcher) Run(ctx context.Context) {
+	var workers sync.WaitGroup
+	saver := make(chan struct{})
+	go func() {
+		defer close(saver)
+		d.saveChanges(ctx)
+	}()
+	defer func() {
+		workers.Wait()
+		<-saver
+		if err := d.Flush(); err != nil {
+			log.Printf("Webhooks: %v", err)
+		}
+	}()
+
+	for {
+		next := d.deliverDue(ctx, &workers)
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if !next.IsZero() {
+			timer = time.NewTimer(time.Until(next))
+			timeout = timer.C
+		}
+		select {
+		case <-ctx.Done():
+		case <-d.wake:
+		case <-timeout:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// saveChanges saves the changes to the state in batches until ctx is
+// cancelled. A failed save is tried again with the next change.
+func (d *Dispatcher) saveChanges(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.dirty:
+		}
+		timer := time.NewTimer(saveDelay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if err := d.Flush(); err != nil {
+			log.Printf("Webhooks: %v", err)
+		}
+	}
+}
+
+// deliverDue starts sending the due deliveries of every webhook that is not
+// busy already, tracking the goroutines in workers. It returns when the next
+// attempt is due, zero if none is; a webhook that is busy wakes Run once it
+// is done instead.
+func (d *Dispatcher) deliverDue(ctx context.Context, workers *sync.WaitGroup) time.Time {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	var next time.Time
+	due := map[string][]*Delivery{}
+	webhooks := map[string]Webhook{}
+	for _, del := range d.state.Deliveries {
+		if del.Status != StatusPending || del.NextAttempt == nil || d.busy[del.WebhookID] {
+			continue
+		}
+		w := d.find(del.WebhookID)
+		if w == nil || !w.Active {
+			// Deliveries of a paused webhook wait for it to be resumed.
+			continue
+		}
+		if del.NextAttempt.After(now) {
+			if next.IsZero() || del.NextAttempt.Before(next) {
+				next = *del.NextAttempt
+			}
+			continue
+		}
+		due[w.ID] = append(due[w.ID], del)
+		webhooks[w.ID] = *w
+	}
+
+	for id, deliveries := range due {
+		d.busy[id] = true
+		workers.Add(1)
+		go func(w Webhook, deliveries []*Delivery) {
+			defer workers.Done()
+			d.deliver(ctx, w, deliveries)
+		}(webhooks[id], deliveries)
+	}
+	return next
+}
+
+// deliver makes an attempt at each of a webhook's due deliveries, one after
+// another in the order they were queued, then marks the webhook no longer
+// busy and wakes Run, for more of its deliveries may be due by then.
+func (d *Dispatcher) deliver(ctx context.Context, w Webhook, deliveries []*Delivery) {
+	defer func() {
+		d.mu.Lock()
+		delete(d.busy, w.ID)
+		d.mu.Unlock()
+		d.wakeUp()
+	}()
+	for _, del := range deliveries {
+		a := d.attempt(ctx, w, del)
+		if ctx.Err() != nil {
+			return
+		}
+		d.record(del, a)
+	}
+}
+
+// attempt sends a delivery once.
+func (d *Dispatcher) attempt(ctx context.Context, w Webhook, del *Delivery) Attempt {
+	start := time.Now()
+	a := Attempt{At: start}
+	body, err := json.Marshal(del.Event)
+	if err != nil {
+		a.Error = err.Error()
+		return a
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		a.Error = err.Error()
+		return a
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "todo-app-webhooks")
+	req.Header.Set(HeaderEvent, string(del.Event.Type))
+	req.Header.Set(HeaderDelivery, del.ID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(start.Unix(), 10))
+	req.Header.Set(HeaderSignature, Sign(w.Secret, start.Unix(), body))
+
+	resp, err := d.client.Do(req)
+	a.DurationMS = time.Since(start).Milliseconds()
+	if err != nil {
+		a.Error = err.Error()
+		return a
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	a.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		a.Error = "receiver answered " + resp.Status
+	}
+	return a
+}
+
+// record notes the outcome of an attempt: the delivery is done, scheduled
+// for another attempt, or, out of attempts, dead.
+func (d *Dispatcher) record(del *Delivery, a Attempt) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.queued(del) {
+		// Its webhook was deleted meanwhile.
+		return
+	}
+
+	del.Attempts = append(del.Attempts, a)
+	if n := len(del.Attempts); n > maxAttemptLog {
+		del.Attempts = append([]Attempt(nil), del.Attempts[n-maxAttemptLog:]...)
+	}
+	switch {
+	case a.Error == "":
+		del.Status = StatusDelivered
+		del.NextAttempt = nil
+	case del.Failures+1 >= d.retry.Attempts:
+		del.Failures++
+		del.Status = StatusDead
+		del.NextAttempt = nil
+		log.Printf("Webhooks: giving up on delivery %s of %s to webhook %s: %s", del.ID, del.Event.Type, del.WebhookID, a.Error)
+	default:
+		del.Failures++
+		next := time.Now().Add(d.backoff(del.Failures))
+		del.NextAttempt = &next
+	}
+	d.trim()
+	d.changed()
+}
+
+func (d *Dispatcher) queued(del *Delivery) bool {
+	for _, q := range d.state.Deliveries {
+		if q == del {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns how long to wait after the nth consecutive failure.
+func (d *Dispatcher) backoff(n int) time.Duration {
+	wait := d.retry.Backoff
+	for i := 1; i < n && wait < maxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > maxBackoff {
+		wait = maxBackoff
+	}
+	if jitter := int64(wait / 10); jitter > 0 {
+		wait += time.Duration(rand.Int63n(jitter))
+	}
+	return wait
+}
+
+// trim drops the oldest deliveries beyond the log limits. Pending deliveries
+// are never dropped.
+func (d *Dispatcher) trim() {
+	delivered := map[string]int{}
+	dead := 0
+	keep := make([]bool, len(d.state.Deliveries))
+	dropped := false
+	for i := len(d.state.Deliveries) - 1; i >= 0; i-- {
+		del := d.state.Deliveries[i]
+		switch del.Status {
+		case StatusDelivered:
+			delivered[del.WebhookID]++
+			keep[i] = delivered[del.WebhookID] <= logSize
+		case StatusDead:
+			dead++
+			keep[i] = dead <= maxDeadLetters
+		default:
+			keep[i] = true
+		}
+		dropped = dropped || !keep[i]
+	}
+	if !dropped {
+		return
+	}
+	deliveries := d.state.Deliveries[:0:0]
+	for i, del := range d.state.Deliveries {
+		if keep[i] {
+			deliveries = append(deliveries, del)
+		}
+	}
+	d.state.Deliveries = deliveries
+}
+
+// Deliveries returns the delivery log of a webhook, newest first: its
+// pending, delivered and dead deliveries.
+func (d *Dispatcher) Deliveries(webhookID string) ([]Delivery, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.find(webhookID) == nil {
+		return nil, ErrNotFound
+	}
+	out := []Delivery{}
+	for i := len(d.state.Deliveries) - 1; i >= 0; i-- {
+		if del := d.state.Deliveries[i]; del.WebhookID == webhookID {
+			out = append(out, del.copy())
+		}
+	}
+	return out, nil
+}
+
+// DeadLetters returns the dead-letter queue, oldest first.
+func (d *Dispatcher) DeadLetters() []Delivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := []Delivery{}
+	for _, del := range d.state.Deliveries {
+		if del.Status == StatusDead {
+			out = append(out, del.copy())
+		}
+	}
+	return out
+}
+
+func (d *Dispatcher) deadLetter(id string) *Delivery {
+	for _, del := range d.state.Deliveries {
+		if del.ID == id && del.Status == StatusDead {
+			return del
+		}
+	}
+	return nil
+}
+
+// Redeliver takes a delivery out of the dead-letter queue and queues it
+// again with a fresh set of attempts.
+func (d *Dispatcher) Redeliver(id string) (Delivery, error) {
+	d.saving.Lock()
+	defer d.saving.Unlock()
+	d.mu.Lock()
+	del := d.deadLetter(id)
+	if del == nil {
+		d.mu.Unlock()
+		return Delivery{}, ErrDeliveryNotFound
+	}
+	now := time.Now()
+	del.Status, del.Failures, del.NextAttempt = StatusPending, 0, &now
+	err := d.save()
+	out := del.copy()
+	d.mu.Unlock()
+	if err != nil {
+		return Delivery{}, err
+	}
+	d.wakeUp()
+	return out, nil
+}
+
+// Discard removes a delivery from the dead-letter queue for good.
+func (d *Dispatcher) Discard(id string) error {
+	d.saving.Lock()
+	defer d.saving.Unlock()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.deadLetter(id) == nil {
+		return ErrDeliveryNotFound
+	}
+	deliveries := d.state.Deliveries[:0:0]
+	for _, del := range d.state.Deliveries {
+		if del.ID != id {
+			deliveries = append(deliveries, del)
+		}
+	}
+	d.state.Deliveries = deliveries
+	return d.save()
+}
@@ -0,0 +1,56 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers sent with every delivery.
+const (
+	HeaderEvent     = "X-Todo-Event"
+	HeaderDelivery  = "X-Todo-Delivery"
+	HeaderTimestamp = "X-Todo-Timestamp"
+	HeaderSignature = "X-Todo-Signature"
+)
+
+// Sign returns the signature of a delivery body sent at timestamp (Unix
+// seconds): "sha256=" and the hex HMAC-SHA256, keyed with the webhook's
+// secret, of the timestamp, a dot and the body. Signing the timestamp lets
+// receivers reject old deliveries replayed by someone else.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+var (
+	ErrBadSignature = errors.New("webhook signature does not match")
+	ErrStale        = errors.New("webhook timestamp is too old")
+)
+
+// Verify checks the signature headers of a delivery received with body, for
+// use by receivers written in Go. Deliveries signed more than tolerance ago
+// are rejected; a tolerance of 0 accepts any age.
+func Verify(secret string, header http.Header, body []byte, tolerance time.Duration) error {
+	timestamp, err := strconv.ParseInt(header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		return ErrBadSignature
+	}
+	want := Sign(secret, timestamp, body)
+	got := strings.TrimSpace(header.Get(HeaderSignature))
+	if !hmac.Equal([]byte(got), []byte(want)) {
+		return ErrBadSignature
+	}
+	if tolerance > 0 && time.Since(time.Unix(timestamp, 0)) > tolerance {
+		return ErrStale
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package webhook
+
+import "todo-app/internal/statestore"
+
+// State is everything the dispatcher keeps: the webhooks and their
+// deliveries, oldest first. Pending deliveries are part of it, so a restart
+// resumes them rather than dropping them.
+type State struct {
+	Webhooks   []*Webhook  `json:"webhooks"`
+	Deliveries []*Delivery `json:"deliveries"`
+}
+
+// Store loads and saves the dispatcher's State.
+type Store = statestore.Store[State]
+
+// FileStore keeps the webhooks and their deliveries in a JSON file.
+type FileStore = statestore.File[State]
+
+// MemoryStore keeps the webhooks and their deliveries only for as long as the
+// server runs.
+type MemoryStore = statestore.Memory[State]
+
+// clone copies the state deep enough that the copy can be saved while the
+// dispatcher goes on changing the original.
+func (st *State) clone() *State {
+	c := &State{
+		Webhooks:   make([]*Webhook, len(st.Webhooks)),
+		Deliveries: make([]*Delivery, len(st.Deliveries)),
+	}
+	for i, w := range st.Webhooks {
+		w := *w
+		w.Events = append([]EventType{}, w.Events...)
+		c.Webhooks[i] = &w
+	}
+	for i, del := range st.Deliveries {
+		del := del.copy()
+		c.Deliveries[i] = &del
+	}
+	return c
+}
@@ -0,0 +1,434 @@
+// Package webhook POSTs todo lifecycle events, taken from the service's
+// event bus, to subscribed URLs. Each delivery is signed with the webhook's
+// secret (see Sign), retried with exponential backoff while the receiver
+// fails, and moved to a dead-letter queue once it runs out of attempts, from
+// which it can be retried by hand. Deliveries are kept in a log per webhook
+// and, with the webhooks, in a Store, so pending ones survive a restart.
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"todo-app/internal/apperr"
+	"todo-app/internal/events"
+	"todo-app/internal/models"
+	"todo-app/internal/validation"
+	"todo-app/internal/workflow"
+)
+
+// EventType names the kind of change a delivery reports.
+type EventType string
+
+const (
+	EventCreated EventType = "todo.created"
+	EventUpdated EventType = "todo.updated"
+	// EventCompleted replaces EventUpdated for a change that finishes a
+	// todo, i.e. moves it into a done status.
+	EventCompleted EventType = "todo.completed"
+	EventDeleted   EventType = "todo.deleted"
+)
+
+// EventTypes lists every event type, in lifecycle order.
+var EventTypes = []EventType{EventCreated, EventUpdated, EventCompleted, EventDeleted}
+
+var (
+	ErrNotFound         = apperr.New(apperr.NotFound, "webhook_not_found", "webhook not found")
+	ErrDeliveryNotFound = apperr.New(apperr.NotFound, "delivery_not_found", "delivery not found")
+)
+
+// Webhook is a subscription of a URL to todo events.
+type Webhook struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+	// Events lists the event types to send; empty means all of them.
+	Events []EventType `json:"events"`
+	// Secret keys the signature of every delivery. The API shows it only
+	// when the webhook is created.
+	Secret    string    `json:"secret,omitempty"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (w *Webhook) wants(typ EventType) bool {
+	if !w.Active {
+		return false
+	}
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// redacted returns a copy of the webhook without its secret.
+func (w *Webhook) redacted() Webhook {
+	c := *w
+	c.Events = append([]EventType{}, w.Events...)
+	c.Secret = ""
+	return c
+}
+
+// Event is the body of a delivery.
+type Event struct {
+	// ID is the same in every delivery of the event and in redeliveries, so
+	// receivers can ignore duplicates.
+	ID         string       `json:"id"`
+	Type       EventType    `json:"type"`
+	OccurredAt time.Time    `json:"occurred_at"`
+	Todo       *models.Todo `json:"todo"`
+	// Previous is the todo before an update or completion.
+	Previous *models.Todo `json:"previous,omitempty"`
+}
+
+// RetryPolicy says how often and how fast failed deliveries are retried. The
+// wait after the nth failure is Backoff * 2^(n-1), at most an hour, plus up
+// to a tenth of that at random so that retries to a recovering receiver do
+// not arrive all at once.
+type RetryPolicy struct {
+	// Attempts is how many times a delivery is tried before it is moved to
+	// the dead-letter queue.
+	Attempts int
+	Backoff  time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{Attempts: 8, Backoff: 30 * time.Second}
+
+// Dispatcher manages webhooks and delivers events to them. Subscribe it to
+// the service's events and start Run to deliver.
+type Dispatcher struct {
+	store  Store
+	retry  RetryPolicy
+	client *http.Client
+
+	// saving is held while the state is written, so that an older copy of
+	// it never replaces a newer one. Take it before mu.
+	saving sync.Mutex
+
+	mu    sync.Mutex // guards state, changes, saved and busy
+	state *State
+	// changes counts the changes to state that were not saved right away,
+	// those of queued events and of attempts, and saved how many of them
+	// the store has. They are saved in batches.
+	changes, saved uint64
+	// busy holds the webhooks whose due deliveries are being sent.
+	busy map[string]bool
+	// wake tells Run that a delivery was queued or a webhook is no longer
+	// busy.
+	wake chan struct{}
+	// dirty tells Run's saver that state changed.
+	dirty chan struct{}
+}
+
+// New creates a dispatcher keeping its webhooks and deliveries in store.
+func New(store Store, retry RetryPolicy) (*Dispatcher, error) {
+	state, err := store.Load()
+	if err != nil {
+		return nil, fmt.Errorf("loading webhooks: %w", err)
+	}
+	if state == nil {
+		state = &State{}
+	}
+	if retry.Attempts < 1 {
+		retry.Attempts = 1
+	}
+	return &Dispatcher{
+		store:  store,
+		retry:  retry,
+		client: &http.Client{Timeout: deliveryTimeout},
+		state:  state,
+		busy:   map[string]bool{},
+		wake:   make(chan struct{}, 1),
+		dirty:  make(chan struct{}, 1),
+	}, nil
+}
+
+// save persists the state, including any changes still waiting for Run's
+// saver. It is for changes made through the API, whose callers want to know
+// that they were saved. Callers hold d.saving and d.mu.
+func (d *Dispatcher) save() error {
+	if err := d.store.Save(d.state); err != nil {
+		// Whatever the caller does not roll back is saved with the next
+		// batch.
+		d.changed()
+		return fmt.Errorf("saving webhooks: %w", err)
+	}
+	d.saved = d.changes
+	return nil
+}
+
+// changed notes a change to the state for Run's saver. Callers hold d.mu.
+func (d *Dispatcher) changed() {
+	d.changes++
+	select {
+	case d.dirty <- struct{}{}:
+	default:
+	}
+}
+
+// Flush saves the changes not saved yet. Run saves them in the background
+// and once more when it returns; call Flush after the last event was
+// published, such as once the bus is closed, so that none are lost.
+func (d *Dispatcher) Flush() error {
+	d.saving.Lock()
+	defer d.saving.Unlock()
+	d.mu.Lock()
+	if d.saved == d.changes {
+		d.mu.Unlock()
+		return nil
+	}
+	// Write a copy, so that deliveries go on while the file is written.
+	state, changes := d.state.clone(), d.changes
+	d.mu.Unlock()
+
+	if err := d.store.Save(state); err != nil {
+		return fmt.Errorf("saving webhooks: %w", err)
+	}
+	d.mu.Lock()
+	d.saved = changes
+	d.mu.Unlock()
+	return nil
+}
+
+// wakeUp tells Run to look for due deliveries.
+func (d *Dispatcher) wakeUp() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Webhooks lists the webhooks, oldest first, without their secrets.
+func (d *Dispatcher) Webhooks() []Webhook {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := make([]Webhook, len(d.state.Webhooks))
+	for i, w := range d.state.Webhooks {
+		out[i] = w.redacted()
+	}
+	return out
+}
+
+// Webhook returns a webhook without its secret.
+func (d *Dispatcher) Webhook(id string) (Webhook, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	w := d.find(id)
+	if w == nil {
+		return Webhook{}, ErrNotFound
+	}
+	return w.redacted(), nil
+}
+
+func (d *Dispatcher) find(id string) *Webhook {
+	for _, w := range d.state.Webhooks {
+		if w.ID == id {
+			return w
+		}
+	}
+	return nil
+}
+
+// Create adds a webhook, generating its secret if it has none, and returns it
+// with the secret.
+func (d *Dispatcher) Create(w Webhook) (Webhook, error) {
+	if err := validate(&w); err != nil {
+		return Webhook{}, err
+	}
+	if w.Secret == "" {
+		w.Secret = newSecret()
+	}
+	w.ID = uuid.New().String()
+	w.CreatedAt = time.Now()
+	w.UpdatedAt = w.CreatedAt
+
+	d.saving.Lock()
+	defer d.saving.Unlock()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.state.Webhooks = append(d.state.Webhooks, &w)
+	if err := d.save(); err != nil {
+		d.state.Webhooks = d.state.Webhooks[:len(d.state.Webhooks)-1]
+		return Webhook{}, err
+	}
+	c := w.redacted()
+	c.Secret = w.Secret
+	return c, nil
+}
+
+// Update changes the fields of a webhook that are not nil.
+type Update struct {
+	URL    *string
+	Events *[]EventType
+	Secret *string
+	Active *bool
+}
+
+// Update changes a webhook. Deliveries already queued are sent to its new URL
+// with its new secret, so a receiver that moved still gets them.
+func (d *Dispatcher) Update(id string, u Update) (Webhook, error) {
+	d.saving.Lock()
+	defer d.saving.Unlock()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	w := d.find(id)
+	if w == nil {
+		return Webhook{}, ErrNotFound
+	}
+	changed := *w
+	if u.URL != nil {
+		changed.URL = *u.URL
+	}
+	if u.Events != nil {
+		changed.Events = *u.Events
+	}
+	if u.Secret != nil {
+		changed.Secret = *u.Secret
+	}
+	if u.Active != nil {
+		changed.Active = *u.Active
+	}
+	if err := validate(&changed); err != nil {
+		return Webhook{}, err
+	}
+	if changed.Secret == "" {
+		changed.Secret = w.Secret
+	}
+	changed.UpdatedAt = time.Now()
+
+	old := *w
+	*w = changed
+	if err := d.save(); err != nil {
+		*w = old
+		return Webhook{}, err
+	}
+	return w.redacted(), nil
+}
+
+// Delete removes a webhook with its deliveries, including pending ones.
+func (d *Dispatcher) Delete(id string) error {
+	d.saving.Lock()
+	defer d.saving.Unlock()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.find(id) == nil {
+		return ErrNotFound
+	}
+	webhooks := d.state.Webhooks[:0:0]
+	for _, w := range d.state.Webhooks {
+		if w.ID != id {
+			webhooks = append(webhooks, w)
+		}
+	}
+	deliveries := d.state.Deliveries[:0:0]
+	for _, del := range d.state.Deliveries {
+		if del.WebhookID != id {
+			deliveries = append(deliveries, del)
+		}
+	}
+	d.state.Webhooks, d.state.Deliveries = webhooks, deliveries
+	return d.save()
+}
+
+// validate checks a webhook and normalizes its event list.
+func validate(w *Webhook) error {
+	var errs validation.Errors
+	if u, err := url.Parse(w.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs.Add("url", "url", "must be an absolute http or https URL")
+	}
+	seen := map[EventType]bool{}
+	events := []EventType{}
+	for _, e := range w.Events {
+		if !knownEvent(e) {
+			errs.Add("events", "event", "%q is not an event type (want one of %v)", e, EventTypes)
+			break
+		}
+		if !seen[e] {
+			seen[e] = true
+			events = append(events, e)
+		}
+	}
+	w.Events = events
+	return errs.Err()
+}
+
+func knownEvent(typ EventType) bool {
+	for _, e := range EventTypes {
+		if e == typ {
+			return true
+		}
+	}
+	return false
+}
+
+func newSecret() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// Subscribe queues deliveries for the todo events published on bus. flow
+// tells completions from other updates. Queueing happens in the background;
+// the bus keeps the events of each todo in order, and rather than lose events
+// it slows changes down if the queue falls behind.
+func (d *Dispatcher) Subscribe(bus *events.Bus, flow *workflow.Workflow) *events.Subscription {
+	return bus.SubscribeAsync("webhooks", func(ctx context.Context, e events.Event) {
+		event := Event{ID: uuid.New().String(), OccurredAt: time.Now()}
+		switch e := e.(type) {
+		case events.TodoCreated:
+			event.Type, event.Todo = EventCreated, e.Todo
+		case events.TodoUpdated:
+			event.Type, event.Todo, event.Previous = EventUpdated, e.After, e.Before
+			if !flow.IsDone(e.Before.Status) && flow.IsDone(e.After.Status) {
+				event.Type = EventCompleted
+			}
+		case events.TodoDeleted:
+			event.Type, event.Todo = EventDeleted, e.Todo
+		default:
+			return
+		}
+		d.queue(event)
+	}, events.AsyncOptions{Overflow: events.Block})
+}
+
+// queue queues a delivery of event to every active webhook that wants it.
+func (d *Dispatcher) queue(event Event) {
+	d.mu.Lock()
+	queued := false
+	for _, w := range d.state.Webhooks {
+		if !w.wants(event.Type) {
+			continue
+		}
+		next := event.OccurredAt
+		d.state.Deliveries = append(d.state.Deliveries, &Delivery{
+			ID:          uuid.New().String(),
+			WebhookID:   w.ID,
+			Event:       event,
+			Status:      StatusPending,
+			NextAttempt: &next,
+		})
+		queued = true
+	}
+	if queued {
+		d.changed()
+	}
+	d.mu.Unlock()
+
+	if queued {
+		d.wakeUp()
+	}
+}
@@ -0,0 +1,344 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"todo-app/internal/models"
+)
+
+// These tests run a dispatcher against receivers served by httptest, with
+// retries a millisecond apart, and watch its delivery log.
+
+// start runs d until the test ends.
+func start(t *testing.T, d *Dispatcher) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		d.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+// receiver serves a webhook that answers with the status handle returns.
+func receiver(t *testing.T, handle func(r *http.Request, body []byte) int) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(handle(r, body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func create(t *testing.T, d *Dispatcher, w Webhook) Webhook {
+	t.Helper()
+	w.Active = true
+	created, err := d.Create(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return created
+}
+
+func event(id string) Event {
+	return Event{
+		ID:         "event-" + id,
+		Type:       EventCreated,
+		OccurredAt: time.Now(),
+		Todo:       &models.Todo{ID: id, Title: "todo " + id, Status: models.StatusPending},
+	}
+}
+
+// waitFor polls the delivery log of a webhook until it has a delivery with
+// the given status, and returns that delivery.
+func waitFor(t *testing.T, d *Dispatcher, webhookID string, status Status) Delivery {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		deliveries, err := d.Deliveries(webhookID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, del := range deliveries {
+			if del.Status == status {
+				return del
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no %s delivery for webhook %s; log: %+v", status, webhookID, deliveries)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// TestDeliveryIsSigned checks the headers and the body of a delivery, and
+// that the signature checks out with the webhook's secret and no other.
+func TestDeliveryIsSigned(t *testing.T) {
+	const secret = "s3cret"
+	received := make(chan http.Header, 1)
+	var body []byte
+	url := receiver(t, func(r *http.Request, b []byte) int {
+		body = b
+		received <- r.Header.Clone()
+		return http.StatusNoContent
+	})
+	d, err := New(&MemoryStore{}, RetryPolicy{Attempts: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := create(t, d, Webhook{URL: url, Secret: secret})
+	start(t, d)
+
+	d.queue(event("a"))
+	header := <-received
+	del := waitFor(t, d, w.ID, StatusDelivered)
+
+	if err := Verify(secret, header, body, time.Minute); err != nil {
+		t.Errorf("Verify with the webhook's secret: %v", err)
+	}
+	if err := Verify("other", header, body, time.Minute); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("Verify with another secret returned %v, want ErrBadSignature", err)
+	}
+	timestamp, err := strconv.ParseInt(header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		t.Fatalf("%s %q: %v", HeaderTimestamp, header.Get(HeaderTimestamp), err)
+	}
+	if got, want := header.Get(HeaderSignature), Sign(secret, timestamp, body); got != want {
+		t.Errorf("%s is %q, want %q", HeaderSignature, got, want)
+	}
+	if got := header.Get(HeaderEvent); got != string(EventCreated) {
+		t.Errorf("%s is %q, want %q", HeaderEvent, got, EventCreated)
+	}
+	if got := header.Get(HeaderDelivery); got != del.ID {
+		t.Errorf("%s is %q, want the delivery's ID %q", HeaderDelivery, got, del.ID)
+	}
+
+	var sent Event
+	if err := json.Unmarshal(body, &sent); err != nil {
+		t.Fatal(err)
+	}
+	if sent.ID != "event-a" || sent.Type != EventCreated || sent.Todo == nil || sent.Todo.ID != "a" {
+		t.Errorf("sent %s", body)
+	}
+	if len(del.Attempts) != 1 || del.Attempts[0].StatusCode != http.StatusNoContent || del.Attempts[0].Error != "" {
+		t.Errorf("logged attempts %+v, want one answered 204", del.Attempts)
+	}
+}
+
+// TestRetriesUntilDelivered has the receiver fail twice before it accepts a
+// delivery, which has three attempts.
+func TestRetriesUntilDelivered(t *testing.T) {
+	var calls atomic.Int32
+	url := receiver(t, func(*http.Request, []byte) int {
+		if calls.Add(1) <= 2 {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusOK
+	})
+	d, err := New(&MemoryStore{}, RetryPolicy{Attempts: 3, Backoff: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := create(t, d, Webhook{URL: url})
+	start(t, d)
+
+	d.queue(event("a"))
+	del := waitFor(t, d, w.ID, StatusDelivered)
+	if del.Failures != 2 || len(del.Attempts) != 3 {
+		t.Fatalf("delivered after %d failures and %d attempts, want 2 and 3", del.Failures, len(del.Attempts))
+	}
+	for i, a := range del.Attempts[:2] {
+		if a.StatusCode != http.StatusServiceUnavailable || a.Error == "" {
+			t.Errorf("attempt %d logged as %+v, want a failed 503", i+1, a)
+		}
+	}
+	if len(d.DeadLetters()) != 0 {
+		t.Errorf("dead letters: %+v", d.DeadLetters())
+	}
+}
+
+// TestFailingDeliveryGoesToDeadLetters has the receiver fail every attempt,
+// then recover, and retries the dead delivery by hand.
+func TestFailingDeliveryGoesToDeadLetters(t *testing.T) {
+	const attempts = 4
+	var calls atomic.Int32
+	var up atomic.Bool
+	url := receiver(t, func(*http.Request, []byte) int {
+		calls.Add(1)
+		if up.Load() {
+			return http.StatusOK
+		}
+		return http.StatusInternalServerError
+	})
+	d, err := New(&MemoryStore{}, RetryPolicy{Attempts: attempts, Backoff: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := create(t, d, Webhook{URL: url})
+	start(t, d)
+
+	d.queue(event("a"))
+	dead := waitFor(t, d, w.ID, StatusDead)
+	if got := calls.Load(); got != attempts {
+		t.Errorf("receiver was called %d times, want %d", got, attempts)
+	}
+	if dead.Failures != attempts || len(dead.Attempts) != attempts || dead.NextAttempt != nil {
+		t.Errorf("dead delivery has %d failures, %d attempts and next attempt %v, want %d, %d and none",
+			dead.Failures, len(dead.Attempts), dead.NextAttempt, attempts, attempts)
+	}
+	for i, a := range dead.Attempts {
+		if a.StatusCode != http.StatusInternalServerError || a.Error == "" {
+			t.Errorf("attempt %d logged as %+v, want a failed 500", i+1, a)
+		}
+	}
+	letters := d.DeadLetters()
+	if len(letters) != 1 || letters[0].ID != dead.ID {
+		t.Fatalf("dead letters: %+v, want delivery %s", letters, dead.ID)
+	}
+
+	up.Store(true)
+	if _, err := d.Redeliver(dead.ID); err != nil {
+		t.Fatal(err)
+	}
+	del := waitFor(t, d, w.ID, StatusDelivered)
+	if del.ID != dead.ID || del.Failures != 0 || len(del.Attempts) != attempts+1 {
+		t.Errorf("redelivered %s with %d failures and %d attempts, want %s with 0 and %d",
+			del.ID, del.Failures, len(del.Attempts), dead.ID, attempts+1)
+	}
+	if len(d.DeadLetters()) != 0 {
+		t.Errorf("dead letters after redelivery: %+v", d.DeadLetters())
+	}
+}
+
+// TestSlowWebhookDoesNotStallOthers has one receiver hang while another one
+// is sent the same events.
+func TestSlowWebhookDoesNotStallOthers(t *testing.T) {
+	release := make(chan struct{})
+	slowURL := receiver(t, func(r *http.Request, _ []byte) int {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+		return http.StatusOK
+	})
+	var fastCalls atomic.Int32
+	fastURL := receiver(t, func(*http.Request, []byte) int {
+		fastCalls.Add(1)
+		return http.StatusOK
+	})
+	d, err := New(&MemoryStore{}, RetryPolicy{Attempts: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	slow := create(t, d, Webhook{URL: slowURL})
+	fast := create(t, d, Webhook{URL: fastURL})
+	start(t, d)
+	defer close(release)
+
+	d.queue(event("a"))
+	waitFor(t, d, fast.ID, StatusDelivered)
+	// A second event, queued while the slow receiver still hangs on the
+	// first, must not wait for it either.
+	d.queue(event("b"))
+	for deadline := time.Now().Add(5 * time.Second); fastCalls.Load() < 2; {
+		if time.Now().After(deadline) {
+			t.Fatal("the second event never reached the fast receiver")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	deliveries, err := d.Deliveries(slow.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, del := range deliveries {
+		if del.Status != StatusPending {
+			t.Errorf("slow receiver's delivery %s is %s before it answered", del.ID, del.Status)
+		}
+	}
+}
+
+// countingStore counts the saves of a MemoryStore.
+type countingStore struct {
+	MemoryStore
+	mu    sync.Mutex
+	saves int
+}
+
+func (s *countingStore) Save(state *State) error {
+	s.mu.Lock()
+	s.saves++
+	s.mu.Unlock()
+	return s.MemoryStore.Save(state)
+}
+
+// TestChangesAreSavedInBatches sends many events and checks that queueing
+// and delivering them takes far fewer saves than changes, and that the last
+// of them are saved by the time Run returns.
+func TestChangesAreSavedInBatches(t *testing.T) {
+	const events = 50
+	var calls atomic.Int32
+	url := receiver(t, func(*http.Request, []byte) int {
+		calls.Add(1)
+		return http.StatusOK
+	})
+	store := &countingStore{}
+	d, err := New(store, RetryPolicy{Attempts: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	create(t, d, Webhook{URL: url})
+	store.saves = 0
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		d.Run(ctx)
+	}()
+	for i := 0; i < events; i++ {
+		d.queue(event(strconv.Itoa(i)))
+	}
+	for deadline := time.Now().Add(5 * time.Second); calls.Load() < events; {
+		if time.Now().After(deadline) {
+			t.Fatalf("only %d of %d events were sent", calls.Load(), events)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	// Each event makes two changes: it is queued, then delivered.
+	if store.saves == 0 || store.saves > events/5 {
+		t.Errorf("%d changes took %d saves", 2*events, store.saves)
+	}
+	saved, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	delivered := 0
+	for _, del := range saved.Deliveries {
+		if del.Status == StatusDelivered {
+			delivered++
+		}
+	}
+	if delivered != events {
+		t.Errorf("saved %d delivered deliveries, want %d", delivered, events)
+	}
+}
@@ -0,0 +1,272 @@
+// Package workflow defines which statuses a todo can have and which status
+// changes are allowed. Each allowed change is a named action, such as
+// "start" (pending -> in_progress), that clients can invoke directly. The
+// set of statuses and actions comes from a JSON config file, or Default.
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"todo-app/internal/apperr"
+	"todo-app/internal/models"
+	"todo-app/internal/validation"
+)
+
+var (
+	ErrUnknownAction = apperr.New(apperr.NotFound, "unknown_action", "unknown action")
+	// ErrNotAllowed means the todo's current status does not permit the
+	// requested change.
+	ErrNotAllowed = apperr.New(apperr.Conflict, "transition_not_allowed", "status change not allowed")
+)
+
+// Config is the JSON form of a workflow.
+type Config struct {
+	// Initial is the status of new todos.
+	Initial  models.Status  `json:"initial"`
+	Statuses []StatusConfig `json:"statuses"`
+	Actions  []Action       `json:"actions"`
+}
+
+type StatusConfig struct {
+	Name models.Status `json:"name"`
+	// Done marks statuses that finish a todo, such as completed or
+	// cancelled.
+	Done bool `json:"done,omitempty"`
+}
+
+// Action is a named, allowed status change.
+type Action struct {
+	Name string          `json:"name"`
+	From []models.Status `json:"from"`
+	To   models.Status   `json:"to"`
+	// RequireReason makes the caller explain the change, e.g. for reopening.
+	RequireReason bool `json:"require_reason,omitempty"`
+	// RequireUnblocked only allows the action once every todo the todo is
+	// blocked by is done.
+	RequireUnblocked bool `json:"require_unblocked,omitempty"`
+}
+
+// Default is the built-in workflow: the three standard statuses, starting or
+// completing a todo waits for its blockers, and reopening a completed todo
+// needs a reason.
+func Default() Config {
+	return Config{
+		Initial: models.StatusPending,
+		Statuses: []StatusConfig{
+			{Name: models.StatusPending},
+			{Name: models.StatusInProgress},
+			{Name: models.StatusCompleted, Done: true},
+		},
+		Actions: []Action{
+			{Name: "start", From: []models.Status{models.StatusPending}, To: models.StatusInProgress, RequireUnblocked: true},
+			{Name: "stop", From: []models.Status{models.StatusInProgress}, To: models.StatusPending},
+			{Name: "complete", From: []models.Status{models.StatusPending, models.StatusInProgress}, To: models.StatusCompleted, RequireUnblocked: true},
+			{Name: "reopen", From: []models.Status{models.StatusCompleted}, To: models.StatusPending, RequireReason: true},
+		},
+	}
+}
+
+// Transition describes one status change of a todo.
+type Transition struct {
+	Action   string
+	From, To models.Status
+	Reason   string
+	// Todo is the todo as it will be (before hooks) or was (after hooks)
+	// saved.
+	Todo *models.Todo
+}
+
+// A BeforeHook runs before a transition is saved; returning an error
+// cancels it. An AfterHook runs once it has been saved.
+type (
+	BeforeHook func(ctx context.Context, t Transition) error
+	AfterHook  func(ctx context.Context, t Transition)
+)
+
+// Workflow is a validated Config plus hooks. Hooks must be registered before
+// the workflow is used.
+type Workflow struct {
+	config   Config
+	statuses map[models.Status]StatusConfig
+	actions  map[string]Action
+	before   []BeforeHook
+	after    []AfterHook
+}
+
+var actionName = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
+// New checks config and builds a workflow from it.
+func New(config Config) (*Workflow, error) {
+	w := &Workflow{
+		config:   config,
+		statuses: make(map[models.Status]StatusConfig),
+		actions:  make(map[string]Action),
+	}
+
+	for _, s := range config.Statuses {
+		if s.Name == "" {
+			return nil, errors.New("workflow: status without a name")
+		}
+		if _, dup := w.statuses[s.Name]; dup {
+			return nil, fmt.Errorf("workflow: duplicate status %q", s.Name)
+		}
+		w.statuses[s.Name] = s
+	}
+	if !w.IsStatus(config.Initial) {
+		return nil, fmt.Errorf("workflow: initial status %q is not a status", config.Initial)
+	}
+
+	for _, a := range config.Actions {
+		if !actionName.MatchString(a.Name) {
+			return nil, fmt.Errorf("workflow: invalid action name %q", a.Name)
+		}
+		if _, dup := w.actions[a.Name]; dup {
+			return nil, fmt.Errorf("workflow: duplicate action %q", a.Name)
+		}
+		if !w.IsStatus(a.To) {
+			return nil, fmt.Errorf("workflow: action %q leads to unknown status %q", a.Name, a.To)
+		}
+		if len(a.From) == 0 {
+			return nil, fmt.Errorf("workflow: action %q has no from statuses", a.Name)
+		}
+		for _, from := range a.From {
+			if !w.IsStatus(from) {
+				return nil, fmt.Errorf("workflow: action %q starts from unknown status %q", a.Name, from)
+			}
+		}
+		w.actions[a.Name] = a
+	}
+	return w, nil
+}
+
+// Load reads a Config from a JSON file.
+func Load(path string) (*Workflow, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("workflow: %s: %w", path, err)
+	}
+	return New(config)
+}
+
+// Config returns the configuration the workflow was built from.
+func (w *Workflow) Config() Config {
+	return w.config
+}
+
+func (w *Workflow) Initial() models.Status {
+	return w.config.Initial
+}
+
+func (w *Workflow) IsStatus(s models.Status) bool {
+	_, ok := w.statuses[s]
+	return ok
+}
+
+// IsDone reports whether s finishes a todo.
+func (w *Workflow) IsDone(s models.Status) bool {
+	return w.statuses[s].Done
+}
+
+// Statuses returns the status names in config order.
+func (w *Workflow) Statuses() []models.Status {
+	names := make([]models.Status, len(w.config.Statuses))
+	for i, s := range w.config.Statuses {
+		names[i] = s.Name
+	}
+	return names
+}
+
+// Action returns the named action.
+func (w *Workflow) Action(name string) (Action, bool) {
+	a, ok := w.actions[name]
+	return a, ok
+}
+
+// Fire starts the named action on a todo currently in status from.
+func (w *Workflow) Fire(action string, from models.Status, reason string) (*Transition, error) {
+	a, ok := w.actions[action]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownAction, action)
+	}
+	if !a.allows(from) {
+		return nil, fmt.Errorf("%w: cannot %s a todo that is %s", ErrNotAllowed, action, from)
+	}
+	return w.transition(a, from, reason)
+}
+
+// Between finds the action that changes from into to, for clients that set
+// the status directly instead of naming an action.
+func (w *Workflow) Between(from, to models.Status, reason string) (*Transition, error) {
+	for _, a := range w.config.Actions {
+		if a.To == to && a.allows(from) {
+			return w.transition(a, from, reason)
+		}
+	}
+	return nil, fmt.Errorf("%w: cannot change status from %s to %s", ErrNotAllowed, from, to)
+}
+
+// Finish finds an action that takes a todo in status from to a done status
+// without needing a reason, for finishing todos automatically. Actions are
+// tried in config order.
+func (w *Workflow) Finish(from models.Status) (*Transition, error) {
+	for _, a := range w.config.Actions {
+		if w.IsDone(a.To) && !a.RequireReason && a.allows(from) {
+			return w.transition(a, from, "")
+		}
+	}
+	return nil, fmt.Errorf("%w: no action finishes a todo that is %s", ErrNotAllowed, from)
+}
+
+func (w *Workflow) transition(a Action, from models.Status, reason string) (*Transition, error) {
+	if a.RequireReason && reason == "" {
+		var errs validation.Errors
+		errs.Add("reason", "required", "is required to %s a todo", a.Name)
+		return nil, errs
+	}
+	return &Transition{Action: a.Name, From: from, To: a.To, Reason: reason}, nil
+}
+
+func (a Action) allows(from models.Status) bool {
+	for _, s := range a.From {
+		if s == from {
+			return true
+		}
+	}
+	return false
+}
+
+// OnBefore registers a hook that can veto transitions.
+func (w *Workflow) OnBefore(hook BeforeHook) {
+	w.before = append(w.before, hook)
+}
+
+// OnAfter registers a hook that is told about saved transitions.
+func (w *Workflow) OnAfter(hook AfterHook) {
+	w.after = append(w.after, hook)
+}
+
+// Before runs the before hooks in registration order and stops at the first
+// error.
+func (w *Workflow) Before(ctx context.Context, t Transition) error {
+	for _, hook := range w.before {
+		if err := hook(ctx, t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// After runs the after hooks in registration order.
+func (w *Workflow) After(ctx context.Context, t Transition) {
+	for _, hook := range w.after {
+		hook(ctx, t)
+	}
+}
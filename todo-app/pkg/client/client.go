@@ -0,0 +1,237 @@
+// Package client is a Go client for the todo server's REST API.
+//
+//	c := client.New("http://localhost:8080")
+//	todo, err := c.CreateTodo(ctx, client.NewTodo{Title: "Buy milk"})
+//	if errors.Is(err, client.ErrValidation) { ... }
+//
+//	it := c.Todos(ctx, client.ListOptions{Query: "status:pending"})
+//	for it.Next() {
+//		fmt.Println(it.Value().Title)
+//	}
+//	if err := it.Err(); err != nil { ... }
+//
+// Every call takes a context. Failed requests return an *Error carrying the
+// server's problem document, which errors.Is matches against ErrNotFound,
+// ErrConflict and the other sentinel errors. Calls that are safe to repeat
+// are retried with backoff when the server is unavailable or cannot be
+// reached; see RetryPolicy.
+//
+// The collaboration socket at /api/v1/ws has a protocol of its own and is
+// not covered.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryPolicy says how often and how fast calls that are safe to repeat are
+// retried. The wait after the nth failed attempt is Backoff * 2^(n-1), at
+// most MaxBackoff, plus up to a tenth of that at random; a Retry-After from
+// the server takes precedence.
+type RetryPolicy struct {
+	// Attempts is how often a call is tried in all; 1 or less never
+	// retries.
+	Attempts   int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicy tries calls three times, waiting 200ms and 400ms in
+// between.
+var DefaultRetryPolicy = RetryPolicy{Attempts: 3, Backoff: 200 * time.Millisecond, MaxBackoff: 5 * time.Second}
+
+// wait returns how long to wait after the nth failed attempt.
+func (p RetryPolicy) wait(n int) time.Duration {
+	d := p.Backoff << (n - 1)
+	if d <= 0 || (p.MaxBackoff > 0 && d > p.MaxBackoff) {
+		d = p.MaxBackoff
+	}
+	if d > 0 {
+		d += time.Duration(rand.Int63n(int64(d)/10 + 1))
+	}
+	return d
+}
+
+// Client calls the API of one server. Its fields may be changed before it is
+// first used; after that it is safe for concurrent use.
+type Client struct {
+	// BaseURL is the root of the API, e.g. "http://localhost:8080/api/v1".
+	BaseURL string
+	// HTTPClient sends the requests; nil means http.DefaultClient. Set one
+	// with its own Transport to add authentication, tracing and the like.
+	HTTPClient *http.Client
+	// Timeout bounds each attempt of a call, 0 for no bound beyond the
+	// context's. Watch is exempt, as its stream stays open.
+	Timeout time.Duration
+	Retry   RetryPolicy
+}
+
+// New creates a client of the server at baseURL, which is either the API's
+// root or the server's, such as "http://localhost:8080". Calls time out
+// after 30 seconds and follow DefaultRetryPolicy.
+func New(baseURL string) *Client {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	if !strings.HasSuffix(baseURL, "/api/v1") {
+		baseURL += "/api/v1"
+	}
+	return &Client{BaseURL: baseURL, Timeout: 30 * time.Second, Retry: DefaultRetryPolicy}
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// request describes one call.
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	header http.Header
+	// body is encoded as JSON unless it is nil.
+	body        interface{}
+	contentType string
+	// idempotent calls are retried. GET, PUT and DELETE always are.
+	idempotent bool
+}
+
+// ifMatch returns the header that makes a change apply only to the given
+// version of a todo, or nil for version 0.
+func ifMatch(version int64) http.Header {
+	if version == 0 {
+		return nil
+	}
+	return http.Header{"If-Match": {strconv.Quote(strconv.FormatInt(version, 10))}}
+}
+
+// do makes a call, retrying it as the policy allows, and decodes the
+// response body into out unless out is nil. It returns the final response,
+// whose body is already closed.
+func (c *Client) do(ctx context.Context, r request, out interface{}) (*http.Response, error) {
+	var body []byte
+	if r.body != nil {
+		var err error
+		if body, err = json.Marshal(r.body); err != nil {
+			return nil, err
+		}
+	}
+	retry := r.idempotent || r.method == http.MethodGet || r.method == http.MethodPut || r.method == http.MethodDelete
+
+	for attempt := 1; ; attempt++ {
+		resp, err := c.attempt(ctx, r, body, out)
+		if err == nil {
+			return resp, nil
+		}
+		if !retry || attempt >= c.Retry.Attempts || !retryable(ctx, err) {
+			return resp, err
+		}
+		wait := c.Retry.wait(attempt)
+		if after, ok := retryAfter(resp); ok {
+			wait = after
+		}
+		select {
+		case <-ctx.Done():
+			return resp, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (c *Client) attempt(ctx context.Context, r request, body []byte, out interface{}) (*http.Response, error) {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	target := c.BaseURL + r.path
+	if len(r.query) > 0 {
+		target += "?" + r.query.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, r.method, target, reader)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range r.header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		contentType := r.contentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return resp, responseError(resp)
+	}
+	if out == nil {
+		io.Copy(io.Discard, resp.Body)
+		return resp, nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return resp, fmt.Errorf("decoding %s %s response: %w", r.method, r.path, err)
+	}
+	return resp, nil
+}
+
+// retryable reports whether a failed attempt may succeed if repeated: the
+// server was unavailable, timed out or asked to slow down, or could not be
+// reached at all.
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	// Transport errors, including an attempt's own timeout.
+	return true
+}
+
+// retryAfter returns the wait a 429 or 503 response asks for in seconds.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// Health checks that the server is up.
+func (c *Client) Health(ctx context.Context) error {
+	_, err := c.do(ctx, request{method: http.MethodGet, path: "/health"}, nil)
+	return err
+}
@@ -0,0 +1,84 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"todo-app/pkg/utils"
+)
+
+// Errors that errors.Is matches a failed call's *Error against, by the
+// status of the response.
+var (
+	// ErrInvalid is a malformed request: 400.
+	ErrInvalid = errors.New("invalid request")
+	// ErrNotFound is a todo, webhook or route that does not exist: 404.
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is a change that contradicts others, such as a
+	// dependency cycle or a workflow action not allowed in the todo's
+	// status: 409.
+	ErrConflict = errors.New("conflict")
+	// ErrPrecondition is a change made against an outdated version of a
+	// todo: 412. Get the todo again and redo the change on top of it.
+	ErrPrecondition = errors.New("precondition failed")
+	// ErrValidation is a request with invalid fields, which Problem.Errors
+	// lists: 422.
+	ErrValidation = errors.New("validation failed")
+	// ErrUnavailable is a server that cannot serve the request right now:
+	// 503.
+	ErrUnavailable = errors.New("service unavailable")
+	// ErrTimeout is a request the server gave up on: 504.
+	ErrTimeout = errors.New("timeout")
+)
+
+var statusErrors = map[int]error{
+	http.StatusBadRequest:          ErrInvalid,
+	http.StatusNotFound:            ErrNotFound,
+	http.StatusConflict:            ErrConflict,
+	http.StatusPreconditionFailed:  ErrPrecondition,
+	http.StatusUnprocessableEntity: ErrValidation,
+	http.StatusServiceUnavailable:  ErrUnavailable,
+	http.StatusGatewayTimeout:      ErrTimeout,
+}
+
+// Error is a response with an error status.
+type Error struct {
+	StatusCode int
+	// Problem is the RFC 7807 problem document the server sent. Responses
+	// that are not one, e.g. from a proxy, get a problem made up from
+	// their status and body.
+	Problem *utils.Problem
+}
+
+func (e *Error) Error() string {
+	return e.Problem.Error()
+}
+
+// Is matches the sentinel error for the response's status.
+func (e *Error) Is(target error) bool {
+	return statusErrors[e.StatusCode] == target
+}
+
+// Code is the machine-readable code of the problem, such as
+// "invalid_transition", or "" if the server did not send one.
+func (e *Error) Code() string {
+	return e.Problem.Code
+}
+
+// responseError reads the error of a response with an error status.
+func responseError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	var problem utils.Problem
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), utils.ProblemContentType) || json.Unmarshal(body, &problem) != nil {
+		problem = utils.Problem{
+			Title:  fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode)),
+			Status: resp.StatusCode,
+			Detail: strings.TrimSpace(string(body)),
+		}
+	}
+	return &Error{StatusCode: resp.StatusCode, Problem: &problem}
+}
@@ -0,0 +1,146 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Types of change events.
+const (
+	EventCreated = "todo.created"
+	EventUpdated = "todo.updated"
+	EventDeleted = "todo.deleted"
+	// EventReset says that changes were missed while disconnected, as the
+	// server no longer remembers them: reload the todos to catch up.
+	EventReset = "reset"
+)
+
+// ChangeEvent is a change to a todo, as Watch streams it.
+type ChangeEvent struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Todo       *Todo     `json:"todo"`
+	// Previous is the todo before an update.
+	Previous *Todo `json:"previous,omitempty"`
+	// Origin names the client that made the change, if it said.
+	Origin string `json:"origin,omitempty"`
+}
+
+// WatchOptions select the changes Watch streams.
+type WatchOptions struct {
+	// Query is a filter query the todo must match, before or after the
+	// change.
+	Query string
+	// Types lists the event types wanted, all of them if empty.
+	Types []string
+	// LastEventID resumes after the event with this ID.
+	LastEventID string
+}
+
+// Watch streams the changes to todos to handle as the server sends them,
+// until ctx is done. It reconnects when the connection drops, resuming after
+// the last event handled, and returns ctx's error in the end. A response
+// with an error status other than those RetryPolicy retries ends it with
+// that error.
+func (c *Client) Watch(ctx context.Context, opts WatchOptions, handle func(ChangeEvent)) error {
+	params := url.Values{}
+	if opts.Query != "" {
+		params.Set("q", opts.Query)
+	}
+	if len(opts.Types) > 0 {
+		params.Set("type", strings.Join(opts.Types, ","))
+	}
+
+	lastID := opts.LastEventID
+	retry := 2 * time.Second
+	for {
+		err := c.watch(ctx, params, &lastID, &retry, handle)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var apiErr *Error
+		if errors.As(err, &apiErr) && !retryable(ctx, err) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retry):
+		}
+	}
+}
+
+// watch reads the event stream of one connection.
+func (c *Client) watch(ctx context.Context, params url.Values, lastID *string, retry *time.Duration, handle func(ChangeEvent)) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+"/todos/events?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if *lastID != "" {
+		req.Header.Set("Last-Event-ID", *lastID)
+	}
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+
+	// Server-Sent Events: "field: value" lines, with a blank line ending
+	// each event.
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	var id, event, data string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if id != "" {
+				*lastID = id
+			}
+			dispatch(event, data, handle)
+			id, event, data = "", "", ""
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "id":
+			id = value
+		case "event":
+			event = value
+		case "data":
+			if data != "" {
+				data += "\n"
+			}
+			data += value
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil {
+				*retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+func dispatch(event, data string, handle func(ChangeEvent)) {
+	if event == EventReset {
+		handle(ChangeEvent{Type: EventReset})
+		return
+	}
+	var change ChangeEvent
+	if data == "" || json.Unmarshal([]byte(data), &change) != nil || change.Todo == nil {
+		return
+	}
+	handle(change)
+}
@@ -0,0 +1,65 @@
+package client
+
+import "context"
+
+// Iterator steps through a listing that the server returns in pages,
+// fetching each page when the previous one is used up:
+//
+//	for it.Next() {
+//		item := it.Value()
+//	}
+//	if err := it.Err(); err != nil { ... }
+type Iterator[T any] struct {
+	ctx context.Context
+	// fetch returns the page at cursor, the cursor of the page after it
+	// and whether there is one.
+	fetch func(ctx context.Context, cursor string) (items []T, next string, more bool, err error)
+
+	items  []T
+	item   T
+	cursor string
+	done   bool
+	err    error
+}
+
+func newIterator[T any](ctx context.Context, cursor string, fetch func(context.Context, string) ([]T, string, bool, error)) *Iterator[T] {
+	return &Iterator[T]{ctx: ctx, fetch: fetch, cursor: cursor}
+}
+
+// Next advances to the next item, reporting false at the end of the listing
+// or when fetching a page failed.
+func (it *Iterator[T]) Next() bool {
+	for len(it.items) == 0 {
+		if it.done || it.err != nil {
+			return false
+		}
+		items, next, more, err := it.fetch(it.ctx, it.cursor)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.items, it.done = items, !more
+		if next != "" {
+			it.cursor = next
+		}
+	}
+	it.item, it.items = it.items[0], it.items[1:]
+	return true
+}
+
+// Value returns the current item.
+func (it *Iterator[T]) Value() T {
+	return it.item
+}
+
+// Err returns the error that ended the iteration, if any.
+func (it *Iterator[T]) Err() error {
+	return it.err
+}
+
+// Cursor returns the cursor of the page after the ones fetched so far. For
+// Changes, once Next has returned false without an error, it is the token
+// to pass as since next time.
+func (it *Iterator[T]) Cursor() string {
+	return it.cursor
+}
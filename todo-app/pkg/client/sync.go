@@ -0,0 +1,127 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"todo-app/pkg/utils"
+)
+
+// Operations of sync changes.
+const (
+	OpUpsert = "upsert"
+	OpDelete = "delete"
+)
+
+// Change is a change on the server since a sync token: a todo as last saved,
+// or the deletion of one.
+type Change struct {
+	Op string `json:"op"`
+	ID string `json:"id"`
+	// Todo is the todo, for OpUpsert.
+	Todo *Todo `json:"todo,omitempty"`
+	// Clocks are the hybrid logical clock times the todo's fields last
+	// changed, for clients that merge changes themselves.
+	Clocks map[string]string `json:"clocks,omitempty"`
+	// DeletedAt is when the todo was deleted, for OpDelete.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// ChangeSet is one page of the changes since a sync token.
+type ChangeSet struct {
+	Changes []Change `json:"changes"`
+	// Token continues after these changes. Save it once they are stored.
+	Token string `json:"token"`
+	// More is set when further changes follow right away.
+	More bool `json:"more"`
+	// Clock is the server's current clock time, which the client's clock
+	// should move past.
+	Clock string `json:"clock"`
+}
+
+// SyncChanges returns the changes since token, or every todo for an empty
+// token. limit is the size of the page, the server's default if 0.
+func (c *Client) SyncChanges(ctx context.Context, since string, limit int) (*ChangeSet, error) {
+	params := url.Values{"since": {since}}
+	if limit > 0 {
+		params.Set("limit", strconv.Itoa(limit))
+	}
+	var set ChangeSet
+	if _, err := c.do(ctx, request{method: http.MethodGet, path: "/sync", query: params}, &set); err != nil {
+		return nil, err
+	}
+	return &set, nil
+}
+
+// Changes returns an iterator over the changes since token. When it is done,
+// its Cursor is the token to pass next time.
+func (c *Client) Changes(ctx context.Context, since string) *Iterator[Change] {
+	return newIterator(ctx, since, func(ctx context.Context, token string) ([]Change, string, bool, error) {
+		set, err := c.SyncChanges(ctx, token, 0)
+		if err != nil {
+			return nil, "", false, err
+		}
+		return set.Changes, set.Token, set.More, nil
+	})
+}
+
+// MaxPush is the most changes PushChanges sends at once.
+const MaxPush = 1000
+
+// ClientChange is a change a client made to a todo, possibly while offline.
+type ClientChange struct {
+	// Op is OpUpsert, which applies Fields to the todo and creates it if
+	// there is none with the ID, or OpDelete.
+	Op string `json:"op"`
+	ID string `json:"id"`
+	// Clock is the client's hybrid logical clock time of the change, e.g.
+	// "1792315800000.0@laptop": Unix milliseconds, a counter and the node.
+	Clock string `json:"clock"`
+	// Fields are the fields an upsert sets, as a merge patch.
+	Fields Patch `json:"fields,omitempty"`
+	// Subtasks says what a delete does with subtasks, SubtasksCascade or
+	// SubtasksPromote.
+	Subtasks string `json:"subtasks,omitempty"`
+}
+
+// Outcomes of a pushed change.
+const (
+	// SyncApplied means the change was applied in full.
+	SyncApplied = "applied"
+	// SyncMerged means the fields in Ignored changed later on the server
+	// and were kept.
+	SyncMerged = "merged"
+	// SyncDeleted means the todo is deleted, which wins over edits.
+	SyncDeleted = "deleted"
+	// SyncRejected means the change failed; Error says why.
+	SyncRejected = "rejected"
+)
+
+// SyncResult is the outcome of a pushed change.
+type SyncResult struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	// Todo is the todo after the change, unless it is deleted or the change
+	// was rejected.
+	Todo    *Todo          `json:"todo,omitempty"`
+	Ignored []string       `json:"ignored,omitempty"`
+	Error   *utils.Problem `json:"error,omitempty"`
+}
+
+// PushChanges sends changes a client made to the server, which applies
+// them in order and merges them field by field with its own. It returns the
+// outcome of each. A rejected change does not fail the call.
+//
+// Applying a change twice has no further effect, so the call is retried
+// like a PUT.
+func (c *Client) PushChanges(ctx context.Context, changes []ClientChange) ([]SyncResult, error) {
+	var result struct {
+		Results []SyncResult `json:"results"`
+	}
+	body := map[string]interface{}{"changes": changes}
+	_, err := c.do(ctx, request{method: http.MethodPost, path: "/sync", body: body, idempotent: true}, &result)
+	return result.Results, err
+}
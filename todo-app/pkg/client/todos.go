@@ -0,0 +1,333 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ListOptions select and order the todos of a listing.
+type ListOptions struct {
+	// Query is a filter query, e.g. `status:pending AND due<2026-11-01`.
+	Query string
+	// Tags lists only todos with all of these tags.
+	Tags []string
+	// Priorities lists only todos with one of these priorities.
+	Priorities []string
+	// Sort orders the todos, e.g. "-priority,due_date".
+	Sort string
+	// Fields returns only these fields of each todo, plus its ID.
+	Fields []string
+	// Limit is the size of each page, the server's default if 0.
+	Limit int
+	// Cursor starts the listing at a page an earlier one led to.
+	Cursor string
+}
+
+func (o ListOptions) values() url.Values {
+	params := url.Values{}
+	if o.Query != "" {
+		params.Set("q", o.Query)
+	}
+	for _, tag := range o.Tags {
+		params.Add("tag", tag)
+	}
+	if len(o.Priorities) > 0 {
+		params.Set("priority", strings.Join(o.Priorities, ","))
+	}
+	if o.Sort != "" {
+		params.Set("sort", o.Sort)
+	}
+	if len(o.Fields) > 0 {
+		params.Set("fields", strings.Join(o.Fields, ","))
+	}
+	if o.Limit > 0 {
+		params.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if o.Cursor != "" {
+		params.Set("cursor", o.Cursor)
+	}
+	return params
+}
+
+// TodoPage is one page of a listing of todos.
+type TodoPage struct {
+	Todos []Todo
+	// NextCursor is the cursor of the next page, "" on the last one.
+	NextCursor string
+}
+
+// ListTodos returns one page of todos. Todos steps through all of them.
+func (c *Client) ListTodos(ctx context.Context, opts ListOptions) (*TodoPage, error) {
+	return c.listPage(ctx, "/todos", opts.values())
+}
+
+// Todos returns an iterator over the todos, fetching them a page at a time.
+func (c *Client) Todos(ctx context.Context, opts ListOptions) *Iterator[Todo] {
+	return c.todoIterator(ctx, "/todos", opts.values(), opts.Cursor)
+}
+
+// FilterTodos returns an iterator over the todos in a status, narrowed
+// further by opts. It is the older form of Todos with a status: query.
+func (c *Client) FilterTodos(ctx context.Context, status string, opts ListOptions) *Iterator[Todo] {
+	params := opts.values()
+	if status != "" {
+		params.Set("status", status)
+	}
+	return c.todoIterator(ctx, "/todos/filter", params, opts.Cursor)
+}
+
+func (c *Client) todoIterator(ctx context.Context, path string, params url.Values, cursor string) *Iterator[Todo] {
+	return newIterator(ctx, cursor, func(ctx context.Context, cursor string) ([]Todo, string, bool, error) {
+		if cursor != "" {
+			params.Set("cursor", cursor)
+		}
+		page, err := c.listPage(ctx, path, params)
+		if err != nil {
+			return nil, "", false, err
+		}
+		return page.Todos, page.NextCursor, page.NextCursor != "", nil
+	})
+}
+
+func (c *Client) listPage(ctx context.Context, path string, params url.Values) (*TodoPage, error) {
+	page := &TodoPage{}
+	resp, err := c.do(ctx, request{method: http.MethodGet, path: path, query: params}, &page.Todos)
+	if err != nil {
+		return nil, err
+	}
+	page.NextCursor = nextCursor(resp.Header.Get("Link"))
+	return page, nil
+}
+
+// nextCursor returns the cursor of the rel="next" link of a Link header, or
+// "" if there is none.
+func nextCursor(header string) string {
+	for _, link := range strings.Split(header, ",") {
+		target, params, ok := strings.Cut(strings.TrimSpace(link), ";")
+		if !ok || !strings.Contains(params, `rel="next"`) {
+			continue
+		}
+		ref, err := url.Parse(strings.Trim(strings.TrimSpace(target), "<>"))
+		if err != nil {
+			return ""
+		}
+		return ref.Query().Get("cursor")
+	}
+	return ""
+}
+
+// CreateTodo creates a todo.
+func (c *Client) CreateTodo(ctx context.Context, todo NewTodo) (*Todo, error) {
+	var created Todo
+	if _, err := c.do(ctx, request{method: http.MethodPost, path: "/todos", body: todo}, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// GetTodo returns a todo, with its subtask progress.
+func (c *Client) GetTodo(ctx context.Context, id string) (*Todo, error) {
+	return c.todo(ctx, request{method: http.MethodGet, path: todoPath(id)})
+}
+
+// UpdateTodo changes the fields of a todo that update sets. If version is
+// not 0, the change is only made to that version of the todo, failing with
+// ErrPrecondition if it has changed since.
+func (c *Client) UpdateTodo(ctx context.Context, id string, update TodoUpdate, version int64) (*Todo, error) {
+	return c.todo(ctx, request{method: http.MethodPut, path: todoPath(id), body: update, header: ifMatch(version)})
+}
+
+// PatchTodo applies a merge patch to a todo, which can set any of its
+// fields. version is as for UpdateTodo.
+func (c *Client) PatchTodo(ctx context.Context, id string, patch Patch, version int64) (*Todo, error) {
+	return c.todo(ctx, request{
+		method: http.MethodPatch, path: todoPath(id), body: patch,
+		contentType: "application/merge-patch+json", header: ifMatch(version),
+	})
+}
+
+// Subtask policies of DeleteTodo.
+const (
+	// SubtasksReject refuses to delete a todo with subtasks.
+	SubtasksReject = ""
+	// SubtasksCascade deletes the subtasks too.
+	SubtasksCascade = "cascade"
+	// SubtasksPromote moves the subtasks up to the todo's parent.
+	SubtasksPromote = "promote"
+)
+
+// DeleteTodo deletes a todo, and its subtasks as the policy says. Deleting a
+// todo that does not exist fails with ErrNotFound.
+func (c *Client) DeleteTodo(ctx context.Context, id, subtasks string) error {
+	var params url.Values
+	if subtasks != "" {
+		params = url.Values{"subtasks": {subtasks}}
+	}
+	_, err := c.do(ctx, request{method: http.MethodDelete, path: todoPath(id), query: params}, nil)
+	return err
+}
+
+// Transition runs a workflow action such as "start" or "complete" on a todo.
+// reason is required by some actions, such as "reopen". version is as for
+// UpdateTodo.
+func (c *Client) Transition(ctx context.Context, id, action, reason string, version int64) (*Todo, error) {
+	body := map[string]string{"reason": reason}
+	return c.todo(ctx, request{method: http.MethodPost, path: todoPath(id) + "/" + url.PathEscape(action), body: body, header: ifMatch(version)})
+}
+
+// AddBlocker marks a todo as blocked by another. version is as for
+// UpdateTodo.
+func (c *Client) AddBlocker(ctx context.Context, id, blocker string, version int64) (*Todo, error) {
+	return c.todo(ctx, request{method: http.MethodPut, path: todoPath(id) + "/blockers/" + url.PathEscape(blocker), header: ifMatch(version)})
+}
+
+// RemoveBlocker removes a blocker of a todo. version is as for UpdateTodo.
+func (c *Client) RemoveBlocker(ctx context.Context, id, blocker string, version int64) (*Todo, error) {
+	return c.todo(ctx, request{method: http.MethodDelete, path: todoPath(id) + "/blockers/" + url.PathEscape(blocker), header: ifMatch(version)})
+}
+
+func (c *Client) todo(ctx context.Context, r request) (*Todo, error) {
+	var todo Todo
+	if _, err := c.do(ctx, r, &todo); err != nil {
+		return nil, err
+	}
+	return &todo, nil
+}
+
+func todoPath(id string) string {
+	return "/todos/" + url.PathEscape(id)
+}
+
+// SearchTodos returns the todos whose title or description match the search
+// terms, best match first. limit is the most to return, the server's default
+// if 0.
+func (c *Client) SearchTodos(ctx context.Context, terms string, limit int) ([]SearchResult, error) {
+	params := url.Values{"q": {terms}}
+	if limit > 0 {
+		params.Set("limit", strconv.Itoa(limit))
+	}
+	var results []SearchResult
+	_, err := c.do(ctx, request{method: http.MethodGet, path: "/todos/search", query: params}, &results)
+	return results, err
+}
+
+// Forest returns every todo as a tree, the top-level todos with their
+// subtasks in Children.
+func (c *Client) Forest(ctx context.Context) ([]Todo, error) {
+	var roots []Todo
+	_, err := c.do(ctx, request{method: http.MethodGet, path: "/todos/tree"}, &roots)
+	return roots, err
+}
+
+// Tree returns a todo with its subtasks, and theirs, in Children.
+func (c *Client) Tree(ctx context.Context, id string) (*Todo, error) {
+	return c.todo(ctx, request{method: http.MethodGet, path: todoPath(id) + "/tree"})
+}
+
+// Subtasks returns the direct subtasks of a todo.
+func (c *Client) Subtasks(ctx context.Context, id string) ([]Todo, error) {
+	var children []Todo
+	_, err := c.do(ctx, request{method: http.MethodGet, path: todoPath(id) + "/children"}, &children)
+	return children, err
+}
+
+// Dependencies returns what a todo is blocked by and what it blocks.
+func (c *Client) Dependencies(ctx context.Context, id string) (*Dependencies, error) {
+	var deps Dependencies
+	if _, err := c.do(ctx, request{method: http.MethodGet, path: todoPath(id) + "/dependencies"}, &deps); err != nil {
+		return nil, err
+	}
+	return &deps, nil
+}
+
+// Plan orders the open todos by their dependencies.
+func (c *Client) Plan(ctx context.Context) (*Plan, error) {
+	var plan Plan
+	if _, err := c.do(ctx, request{method: http.MethodGet, path: "/todos/plan"}, &plan); err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+// Occurrences returns when a repeating todo is next due. limit is the most
+// to return, the server's default if 0.
+func (c *Client) Occurrences(ctx context.Context, id string, limit int) ([]Occurrence, error) {
+	var params url.Values
+	if limit > 0 {
+		params = url.Values{"limit": {strconv.Itoa(limit)}}
+	}
+	var occurrences []Occurrence
+	_, err := c.do(ctx, request{method: http.MethodGet, path: todoPath(id) + "/occurrences", query: params}, &occurrences)
+	return occurrences, err
+}
+
+// ExpandRecurrence previews the occurrences of a recurrence rule without a
+// todo, from rec.Start or now. limit is as for Occurrences.
+func (c *Client) ExpandRecurrence(ctx context.Context, rec Recurrence, limit int) ([]Occurrence, error) {
+	params := url.Values{"rule": {rec.Rule}}
+	if rec.TimeZone != "" {
+		params.Set("time_zone", rec.TimeZone)
+	}
+	if !rec.Start.IsZero() {
+		params.Set("start", rec.Start.Format(time.RFC3339))
+	}
+	if limit > 0 {
+		params.Set("limit", strconv.Itoa(limit))
+	}
+	var occurrences []Occurrence
+	_, err := c.do(ctx, request{method: http.MethodGet, path: "/recurrence/occurrences", query: params}, &occurrences)
+	return occurrences, err
+}
+
+// Workflow returns the server's workflow.
+func (c *Client) Workflow(ctx context.Context) (*Workflow, error) {
+	var wf Workflow
+	if _, err := c.do(ctx, request{method: http.MethodGet, path: "/workflow"}, &wf); err != nil {
+		return nil, err
+	}
+	return &wf, nil
+}
+
+// Tags returns every tag in use and how many todos have it.
+func (c *Client) Tags(ctx context.Context) ([]TagCount, error) {
+	var tags []TagCount
+	_, err := c.do(ctx, request{method: http.MethodGet, path: "/tags"}, &tags)
+	return tags, err
+}
+
+// RenameTag renames a tag on every todo, returning how many it changed.
+func (c *Client) RenameTag(ctx context.Context, from, to string) (int, error) {
+	return c.retag(ctx, "/tags/"+url.PathEscape(from)+"/rename", map[string]string{"to": to})
+}
+
+// MergeTags replaces the tags in from with to on every todo, returning how
+// many it changed.
+func (c *Client) MergeTags(ctx context.Context, from []string, to string) (int, error) {
+	return c.retag(ctx, "/tags/merge", map[string]interface{}{"from": from, "to": to})
+}
+
+// retag makes a tag change. Making one twice changes nothing more, so it is
+// retried like a PUT.
+func (c *Client) retag(ctx context.Context, path string, body interface{}) (int, error) {
+	var result struct {
+		Changed int `json:"changed"`
+	}
+	_, err := c.do(ctx, request{method: http.MethodPost, path: path, body: body, idempotent: true}, &result)
+	return result.Changed, err
+}
+
+// Reminders returns the reminders the server sends within the given time,
+// such as "1d" or "2h"; "" is the server's default of a day.
+func (c *Client) Reminders(ctx context.Context, within string) ([]Notification, error) {
+	var params url.Values
+	if within != "" {
+		params = url.Values{"within": {within}}
+	}
+	var upcoming []Notification
+	_, err := c.do(ctx, request{method: http.MethodGet, path: "/reminders", query: params}, &upcoming)
+	return upcoming, err
+}
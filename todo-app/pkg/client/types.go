@@ -0,0 +1,164 @@
+package client
+
+import "time"
+
+// Todo is a todo as the server returns it.
+type Todo struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	// Status is one of the workflow's statuses, by default pending,
+	// in_progress or completed.
+	Status  string    `json:"status"`
+	DueDate time.Time `json:"due_date,omitempty"`
+	// Priority is none, low, medium, high or urgent.
+	Priority     string      `json:"priority"`
+	Tags         []string    `json:"tags,omitempty"`
+	ParentID     string      `json:"parent_id,omitempty"`
+	AutoComplete bool        `json:"auto_complete,omitempty"`
+	BlockedBy    []string    `json:"blocked_by,omitempty"`
+	Recurrence   *Recurrence `json:"recurrence,omitempty"`
+	// Reminders are how long before the due date to remind, e.g. "1d" or
+	// "2h30m".
+	Reminders []string  `json:"reminders,omitempty"`
+	Position  int64     `json:"position"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Version counts the saves of the todo. Pass it to UpdateTodo and the
+	// like to change only the version you have.
+	Version int64 `json:"version"`
+
+	// Progress is set for todos with subtasks when the todo is fetched on
+	// its own or in a tree.
+	Progress *Progress `json:"progress,omitempty"`
+	// Children are the subtasks, in trees.
+	Children []Todo `json:"children,omitempty"`
+}
+
+// Recurrence makes a todo repeat.
+type Recurrence struct {
+	// Rule is an RFC 5545 recurrence rule, e.g. "FREQ=WEEKLY;BYDAY=MO".
+	Rule string `json:"rule"`
+	// TimeZone is the IANA time zone the rule is in, UTC if empty.
+	TimeZone string `json:"time_zone,omitempty"`
+	// Start is the first occurrence, the todo's due date if zero.
+	Start time.Time `json:"start,omitempty"`
+	// NextID is the next occurrence, once this one is done.
+	NextID string `json:"next_id,omitempty"`
+}
+
+// Progress counts the subtasks of a todo, and how many of them are done.
+type Progress struct {
+	Done  int `json:"done"`
+	Total int `json:"total"`
+}
+
+// NewTodo is a todo to create.
+type NewTodo struct {
+	Title        string      `json:"title"`
+	Description  string      `json:"description,omitempty"`
+	DueDate      time.Time   `json:"due_date,omitempty"`
+	Priority     string      `json:"priority,omitempty"`
+	Tags         []string    `json:"tags,omitempty"`
+	ParentID     string      `json:"parent_id,omitempty"`
+	AutoComplete bool        `json:"auto_complete,omitempty"`
+	BlockedBy    []string    `json:"blocked_by,omitempty"`
+	Recurrence   *Recurrence `json:"recurrence,omitempty"`
+	Reminders    []string    `json:"reminders,omitempty"`
+}
+
+// TodoUpdate replaces the fields of a todo it sets; empty fields are left
+// alone. Use a Patch for the other fields, or to clear one.
+type TodoUpdate struct {
+	Title       string    `json:"title,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Status      string    `json:"status,omitempty"`
+	DueDate     time.Time `json:"due_date,omitempty"`
+	Priority    string    `json:"priority,omitempty"`
+	Tags        []string  `json:"tags,omitempty"`
+}
+
+// Patch is a JSON merge patch (RFC 7386) of a todo: each member sets the
+// field of that name, and a nil value clears it. For example
+//
+//	client.Patch{"priority": "high", "parent_id": nil}
+type Patch map[string]interface{}
+
+// SearchResult is a todo matching a search, with how well it matches and
+// the matching words of its title and description marked with <mark>.
+type SearchResult struct {
+	Todo       Todo              `json:"todo"`
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights"`
+}
+
+// Dependencies are the todos a todo is blocked by and those it blocks.
+type Dependencies struct {
+	BlockedBy []Todo `json:"blocked_by"`
+	Blocks    []Todo `json:"blocks"`
+}
+
+// Plan orders the open todos so that each comes after its blockers.
+type Plan struct {
+	Order []PlanItem `json:"order"`
+	// CriticalPath is the longest chain of todos blocking each other.
+	CriticalPath []PlanItem `json:"critical_path"`
+	// Cyclic are the todos that block each other and cannot be ordered.
+	Cyclic []PlanItem `json:"cyclic,omitempty"`
+}
+
+// PlanItem is a todo in a plan, with the latest time it must be done by for
+// the todos it blocks to make their due dates.
+type PlanItem struct {
+	Todo
+	Deadline *time.Time `json:"deadline,omitempty"`
+}
+
+// Occurrence is a coming occurrence of a repeating todo, numbered from 1
+// for the next one.
+type Occurrence struct {
+	Occurrence int       `json:"occurrence"`
+	DueDate    time.Time `json:"due_date"`
+}
+
+// Workflow is the server's configured statuses and the actions that move
+// todos between them.
+type Workflow struct {
+	Initial  string           `json:"initial"`
+	Statuses []WorkflowStatus `json:"statuses"`
+	Actions  []WorkflowAction `json:"actions"`
+}
+
+// WorkflowStatus is a status of the workflow; todos in a done status count
+// as done.
+type WorkflowStatus struct {
+	Name string `json:"name"`
+	Done bool   `json:"done,omitempty"`
+}
+
+// WorkflowAction moves todos from one of the From statuses to To.
+type WorkflowAction struct {
+	Name             string   `json:"name"`
+	From             []string `json:"from"`
+	To               string   `json:"to"`
+	RequireReason    bool     `json:"require_reason,omitempty"`
+	RequireUnblocked bool     `json:"require_unblocked,omitempty"`
+}
+
+// TagCount is a tag and how many todos have it.
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// Notification is a reminder of a todo, as the server lists it and sends it
+// to its -notify-webhook.
+type Notification struct {
+	ID   string `json:"id"`
+	Todo Todo   `json:"todo"`
+	// Before is how long before the due date the reminder is, "0" at the
+	// due date.
+	Before  string    `json:"before"`
+	At      time.Time `json:"at"`
+	Message string    `json:"message"`
+}
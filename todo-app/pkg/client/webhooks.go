@@ -0,0 +1,149 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Webhook receives the todo events it subscribes to as signed POSTs.
+type Webhook struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+	// Events are the event types sent, e.g. "todo.created" or
+	// "todo.completed".
+	Events []string `json:"events"`
+	// Secret signs the deliveries. The server only shows it when the
+	// webhook is created.
+	Secret    string    `json:"secret,omitempty"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// NewWebhook is a webhook to create. Only URL is required: Events defaults
+// to every event and Secret to a random one.
+type NewWebhook struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events,omitempty"`
+	Secret string   `json:"secret,omitempty"`
+	// Active defaults to true.
+	Active *bool `json:"active,omitempty"`
+}
+
+// WebhookUpdate changes the fields of a webhook that are not nil. Setting
+// Active to false pauses deliveries until it is set back to true.
+type WebhookUpdate struct {
+	URL    *string   `json:"url,omitempty"`
+	Events *[]string `json:"events,omitempty"`
+	Secret *string   `json:"secret,omitempty"`
+	Active *bool     `json:"active,omitempty"`
+}
+
+// Delivery is an event sent, or being sent, to a webhook.
+type Delivery struct {
+	ID        string       `json:"id"`
+	WebhookID string       `json:"webhook_id"`
+	Event     WebhookEvent `json:"event"`
+	// Status is pending, delivered or dead.
+	Status   string `json:"status"`
+	Failures int    `json:"failures"`
+	// Attempts are the attempts so far, oldest first.
+	Attempts    []Attempt  `json:"attempts"`
+	NextAttempt *time.Time `json:"next_attempt,omitempty"`
+}
+
+// WebhookEvent is the body of a delivery.
+type WebhookEvent struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Todo       *Todo     `json:"todo"`
+	// Previous is the todo before an update.
+	Previous *Todo `json:"previous,omitempty"`
+}
+
+// Attempt is one attempt to deliver an event.
+type Attempt struct {
+	At         time.Time `json:"at"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMS int64     `json:"duration_ms"`
+}
+
+// Webhooks returns every webhook.
+func (c *Client) Webhooks(ctx context.Context) ([]Webhook, error) {
+	var hooks []Webhook
+	_, err := c.do(ctx, request{method: http.MethodGet, path: "/webhooks"}, &hooks)
+	return hooks, err
+}
+
+// CreateWebhook creates a webhook. The webhook returned is the only one to
+// show its secret.
+func (c *Client) CreateWebhook(ctx context.Context, hook NewWebhook) (*Webhook, error) {
+	return c.webhook(ctx, request{method: http.MethodPost, path: "/webhooks", body: hook})
+}
+
+// GetWebhook returns a webhook.
+func (c *Client) GetWebhook(ctx context.Context, id string) (*Webhook, error) {
+	return c.webhook(ctx, request{method: http.MethodGet, path: webhookPath(id)})
+}
+
+// UpdateWebhook changes a webhook. Setting the same fields twice changes
+// nothing more, so the call is retried like a PUT.
+func (c *Client) UpdateWebhook(ctx context.Context, id string, update WebhookUpdate) (*Webhook, error) {
+	return c.webhook(ctx, request{method: http.MethodPatch, path: webhookPath(id), body: update, idempotent: true})
+}
+
+// DeleteWebhook deletes a webhook and drops its pending deliveries.
+func (c *Client) DeleteWebhook(ctx context.Context, id string) error {
+	_, err := c.do(ctx, request{method: http.MethodDelete, path: webhookPath(id)}, nil)
+	return err
+}
+
+// Deliveries returns the delivery log of a webhook, newest first.
+func (c *Client) Deliveries(ctx context.Context, id string) ([]Delivery, error) {
+	var deliveries []Delivery
+	_, err := c.do(ctx, request{method: http.MethodGet, path: webhookPath(id) + "/deliveries"}, &deliveries)
+	return deliveries, err
+}
+
+// DeadLetters returns the deliveries that failed every attempt, oldest
+// first.
+func (c *Client) DeadLetters(ctx context.Context) ([]Delivery, error) {
+	var deliveries []Delivery
+	_, err := c.do(ctx, request{method: http.MethodGet, path: "/webhooks/dead-letters"}, &deliveries)
+	return deliveries, err
+}
+
+// RetryDeadLetter queues a dead delivery again.
+func (c *Client) RetryDeadLetter(ctx context.Context, id string) (*Delivery, error) {
+	var delivery Delivery
+	if _, err := c.do(ctx, request{method: http.MethodPost, path: deadLetterPath(id) + "/retry"}, &delivery); err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// DiscardDeadLetter drops a dead delivery.
+func (c *Client) DiscardDeadLetter(ctx context.Context, id string) error {
+	_, err := c.do(ctx, request{method: http.MethodDelete, path: deadLetterPath(id)}, nil)
+	return err
+}
+
+func (c *Client) webhook(ctx context.Context, r request) (*Webhook, error) {
+	var hook Webhook
+	if _, err := c.do(ctx, r, &hook); err != nil {
+		return nil, err
+	}
+	return &hook, nil
+}
+
+func webhookPath(id string) string {
+	return "/webhooks/" + url.PathEscape(id)
+}
+
+func deadLetterPath(id string) string {
+	return "/webhooks/dead-letters/" + url.PathEscape(id)
+}
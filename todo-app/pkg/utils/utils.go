@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -62,22 +63,75 @@ func WriteJSON(w http.ResponseWriter, status int, data interface{}, headers ...h
 	return err
 }
 
-// ErrorJSON writes error response in JSON format
+// ProblemContentType is the media type of RFC 7807 problem details.
+const ProblemContentType = "application/problem+json"
+
+// Problem is an RFC 7807 problem details object. Code is a stable,
+// machine-readable identifier; Type is derived from it.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Code     string `json:"code"`
+	// Errors lists the individual problems of a validation failure.
+	Errors []FieldProblem `json:"errors,omitempty"`
+}
+
+// FieldProblem is one invalid field of a request.
+type FieldProblem struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// ProblemType returns the type URI for a problem code.
+func ProblemType(code string) string {
+	return "urn:todo-app:problem:" + code
+}
+
+func (p *Problem) Error() string {
+	msg := p.Title
+	if p.Detail != "" {
+		msg += ": " + p.Detail
+	}
+	for _, fe := range p.Errors {
+		msg += "\n  " + fe.Field + " " + fe.Message
+	}
+	return msg
+}
+
+// WriteProblem writes p as an application/problem+json response, filling in
+// Type and Title if they are empty.
+func WriteProblem(w http.ResponseWriter, p *Problem) error {
+	if p.Type == "" {
+		p.Type = ProblemType(p.Code)
+	}
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+
+	out, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(p.Status)
+	_, err = w.Write(out)
+	return err
+}
+
+// ErrorJSON writes err as a problem+json response with the generic code for
+// its status.
 func ErrorJSON(w http.ResponseWriter, err error, status ...int) {
 	statusCode := http.StatusInternalServerError
 	if len(status) > 0 {
 		statusCode = status[0]
 	}
 
-	payload := struct {
-		Error   bool   `json:"error"`
-		Message string `json:"message"`
-	}{
-		Error:   true,
-		Message: err.Error(),
-	}
-
-	WriteJSON(w, statusCode, payload)
+	code := strings.ToLower(strings.ReplaceAll(http.StatusText(statusCode), " ", "_"))
+	WriteProblem(w, &Problem{Status: statusCode, Code: code, Detail: err.Error()})
 }
 
 // IsValidStatus validates if a status string is valid
@@ -88,4 +142,4 @@ func IsValidStatus(status string) bool {
 	default:
 		return false
 	}
-}
\ No newline at end of file
+}